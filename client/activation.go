@@ -0,0 +1,25 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/lengxu/golicense/shared"
+)
+
+// DecodeActivationCode 解析激活码内容并检查校验位，用于在生成请求前发现输入错误
+// 客户端没有激活码密钥，激活码是否有效由签发方在兑换时验证
+func DecodeActivationCode(code string) (*ActivationCode, error) {
+	sealed, err := Base58Decode(shared.NormalizeActivationCode(code))
+	if err != nil {
+		return nil, fmt.Errorf("invalid activation code: contains invalid characters")
+	}
+	payload, _, err := shared.OpenActivationCode(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid activation code: %v", err)
+	}
+	parsed, err := shared.ParseActivationPayload(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid activation code: %v", err)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// FindAddonLicenses 查找与license.dat位于同一目录的增购授权文件
+func FindAddonLicenses(licensePath string) []string {
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(licensePath), AddonFilePattern))
+	if err != nil {
+		return nil
+	}
+	return matches
+}
+
+// LoadAddonLicense 独立验证增购授权文件，并检查其是否属于指定的基础授权
+func LoadAddonLicense(addonPath string, base *License) (*License, error) {
+	addon, err := validateLicenseFile(addonPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !addon.IsAddon() {
+		return nil, fmt.Errorf("%s is not an add-on license", filepath.Base(addonPath))
+	}
+	if addon.BaseSerial != base.SerialNumber {
+		return nil, fmt.Errorf("add-on %s belongs to base license %s, not %s",
+			addon.SerialNumber, addon.BaseSerial, base.SerialNumber)
+	}
+
+	return addon, nil
+}
+
+// GetEffectiveLicense 获取合并增购授权后的有效授权
+// 无效、过期或不属于当前基础授权的增购授权会被忽略，不影响基础授权的使用
+func GetEffectiveLicense(licensePath string) (*License, error) {
+	base, err := GetLicenseInfo(licensePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var addons []*License
+	for _, addonPath := range FindAddonLicenses(licensePath) {
+		addon, err := LoadAddonLicense(addonPath, base)
+		if err != nil {
+			continue
+		}
+		addons = append(addons, addon)
+	}
+
+	return MergeLicenses(base, addons...), nil
+}
+
+// MergeLicenses 将增购授权的模块、功能和配额合并到基础授权，返回新的授权数据
+// 配额中0表示无限制：基础授权无限制时保持无限制，否则累加增购的配额
+// 自定义声明以增购授权为准
+func MergeLicenses(base *License, addons ...*License) *License {
+	merged := *base
+	merged.Modules = append([]LicenseModule(nil), base.Modules...)
+	merged.ModulePerms = append([]ModulePermissions(nil), base.ModulePerms...)
+	merged.Features = append([]string(nil), base.Features...)
+	merged.Claims = make(map[string]interface{}, len(base.Claims))
+	for key, value := range base.Claims {
+		merged.Claims[key] = value
+	}
+
+	if len(addons) == 0 {
+		return &merged
+	}
+
+	// 旧版本授权只有模块列表，先补全模块权限以便与增购授权合并
+	if len(merged.ModulePerms) == 0 {
+		for _, module := range merged.Modules {
+			if perm, ok := GetDefaultModulePermission(module); ok {
+				merged.ModulePerms = append(merged.ModulePerms, perm)
+			}
+		}
+	}
+
+	for _, addon := range addons {
+		for _, module := range addon.Modules {
+			if !containsModule(merged.Modules, module) {
+				merged.Modules = append(merged.Modules, module)
+			}
+		}
+
+		for _, perm := range addon.ModulePerms {
+			merged.ModulePerms = mergeModulePerm(merged.ModulePerms, perm)
+		}
+
+		merged.Features = mergeStrings(merged.Features, addon.Features)
+		merged.MaxScans = mergeQuota(merged.MaxScans, addon.MaxScans)
+		merged.MaxAssets = mergeQuota(merged.MaxAssets, addon.MaxAssets)
+		merged.MaxUsers = mergeQuota(merged.MaxUsers, addon.MaxUsers)
+
+		// 增购授权的自定义声明覆盖基础授权中的同名声明
+		for key, value := range addon.Claims {
+			merged.Claims[key] = value
+		}
+	}
+
+	return &merged
+}
+
+// mergeModulePerm 合并单个模块的权限
+func mergeModulePerm(perms []ModulePermissions, addon ModulePermissions) []ModulePermissions {
+	for i, perm := range perms {
+		if perm.Module != addon.Module {
+			continue
+		}
+		perm.Enabled = perm.Enabled || addon.Enabled
+		perm.MaxScans = mergeQuota(perm.MaxScans, addon.MaxScans)
+		perm.MaxTargets = mergeQuota(perm.MaxTargets, addon.MaxTargets)
+		perm.Features = mergeStrings(perm.Features, addon.Features)
+		perm.Permissions = mergeStrings(perm.Permissions, addon.Permissions)
+		perms[i] = perm
+		return perms
+	}
+	return append(perms, addon)
+}
+
+// mergeQuota 合并配额，0表示无限制
+func mergeQuota(base, addon int) int {
+	if base == 0 {
+		return 0
+	}
+	return base + addon
+}
+
+// mergeStrings 合并字符串列表并去重
+func mergeStrings(base, extra []string) []string {
+	result := append([]string(nil), base...)
+	for _, item := range extra {
+		found := false
+		for _, existing := range result {
+			if existing == item {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// containsModule 检查模块列表中是否包含指定模块
+func containsModule(modules []LicenseModule, module LicenseModule) bool {
+	for _, m := range modules {
+		if m == module {
+			return true
+		}
+	}
+	return false
+}
@@ -8,7 +8,7 @@ import (
 )
 
 // AutoLicenseCheck 自动授权检查和req.dat生成（用于goweb主控平台）
-// 这个函数会在找不到license.dat时自动生成req.dat
+// 这个函数会在找不到license.dat时自动生成req.dat；通过SetOnlineConfig配置了授权服务器时先尝试在线激活
 func AutoLicenseCheck(module string) error {
 	// 获取可执行文件所在目录
 	exePath, err := os.Executable()
@@ -23,13 +23,17 @@ func AutoLicenseCheck(module string) error {
 	// 1. 检查license.dat是否存在
 	if _, err := os.Stat(licensePath); os.IsNotExist(err) {
 		fmt.Printf("⚠️  未找到授权文件: %s\n", licensePath)
-		return handleMissingLicense(reqPath)
+		if !tryOnlineActivation(licensePath) {
+			return handleMissingLicense(reqPath)
+		}
 	}
 
 	// 2. 验证license.dat
 	if err := ValidateLicense(licensePath); err != nil {
 		fmt.Printf("⚠️  授权验证失败: %v\n", err)
-		return handleInvalidLicense(reqPath, err)
+		if !tryOnlineActivation(licensePath) {
+			return handleInvalidLicense(reqPath, err)
+		}
 	}
 
 	// 3. 检查模块授权
@@ -44,6 +48,24 @@ func AutoLicenseCheck(module string) error {
 	return nil
 }
 
+// tryOnlineActivation 配置了授权服务器时在线激活，失败时返回false并回退到req.dat流程
+func tryOnlineActivation(licensePath string) bool {
+	config := getOnlineConfig()
+	if config == nil {
+		return false
+	}
+
+	fmt.Printf("🌐 正在连接授权服务器 %s ...\n", config.ServerURL)
+	license, err := ActivateOnline(config, licensePath)
+	if err != nil {
+		fmt.Printf("⚠️  在线激活失败: %v\n", err)
+		return false
+	}
+	fmt.Printf("✓ 在线激活成功，序列号 %s，有效期至 %s\n", license.SerialNumber,
+		time.Unix(license.ExpiresAt, 0).Format("2006-01-02"))
+	return true
+}
+
 // handleMissingLicense 处理缺失授权文件的情况
 func handleMissingLicense(reqPath string) error {
 	// 检查是否已存在req.dat
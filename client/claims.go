@@ -0,0 +1,46 @@
+package client
+
+// GetLicenseClaims 获取授权中的全部自定义声明（已合并增购授权）
+func GetLicenseClaims(licensePath string) (map[string]interface{}, error) {
+	license, err := GetEffectiveLicense(licensePath)
+	if err != nil {
+		return nil, err
+	}
+	return license.Claims, nil
+}
+
+// GetClaimString 获取字符串类型的自定义声明
+func GetClaimString(licensePath, key string) (string, bool) {
+	license, err := GetEffectiveLicense(licensePath)
+	if err != nil {
+		return "", false
+	}
+	return license.ClaimString(key)
+}
+
+// GetClaimInt 获取整数类型的自定义声明
+func GetClaimInt(licensePath, key string) (int64, bool) {
+	license, err := GetEffectiveLicense(licensePath)
+	if err != nil {
+		return 0, false
+	}
+	return license.ClaimInt(key)
+}
+
+// GetClaimBool 获取布尔类型的自定义声明
+func GetClaimBool(licensePath, key string) (bool, bool) {
+	license, err := GetEffectiveLicense(licensePath)
+	if err != nil {
+		return false, false
+	}
+	return license.ClaimBool(key)
+}
+
+// GetClaimStrings 获取字符串列表类型的自定义声明
+func GetClaimStrings(licensePath, key string) ([]string, bool) {
+	license, err := GetEffectiveLicense(licensePath)
+	if err != nil {
+		return nil, false
+	}
+	return license.ClaimStrings(key)
+}
@@ -1,14 +1,20 @@
 package client
 
 import (
+	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"io"
+	"math/big"
+
+	"github.com/lengxu/golicense/shared"
 )
 
 // RSAEncrypt RSA加密
@@ -24,14 +30,44 @@ func RSAVerify(data interface{}, signature []byte, publicKey *rsa.PublicKey) boo
 		return false
 	}
 	
+	return RSAVerifyBytes(jsonData, signature, publicKey)
+}
+
+// RSAVerifyBytes 验证原始字节的RSA签名
+func RSAVerifyBytes(data []byte, signature []byte, publicKey *rsa.PublicKey) bool {
 	// 计算hash
-	hashed := sha256.Sum256(jsonData)
+	hashed := sha256.Sum256(data)
 	
 	// 验证签名
-	err = rsa.VerifyPKCS1v15(publicKey, 0, hashed[:], signature)
+	err := rsa.VerifyPKCS1v15(publicKey, 0, hashed[:], signature)
 	return err == nil
 }
 
+// VerifySignature 按签名算法验证原始字节的签名，算法必须与公钥类型一致
+func VerifySignature(algorithm string, data []byte, signature []byte, publicKey crypto.PublicKey) bool {
+	keyAlgorithm, err := shared.SignatureAlgorithmForKey(publicKey)
+	if err != nil || keyAlgorithm != shared.NormalizeSignatureAlgorithm(algorithm) {
+		return false
+	}
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return RSAVerifyBytes(data, signature, key)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	case *ecdsa.PublicKey:
+		if len(signature) != 64 {
+			return false
+		}
+		hashed := sha256.Sum256(data)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(key, hashed[:], r, s)
+	default:
+		return false
+	}
+}
+
 // GenerateAESKey 生成AES密钥
 func GenerateAESKey() []byte {
 	key := make([]byte, 32) // AES-256
@@ -49,6 +85,16 @@ func AESEncrypt(data interface{}, key []byte) ([]byte, error) {
 		return nil, err
 	}
 	
+	return AESEncryptBytes(jsonData, key)
+}
+
+// AESEncryptBytes AES加密原始字节
+func AESEncryptBytes(plaintext []byte, key []byte) ([]byte, error) {
+	return AESEncryptBytesWithAAD(plaintext, key, nil)
+}
+
+// AESEncryptBytesWithAAD AES-GCM加密原始字节，附加数据参与认证但不加密
+func AESEncryptBytesWithAAD(plaintext []byte, key []byte, additionalData []byte) ([]byte, error) {
 	// 创建AES cipher
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -68,40 +114,45 @@ func AESEncrypt(data interface{}, key []byte) ([]byte, error) {
 	}
 	
 	// 加密
-	ciphertext := gcm.Seal(nonce, nonce, jsonData, nil)
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, additionalData)
 	return ciphertext, nil
 }
 
 // AESDecrypt AES解密
 func AESDecrypt(ciphertext []byte, key []byte, result interface{}) error {
+	plaintext, err := AESDecryptBytes(ciphertext, key)
+	if err != nil {
+		return err
+	}
+	
+	// 反序列化
+	return json.Unmarshal(plaintext, result)
+}
+
+// AESDecryptBytes AES解密为原始字节
+func AESDecryptBytes(ciphertext []byte, key []byte) ([]byte, error) {
 	// 创建AES cipher
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	
 	// 创建GCM模式
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	
 	nonceSize := gcm.NonceSize()
 	if len(ciphertext) < nonceSize {
-		return errors.New("ciphertext too short")
+		return nil, errors.New("ciphertext too short")
 	}
 	
 	// 提取nonce和密文
 	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
 	
 	// 解密
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return err
-	}
-	
-	// 反序列化
-	return json.Unmarshal(plaintext, result)
+	return gcm.Open(nil, nonce, ciphertext, nil)
 }
 
 // SHA256Hash 计算SHA256哈希
@@ -115,10 +166,16 @@ func SHA256Hash(data interface{}) ([]byte, error) {
 	return hash[:], nil
 }
 
-// DeriveKeyFromHardware 从硬件指纹派生AES密钥
+// DeriveKeyFromHardware 从硬件指纹派生AES密钥（旧的固定salt方案，仅用于读取未记录kdf的授权）
 func DeriveKeyFromHardware(hardwareID string) []byte {
 	// 使用硬件指纹和固定salt生成密钥
 	data := hardwareID + "_license_key_salt_2024"
 	hash := sha256.Sum256([]byte(data))
 	return hash[:]
-}
\ No newline at end of file
+}
+
+// DeriveTrialKey 派生试用授权的AES密钥（试用授权不绑定硬件）
+func DeriveTrialKey() []byte {
+	hash := sha256.Sum256([]byte("golicense_trial_license_key_2024"))
+	return hash[:]
+}
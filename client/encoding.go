@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"bytes"
 	"fmt"
+
+	"github.com/lengxu/golicense/shared"
 )
 
 // EncodeToString 将结构体编码为压缩的base64字符串
@@ -42,7 +44,7 @@ func DecodeFromString(encoded string, result interface{}) error {
 	prefix := encoded[:4]
 	data := encoded[4:]
 	
-	if prefix != "REQ:" && prefix != "LIC:" {
+	if prefix != "REQ:" && prefix != "LIC:" && prefix != shared.RevocationListPrefix && prefix != shared.DeactivationReceiptPrefix {
 		return fmt.Errorf("invalid encoded string: unknown prefix %s", prefix)
 	}
 
@@ -95,4 +97,23 @@ func EncodeLicenseToString(data interface{}) (string, error) {
 	
 	// 4. 添加license标识前缀
 	return "LIC:" + encoded, nil
-}
\ No newline at end of file
+}
+
+// encodeWithPrefix 将结构体JSON序列化、gzip压缩并Base58编码，添加指定前缀
+func encodeWithPrefix(data interface{}, prefix string) (string, error) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal data: %v", err)
+	}
+
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	if _, err := gzWriter.Write(jsonData); err != nil {
+		return "", fmt.Errorf("failed to compress data: %v", err)
+	}
+	if err := gzWriter.Close(); err != nil {
+		return "", fmt.Errorf("failed to close gzip writer: %v", err)
+	}
+
+	return prefix + Base58Encode(buf.Bytes()), nil
+}
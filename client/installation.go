@@ -0,0 +1,111 @@
+package client
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lengxu/golicense/shared"
+)
+
+// installationKeyPEMType 安装私钥文件的PEM类型，内容为用硬件指纹派生密钥加密的X25519私钥
+const installationKeyPEMType = "GOLICENSE INSTALLATION KEY"
+
+// hkdfInfoInstallationKey 加密安装私钥文件的密钥派生info标签
+const hkdfInfoInstallationKey = "golicense installation key v1"
+
+// InstallationKeyPath 获取目录下的安装密钥文件路径
+func InstallationKeyPath(dir string) string {
+	return filepath.Join(dir, shared.InstallationKeyFile)
+}
+
+// LoadOrCreateInstallationKey 读取目录下的安装密钥，不存在时生成新的X25519密钥对
+// 已有的安装密钥会被复用，重新生成req.dat不会使已签发的授权失效
+func LoadOrCreateInstallationKey(dir string) (*ecdh.PrivateKey, error) {
+	key, err := LoadInstallationKey(dir)
+	if err == nil {
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err = ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate installation key: %v", err)
+	}
+
+	encrypted, err := AESEncryptBytes(key.Bytes(), installationKeyWrapKey())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt installation key: %v", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: installationKeyPEMType, Bytes: encrypted})
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create installation key directory: %v", err)
+	}
+	if err := os.WriteFile(InstallationKeyPath(dir), data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write installation key: %v", err)
+	}
+	return key, nil
+}
+
+// LoadInstallationKey 读取目录下的安装密钥，文件不存在时返回os.IsNotExist可识别的错误
+// 安装私钥用本机硬件指纹派生的密钥加密，复制到其他机器无法使用
+func LoadInstallationKey(dir string) (*ecdh.PrivateKey, error) {
+	data, err := os.ReadFile(InstallationKeyPath(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != installationKeyPEMType {
+		return nil, errors.New("invalid installation key file")
+	}
+	raw, err := AESDecryptBytes(block.Bytes, installationKeyWrapKey())
+	if err != nil {
+		return nil, errors.New("installation key does not belong to this machine")
+	}
+
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid installation key: %v", err)
+	}
+	return key, nil
+}
+
+// installationKeyWrapKey 派生加密安装私钥文件的密钥
+func installationKeyWrapKey() []byte {
+	return shared.HKDFSHA256([]byte(GetHardwareFingerprint()), nil, []byte(hkdfInfoInstallationKey), 32)
+}
+
+// unwrapInstallationKey 用安装私钥解出X25519接收方的内容密钥
+func unwrapInstallationKey(recipient LicenseRecipient, key *ecdh.PrivateKey) ([]byte, error) {
+	ephemeralBytes, err := base64.StdEncoding.DecodeString(recipient.Ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ephemeral key: %v", err)
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(ephemeralBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral key: %v", err)
+	}
+	sharedSecret, err := key.ECDH(ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("failed to agree on wrap key: %v", err)
+	}
+
+	wrappedKey, err := base64.StdEncoding.DecodeString(recipient.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode content key: %v", err)
+	}
+	wrapKey := shared.DeriveX25519WrapKey(sharedSecret, ephemeralBytes, key.PublicKey().Bytes())
+	contentKey, err := AESDecryptBytes(wrappedKey, wrapKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt content key: %v", err)
+	}
+	return contentKey, nil
+}
@@ -1,14 +1,23 @@
 package client
 
 import (
+	"crypto"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
+	"fmt"
 	"log"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/lengxu/golicense/shared"
 )
 
-// 客户端内置公钥（用于加密请求和验证签名）
-const embeddedPublicKey = `-----BEGIN PUBLIC KEY-----
+// 客户端内置RSA公钥（当前密钥，用于加密请求和验证签名）
+// 声明为变量以便测试在初始化受信任公钥列表前替换为临时生成的密钥
+var embeddedPublicKey = `-----BEGIN PUBLIC KEY-----
 MIICIjANBgkqhkiG9w0BAQEFAAOCAg8AMIICCgKCAgEAsW2m+fxeWHTcDl4LBHVI
 sTbLJyOG7xJm9lhit9AWaMAz3XIXM4WF9hT6VO3E9nJbcTL5ts56nhxOFg4AToze
 FDWg1sXk2pTfcBiTKNLQvAc+5t01a0gFupmXhDs0Z79l5UemwVDAThwJ1yOciN0k
@@ -23,17 +32,150 @@ jXJ1PNPefl3r5hrpFiwlolTUqaoju5T84MXHYpFlN3a+xIORoLePBHGIGlxmCTtz
 55kTNDhieF1Y9TnCvrVZsj8CAwEAAQ==
 -----END PUBLIC KEY-----`
 
+// retiredPublicKeys 已轮换下线的历史公钥，仅用于验证轮换前签发的授权
+// 轮换密钥时把原来的embeddedPublicKey移到这里，再换成keygen生成的新公钥；
+// 确认客户都已换发新授权后，再从这里删除旧公钥（密钥泄露时应尽快删除）
+var retiredPublicKeys = []string{}
+
+// signingPublicKeys 其他受信任的签名公钥（Ed25519或ECDSA P-256）
+// 使用这些算法签名时，req.dat仍用embeddedPublicKey加密
+var signingPublicKeys = []string{}
+
+var (
+	trustStoreOnce sync.Once
+	trustStoreMu   sync.RWMutex
+	trustStore     map[string]crypto.PublicKey
+	currentKeyID   string
+)
+
 // GetEmbeddedPublicKey 获取内置公钥
 func GetEmbeddedPublicKey() *rsa.PublicKey {
-	block, _ := pem.Decode([]byte(embeddedPublicKey))
+	pub, err := parsePublicKeyPEM([]byte(embeddedPublicKey))
+	if err != nil {
+		log.Fatal(err)
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		log.Fatal("embedded public key is not an RSA key")
+	}
+	return rsaPub
+}
+
+// GetCurrentKeyID 获取当前内置公钥的密钥标识，写入req.dat供授权端选择解密私钥
+func GetCurrentKeyID() string {
+	initTrustStore()
+	return currentKeyID
+}
+
+// AddTrustedPublicKey 向受信任公钥列表添加PEM格式的公钥，返回其密钥标识
+func AddTrustedPublicKey(pemData []byte) (string, error) {
+	initTrustStore()
+	pub, err := parsePublicKeyPEM(pemData)
+	if err != nil {
+		return "", err
+	}
+	if _, err := shared.SignatureAlgorithmForKey(pub); err != nil {
+		return "", err
+	}
+	keyID, err := shared.KeyID(pub)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute key ID: %v", err)
+	}
+
+	trustStoreMu.Lock()
+	defer trustStoreMu.Unlock()
+	trustStore[keyID] = pub
+	return keyID, nil
+}
+
+// LoadTrustedPublicKeyFile 从PEM文件添加受信任公钥
+func LoadTrustedPublicKeyFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read public key file: %v", err)
+	}
+	return AddTrustedPublicKey(data)
+}
+
+// GetTrustedPublicKey 按密钥标识获取受信任公钥
+func GetTrustedPublicKey(keyID string) (crypto.PublicKey, error) {
+	initTrustStore()
+	trustStoreMu.RLock()
+	defer trustStoreMu.RUnlock()
+	pub, ok := trustStore[keyID]
+	if !ok {
+		return nil, fmt.Errorf("license was signed by untrusted key %s", keyID)
+	}
+	return pub, nil
+}
+
+// GetTrustedKeyIDs 获取全部受信任公钥的密钥标识
+func GetTrustedKeyIDs() []string {
+	initTrustStore()
+	trustStoreMu.RLock()
+	defer trustStoreMu.RUnlock()
+	ids := make([]string, 0, len(trustStore))
+	for id := range trustStore {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// trustedPublicKeys 获取验证授权可用的公钥
+// 授权带有密钥标识时只使用对应公钥；密钥轮换前签发的授权没有标识，依次尝试全部受信任公钥
+func trustedPublicKeys(keyID string) ([]crypto.PublicKey, error) {
+	if keyID != "" {
+		pub, err := GetTrustedPublicKey(keyID)
+		if err != nil {
+			return nil, err
+		}
+		return []crypto.PublicKey{pub}, nil
+	}
+
+	var keys []crypto.PublicKey
+	for _, id := range GetTrustedKeyIDs() {
+		pub, err := GetTrustedPublicKey(id)
+		if err == nil {
+			keys = append(keys, pub)
+		}
+	}
+	return keys, nil
+}
+
+// initTrustStore 用内置的当前公钥和历史公钥初始化受信任公钥列表
+func initTrustStore() {
+	trustStoreOnce.Do(func() {
+		store := make(map[string]crypto.PublicKey)
+		keys := append([]string{embeddedPublicKey}, signingPublicKeys...)
+		for _, data := range append(keys, retiredPublicKeys...) {
+			pub, err := parsePublicKeyPEM([]byte(data))
+			if err != nil {
+				log.Fatal(err)
+			}
+			keyID, err := shared.KeyID(pub)
+			if err != nil {
+				log.Fatal("failed to compute key ID:", err)
+			}
+			if data == embeddedPublicKey {
+				currentKeyID = keyID
+			}
+			store[keyID] = pub
+		}
+		trustStore = store
+	})
+}
+
+// parsePublicKeyPEM 解析PKIX PEM格式的公钥
+func parsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
 	if block == nil {
-		log.Fatal("failed to decode public key")
+		return nil, errors.New("failed to decode public key")
 	}
-	
+
 	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
 	if err != nil {
-		log.Fatal("failed to parse public key:", err)
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
 	}
-	
-	return pub.(*rsa.PublicKey)
-}
\ No newline at end of file
+	return pub, nil
+}
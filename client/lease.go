@@ -0,0 +1,425 @@
+package client
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lengxu/golicense/shared"
+)
+
+// leaseKeyPEMType 租约签名密钥文件的PEM类型
+const leaseKeyPEMType = "GOLICENSE LEASE KEY"
+
+// minHeartbeatInterval 续租的最短间隔
+const minHeartbeatInterval = 5 * time.Second
+
+// ErrLeaseExpired 租约已过期且未能续租
+var ErrLeaseExpired = errors.New("floating license lease has expired")
+
+// LeaseKeyPath 获取目录下的租约签名密钥文件路径
+func LeaseKeyPath(dir string) string {
+	return filepath.Join(dir, shared.LeaseKeyFile)
+}
+
+// LoadOrCreateLeaseKey 读取目录下的租约签名密钥，不存在时生成新的Ed25519密钥
+// 与安装密钥一样用本机硬件指纹派生的密钥加密保存
+func LoadOrCreateLeaseKey(dir string) (ed25519.PrivateKey, error) {
+	key, err := LoadLeaseKey(dir)
+	if err == nil {
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	_, key, err = ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate lease key: %v", err)
+	}
+	encrypted, err := AESEncryptBytes(key.Seed(), installationKeyWrapKey())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt lease key: %v", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: leaseKeyPEMType, Bytes: encrypted})
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lease key directory: %v", err)
+	}
+	if err := os.WriteFile(LeaseKeyPath(dir), data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write lease key: %v", err)
+	}
+	return key, nil
+}
+
+// LoadLeaseKey 读取目录下的租约签名密钥，文件不存在时返回os.IsNotExist可识别的错误
+func LoadLeaseKey(dir string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(LeaseKeyPath(dir))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != leaseKeyPEMType {
+		return nil, errors.New("invalid lease key file")
+	}
+	seed, err := AESDecryptBytes(block.Bytes, installationKeyWrapKey())
+	if err != nil {
+		return nil, errors.New("lease key belongs to another machine")
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, errors.New("invalid lease key file")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// GenerateLeaseServerRequest 在租约服务器上生成申请浮动授权的req.dat
+// 租约签名密钥和安装密钥保存在req.dat所在目录，签发的浮动授权也需放在该目录
+func GenerateLeaseServerRequest(reqFilePath string) error {
+	dir := filepath.Dir(reqFilePath)
+	leaseKey, err := LoadOrCreateLeaseKey(dir)
+	if err != nil {
+		return err
+	}
+	request, err := NewLicenseRequest(dir, "")
+	if err != nil {
+		return err
+	}
+	request.LeaseKey = base64.StdEncoding.EncodeToString(leaseKey.Public().(ed25519.PublicKey))
+
+	encodedString, err := EncodeRequest(request)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(reqFilePath, []byte(encodedString), 0644); err != nil {
+		return fmt.Errorf("failed to write request file: %v", err)
+	}
+	return nil
+}
+
+// VerifyLease 验证租约服务器返回的租约：浮动授权须由受信任的签发方签名且未吊销、未过期，
+// 租约须由浮动授权中的租约公钥签名并属于本机；licenseDir为本机授权目录，从中读取revoked.dat
+func VerifyLease(signed *SignedLease, licenseDir string) (*License, *Lease, error) {
+	// 1. 验证浮动授权的签发方签名，载荷hash包含在信封签名中
+	var licenseFile LicenseFile
+	if err := DecodeFromString(strings.TrimSpace(signed.License), &licenseFile); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode floating license: %v", err)
+	}
+	if !shared.IsEnvelopeFormat(licenseFile.Version) {
+		return nil, nil, fmt.Errorf("floating license format %s is not supported", licenseFile.Version)
+	}
+	payload, err := base64.StdEncoding.DecodeString(signed.Payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode floating license payload: %v", err)
+	}
+	var unverified License
+	if err := json.Unmarshal(payload, &unverified); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse floating license: %v", err)
+	}
+	license, err := verifyLicensePayload(&licenseFile, shared.LicenseBinding(&unverified), payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !license.IsFloating() {
+		return nil, nil, errors.New("lease server is not serving a floating license")
+	}
+	if err := checkRevocation(license, &licenseFile, filepath.Join(licenseDir, "license.dat")); err != nil {
+		return nil, nil, err
+	}
+	if signed.Renewal != "" {
+		if expiresAt, err := verifyRenewalToken(license, signed.Renewal); err == nil {
+			license.ExpiresAt = expiresAt
+		}
+	}
+	now := time.Now().Unix()
+	if now < license.IssuedAt || now > license.ExpiresAt {
+		return nil, nil, fmt.Errorf("floating license expired on %s", time.Unix(license.ExpiresAt, 0).Format("2006-01-02 15:04:05"))
+	}
+
+	// 2. 用浮动授权中的租约公钥验证租约
+	leaseKey, err := base64.StdEncoding.DecodeString(license.LeaseKey)
+	if err != nil || len(leaseKey) != ed25519.PublicKeySize {
+		return nil, nil, errors.New("floating license has an invalid lease key")
+	}
+	signature, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode lease signature: %v", err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(leaseKey), shared.LeaseSigningInput(signed.Data), signature) {
+		return nil, nil, errors.New("invalid lease signature")
+	}
+	data, err := base64.StdEncoding.DecodeString(signed.Data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode lease: %v", err)
+	}
+	var lease Lease
+	if err := json.Unmarshal(data, &lease); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse lease: %v", err)
+	}
+
+	// 3. 检查租约归属和有效期
+	if lease.SerialNumber != license.SerialNumber {
+		return nil, nil, errors.New("lease does not belong to the floating license")
+	}
+	if lease.ClientID != GetHardwareFingerprint() {
+		return nil, nil, errors.New("lease was issued to another machine")
+	}
+	if now >= lease.ExpiresAt || lease.ExpiresAt > license.ExpiresAt {
+		return nil, nil, ErrLeaseExpired
+	}
+	return license, &lease, nil
+}
+
+// LeaseConfig 租约客户端配置
+type LeaseConfig struct {
+	ServerURL  string          // 租约服务器地址，如 http://lease.lab.local:8500
+	ProxyURL   string          // HTTP代理地址，为空时使用环境变量
+	CACertFile string          // 额外信任的CA证书PEM文件
+	Timeout    time.Duration   // 请求超时时间，默认30秒
+	HTTPClient *http.Client    // 自定义HTTP客户端
+	OnLost     func(err error) // 租约过期且未能续租时调用，重新借到租约前License返回ErrLeaseExpired
+	LicenseDir string          // 本机授权目录，从中读取吊销列表revoked.dat，默认为可执行文件所在目录
+}
+
+// LeaseClient 浮动授权客户端：借出租约、定期续租，退出时归还
+type LeaseClient struct {
+	config LeaseConfig
+
+	mu      sync.Mutex
+	license *License
+	lease   *Lease
+	lost    bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewLeaseClient 创建租约客户端
+func NewLeaseClient(config LeaseConfig) *LeaseClient {
+	return &LeaseClient{config: config}
+}
+
+// Checkout 借出租约，本机已持有租约时服务器返回同一租约
+func (c *LeaseClient) Checkout() (*License, error) {
+	signed, err := c.post(shared.LeaseCheckoutPath, "")
+	if err != nil {
+		return nil, err
+	}
+	return c.accept(signed)
+}
+
+// Heartbeat 续租；租约在服务器上已不存在（如服务器重启）时重新借出
+func (c *LeaseClient) Heartbeat() error {
+	c.mu.Lock()
+	lease := c.lease
+	c.mu.Unlock()
+	if lease == nil {
+		_, err := c.Checkout()
+		return err
+	}
+
+	signed, err := c.post(shared.LeaseHeartbeatPath, lease.LeaseID)
+	var onlineErr *OnlineError
+	if errors.As(err, &onlineErr) && onlineErr.Code == shared.LeaseErrorNotFound {
+		_, err = c.Checkout()
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	_, err = c.accept(signed)
+	return err
+}
+
+// Release 归还租约，其他客户端可以立即借用
+func (c *LeaseClient) Release() error {
+	c.mu.Lock()
+	lease := c.lease
+	c.lease = nil
+	c.license = nil
+	c.mu.Unlock()
+	if lease == nil {
+		return nil
+	}
+	_, err := c.post(shared.LeaseReleasePath, lease.LeaseID)
+	return err
+}
+
+// Start 借出租约并在后台定期续租，程序退出前应调用Close归还租约
+func (c *LeaseClient) Start() error {
+	if _, err := c.Checkout(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop == nil {
+		c.stop = make(chan struct{})
+		c.done = make(chan struct{})
+		go c.heartbeatLoop(c.stop, c.done)
+	}
+	return nil
+}
+
+// Close 停止续租并归还租约
+func (c *LeaseClient) Close() error {
+	c.mu.Lock()
+	stop, done := c.stop, c.done
+	c.stop, c.done = nil, nil
+	c.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	return c.Release()
+}
+
+// License 当前租约对应的浮动授权，租约过期时返回ErrLeaseExpired
+func (c *LeaseClient) License() (*License, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lease == nil || time.Now().Unix() >= c.lease.ExpiresAt {
+		return nil, ErrLeaseExpired
+	}
+	return c.license, nil
+}
+
+// CheckModule 检查当前租约是否授权指定模块
+func (c *LeaseClient) CheckModule(module string) error {
+	license, err := c.License()
+	if err != nil {
+		return err
+	}
+	for _, m := range license.Modules {
+		if string(m) == module {
+			return nil
+		}
+	}
+	return fmt.Errorf("module %s is not licensed", module)
+}
+
+// heartbeatLoop 按租约期限的三分之一定期续租；续租失败时保留当前租约直到过期，过期后通知OnLost
+func (c *LeaseClient) heartbeatLoop(stop, done chan struct{}) {
+	defer close(done)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(c.heartbeatInterval()):
+		}
+
+		err := c.Heartbeat()
+		c.mu.Lock()
+		expired := c.lease == nil || time.Now().Unix() >= c.lease.ExpiresAt
+		notify := err != nil && expired && !c.lost
+		if notify {
+			c.lost = true
+		}
+		c.mu.Unlock()
+		if notify && c.config.OnLost != nil {
+			c.config.OnLost(err)
+		}
+	}
+}
+
+// heartbeatInterval 续租间隔：租约期限的三分之一，租约已过期时按最短间隔重试
+func (c *LeaseClient) heartbeatInterval() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lease == nil {
+		return minHeartbeatInterval
+	}
+	interval := time.Duration(c.lease.ExpiresAt-c.lease.IssuedAt) * time.Second / 3
+	if remaining := time.Until(time.Unix(c.lease.ExpiresAt, 0)); remaining <= 0 {
+		return minHeartbeatInterval
+	} else if interval > remaining {
+		interval = remaining
+	}
+	if interval < minHeartbeatInterval {
+		interval = minHeartbeatInterval
+	}
+	return interval
+}
+
+// accept 验证并保存服务器返回的租约
+func (c *LeaseClient) accept(signed *SignedLease) (*License, error) {
+	license, lease, err := VerifyLease(signed, c.licenseDir())
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.license = license
+	c.lease = lease
+	c.lost = false
+	return license, nil
+}
+
+// licenseDir 本机授权目录，未配置时为可执行文件所在目录
+func (c *LeaseClient) licenseDir() string {
+	if c.config.LicenseDir != "" {
+		return c.config.LicenseDir
+	}
+	exePath, err := os.Executable()
+	if err != nil {
+		return "."
+	}
+	return filepath.Dir(exePath)
+}
+
+// post 向租约服务器提交请求，返回服务器签发的租约
+func (c *LeaseClient) post(path string, leaseID string) (*SignedLease, error) {
+	endpoint, err := url.JoinPath(c.config.ServerURL, path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lease server URL: %v", err)
+	}
+	body, err := json.Marshal(shared.LeaseRequest{
+		ClientID:    GetHardwareFingerprint(),
+		MachineInfo: GetMachineInfo(),
+		LeaseID:     leaseID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode lease request: %v", err)
+	}
+
+	transport := OnlineConfig{
+		ProxyURL:   c.config.ProxyURL,
+		CACertFile: c.config.CACertFile,
+		Timeout:    c.config.Timeout,
+		HTTPClient: c.config.HTTPClient,
+	}
+	httpClient, err := transport.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to contact lease server: %v", err)
+	}
+	defer resp.Body.Close()
+	payload, err := io.ReadAll(io.LimitReader(resp.Body, maxOnlineResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lease server response: %v", err)
+	}
+	if err := responseError(resp.StatusCode, payload); err != nil {
+		return nil, err
+	}
+	if path == shared.LeaseReleasePath {
+		return nil, nil
+	}
+
+	var signed SignedLease
+	if err := json.Unmarshal(payload, &signed); err != nil {
+		return nil, fmt.Errorf("failed to parse lease server response: %v", err)
+	}
+	return &signed, nil
+}
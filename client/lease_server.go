@@ -0,0 +1,368 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lengxu/golicense/shared"
+)
+
+// DefaultLeaseTTL 租约默认期限，客户端每隔三分之一期限续租一次
+const DefaultLeaseTTL = 10 * time.Minute
+
+// maxLeaseRequestSize 租约请求体的最大字节数
+const maxLeaseRequestSize = 64 << 10
+
+// LeaseServer 租约服务器，持有浮动授权并向局域网内的客户端借出有期限的租约
+// 租约只保存在内存中，服务器重启后客户端在下次续租时自动重新借出
+type LeaseServer struct {
+	TTL    time.Duration // 租约期限，默认DefaultLeaseTTL
+	Logger *log.Logger   // 访问日志，为空时不输出
+
+	licensePath string
+	key         ed25519.PrivateKey
+
+	mu                sync.Mutex
+	license           *License
+	licenseText       string
+	payload           []byte
+	renewal           string // 生效的离线续期码，随租约发给客户端
+	modTime           time.Time
+	renewalModTime    time.Time
+	revocationModTime time.Time
+	loadErr           error             // 重新加载失败的原因，非空时不再借出和续租
+	leases            map[string]*Lease // 按租约标识索引
+}
+
+// NewLeaseServer 加载浮动授权创建租约服务器，租约签名密钥从授权文件所在目录读取
+func NewLeaseServer(licensePath string) (*LeaseServer, error) {
+	key, err := LoadLeaseKey(filepath.Dir(licensePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lease key: %v", err)
+	}
+	s := &LeaseServer{
+		TTL:         DefaultLeaseTTL,
+		licensePath: licensePath,
+		key:         key,
+		leases:      make(map[string]*Lease),
+	}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// License 当前加载的浮动授权
+func (s *LeaseServer) License() *License {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.license
+}
+
+// Handler 返回租约服务器的HTTP处理器
+func (s *LeaseServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(shared.LeaseCheckoutPath, s.handleCheckout)
+	mux.HandleFunc(shared.LeaseHeartbeatPath, s.handleHeartbeat)
+	mux.HandleFunc(shared.LeaseReleasePath, s.handleRelease)
+	mux.HandleFunc(shared.LeaseStatusPath, s.handleStatus)
+	return mux
+}
+
+// reload 加载并验证浮动授权，调用方不能持有锁
+func (s *LeaseServer) reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reloadLocked()
+}
+
+// reloadLocked 加载并验证浮动授权，调用方需持有锁
+func (s *LeaseServer) reloadLocked() error {
+	info, err := os.Stat(s.licensePath)
+	if err != nil {
+		return fmt.Errorf("failed to read floating license: %v", err)
+	}
+	license, licenseFile, payload, err := openLicenseFile(s.licensePath)
+	if err != nil {
+		return err
+	}
+	if !license.IsFloating() {
+		return errors.New("license is not a floating license")
+	}
+	if !shared.IsEnvelopeFormat(licenseFile.Version) {
+		return fmt.Errorf("floating license format %s is not supported", licenseFile.Version)
+	}
+	if license.LeaseKey != base64.StdEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey)) {
+		return errors.New("floating license was issued for a different lease key")
+	}
+	text, err := os.ReadFile(s.licensePath)
+	if err != nil {
+		return fmt.Errorf("failed to read floating license: %v", err)
+	}
+
+	// openLicenseFile返回的是续期后的授权，从原始载荷重新查找生效的续期码
+	var base License
+	if err := json.Unmarshal(payload, &base); err != nil {
+		return fmt.Errorf("failed to parse floating license: %v", err)
+	}
+
+	s.license = license
+	s.licenseText = string(text)
+	s.payload = payload
+	s.renewal = applyRenewal(&base, filepath.Dir(s.licensePath))
+	s.modTime = info.ModTime()
+	s.renewalModTime = s.dirFileModTime(shared.RenewalTokenFile)
+	s.revocationModTime = s.dirFileModTime(shared.RevocationListFile)
+	return nil
+}
+
+// dirFileModTime 授权文件目录下指定文件的修改时间，不存在时为零值
+func (s *LeaseServer) dirFileModTime(name string) time.Time {
+	info, err := os.Stat(filepath.Join(filepath.Dir(s.licensePath), name))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// changedLocked 授权文件、离线续期码或吊销列表是否在上次加载后有变化；调用方需持有锁
+func (s *LeaseServer) changedLocked() bool {
+	info, err := os.Stat(s.licensePath)
+	if err != nil {
+		return true
+	}
+	return !info.ModTime().Equal(s.modTime) ||
+		!s.dirFileModTime(shared.RenewalTokenFile).Equal(s.renewalModTime) ||
+		!s.dirFileModTime(shared.RevocationListFile).Equal(s.revocationModTime)
+}
+
+// refreshLocked 授权文件、离线续期码或吊销列表更新后重新加载，清理过期租约；调用方需持有锁
+// 重新加载失败（如授权已被吊销或文件被删除）时收回全部租约并停止借出，直到重新加载成功
+func (s *LeaseServer) refreshLocked(now time.Time) error {
+	if s.loadErr != nil || s.changedLocked() {
+		if err := s.reloadLocked(); err != nil {
+			if s.loadErr == nil {
+				s.logf("floating license is no longer valid, revoking %d leases: %v", len(s.leases), err)
+			}
+			s.loadErr = err
+			s.leases = make(map[string]*Lease)
+			return fmt.Errorf("floating license is no longer valid: %v", err)
+		}
+		if s.loadErr != nil {
+			s.logf("floating license reloaded, resuming leases")
+		}
+		s.loadErr = nil
+	}
+	for id, lease := range s.leases {
+		if now.Unix() >= lease.ExpiresAt {
+			delete(s.leases, id)
+		}
+	}
+	if now.Unix() > s.license.ExpiresAt {
+		return fmt.Errorf("floating license %s expired on %s", s.license.SerialNumber,
+			time.Unix(s.license.ExpiresAt, 0).Format("2006-01-02"))
+	}
+	return nil
+}
+
+// handleCheckout 借出租约，客户端已持有租约时续期并返回同一租约，不占用新的并发数
+func (s *LeaseServer) handleCheckout(w http.ResponseWriter, r *http.Request) {
+	request, ok := s.readRequest(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if err := s.refreshLocked(now); err != nil {
+		s.writeError(w, r, http.StatusServiceUnavailable, shared.LeaseErrorLicenseInvalid, err.Error())
+		return
+	}
+
+	for _, lease := range s.leases {
+		if lease.ClientID == request.ClientID {
+			s.extendLocked(lease, now)
+			s.writeLeaseLocked(w, r, lease)
+			return
+		}
+	}
+	if s.license.MaxSeats > 0 && len(s.leases) >= s.license.MaxSeats {
+		s.writeError(w, r, http.StatusForbidden, shared.LeaseErrorPoolExhausted,
+			fmt.Sprintf("all %d floating seats are in use", s.license.MaxSeats))
+		return
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	lease := &Lease{
+		LeaseID:      hex.EncodeToString(id),
+		SerialNumber: s.license.SerialNumber,
+		ClientID:     request.ClientID,
+	}
+	s.extendLocked(lease, now)
+	s.leases[lease.LeaseID] = lease
+	s.logf("%s checked out lease %s (%d/%d in use, %s)", r.RemoteAddr, lease.LeaseID[:8], len(s.leases),
+		s.license.MaxSeats, request.MachineInfo)
+	s.writeLeaseLocked(w, r, lease)
+}
+
+// handleHeartbeat 续租，租约不存在或已过期时返回lease_not_found，客户端需重新借出
+func (s *LeaseServer) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	request, ok := s.readRequest(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if err := s.refreshLocked(now); err != nil {
+		s.writeError(w, r, http.StatusServiceUnavailable, shared.LeaseErrorLicenseInvalid, err.Error())
+		return
+	}
+
+	lease, found := s.leases[request.LeaseID]
+	if !found || lease.ClientID != request.ClientID {
+		s.writeError(w, r, http.StatusNotFound, shared.LeaseErrorNotFound, "lease not found or expired")
+		return
+	}
+	s.extendLocked(lease, now)
+	s.writeLeaseLocked(w, r, lease)
+}
+
+// handleRelease 归还租约，租约不存在时同样返回成功
+func (s *LeaseServer) handleRelease(w http.ResponseWriter, r *http.Request) {
+	request, ok := s.readRequest(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if lease, found := s.leases[request.LeaseID]; found && lease.ClientID == request.ClientID {
+		delete(s.leases, request.LeaseID)
+		s.logf("%s released lease %s (%d/%d in use)", r.RemoteAddr, lease.LeaseID[:8], len(s.leases), s.license.MaxSeats)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleStatus 查询租约池使用情况
+func (s *LeaseServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, r, http.StatusMethodNotAllowed, shared.APIErrorInvalidRequest, "method not allowed")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refreshLocked(time.Now()); err != nil && s.loadErr != nil {
+		s.writeError(w, r, http.StatusServiceUnavailable, shared.LeaseErrorLicenseInvalid, "floating license is no longer valid")
+		return
+	}
+
+	// 接口不需要认证，不列出租约标识和客户端硬件指纹
+	status := shared.LeasePoolStatus{
+		SerialNumber: s.license.SerialNumber,
+		MaxSeats:     s.license.MaxSeats,
+		InUse:        len(s.leases),
+		ExpiresAt:    s.license.ExpiresAt,
+		Leases:       []LeaseSummary{},
+	}
+	for _, lease := range s.leases {
+		status.Leases = append(status.Leases, LeaseSummary{IssuedAt: lease.IssuedAt, ExpiresAt: lease.ExpiresAt})
+	}
+	sort.Slice(status.Leases, func(i, j int) bool {
+		return status.Leases[i].IssuedAt < status.Leases[j].IssuedAt
+	})
+	s.writeJSON(w, http.StatusOK, status)
+}
+
+// extendLocked 将租约延长一个期限，不超过浮动授权的到期时间
+func (s *LeaseServer) extendLocked(lease *Lease, now time.Time) {
+	ttl := s.TTL
+	if ttl <= 0 {
+		ttl = DefaultLeaseTTL
+	}
+	lease.IssuedAt = now.Unix()
+	lease.ExpiresAt = now.Add(ttl).Unix()
+	if lease.ExpiresAt > s.license.ExpiresAt {
+		lease.ExpiresAt = s.license.ExpiresAt
+	}
+}
+
+// writeLeaseLocked 签名并输出租约
+func (s *LeaseServer) writeLeaseLocked(w http.ResponseWriter, r *http.Request, lease *Lease) {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	s.writeJSON(w, http.StatusOK, shared.SignedLease{
+		Data:      encoded,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, shared.LeaseSigningInput(encoded))),
+		License:   s.licenseText,
+		Payload:   base64.StdEncoding.EncodeToString(s.payload),
+		Renewal:   s.renewal,
+	})
+}
+
+// readRequest 解析租约请求体
+func (s *LeaseServer) readRequest(w http.ResponseWriter, r *http.Request) (*shared.LeaseRequest, bool) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, r, http.StatusMethodNotAllowed, shared.APIErrorInvalidRequest, "method not allowed")
+		return nil, false
+	}
+	var request shared.LeaseRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxLeaseRequestSize)).Decode(&request); err != nil {
+		s.writeError(w, r, http.StatusBadRequest, shared.APIErrorInvalidRequest, "invalid JSON body")
+		return nil, false
+	}
+	if request.ClientID == "" {
+		s.writeError(w, r, http.StatusBadRequest, shared.APIErrorInvalidRequest, "missing client_id")
+		return nil, false
+	}
+	return &request, true
+}
+
+// writeJSON 输出JSON响应
+func (s *LeaseServer) writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError 输出错误响应
+func (s *LeaseServer) writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	s.logf("%s %s %s: %d %s: %s", r.RemoteAddr, r.Method, r.URL.Path, status, code, message)
+	s.writeJSON(w, status, shared.APIError{Code: code, Message: message})
+}
+
+// internalError 记录内部错误，响应中不暴露细节
+func (s *LeaseServer) internalError(w http.ResponseWriter, r *http.Request, err error) {
+	s.logf("%s %s %s: internal error: %v", r.RemoteAddr, r.Method, r.URL.Path, err)
+	s.writeJSON(w, http.StatusInternalServerError, shared.APIError{Code: shared.APIErrorInternal, Message: "internal server error"})
+}
+
+// logf 输出日志
+func (s *LeaseServer) logf(format string, args ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, args...)
+	}
+}
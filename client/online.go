@@ -0,0 +1,263 @@
+package client
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lengxu/golicense/shared"
+)
+
+// defaultOnlineTimeout 在线激活请求的默认超时时间
+const defaultOnlineTimeout = 30 * time.Second
+
+// maxOnlineResponseSize 授权服务器响应的最大字节数
+const maxOnlineResponseSize = 1 << 20
+
+// OnlineConfig 在线激活配置
+type OnlineConfig struct {
+	ServerURL      string        // 授权服务器地址，如 https://license.example.com
+	Entitlement    string        // 授权标识，与ActivationCode二选一
+	ActivationCode string        // 激活码
+	ProxyURL       string        // HTTP代理地址，为空时使用环境变量HTTPS_PROXY/HTTP_PROXY
+	CACertFile     string        // 额外信任的CA证书PEM文件，用于自签名或企业内部CA
+	Timeout        time.Duration // 请求超时时间，默认30秒
+	HTTPClient     *http.Client  // 自定义HTTP客户端，设置后忽略ProxyURL、CACertFile和Timeout
+}
+
+var (
+	onlineMu     sync.RWMutex
+	onlineConfig *OnlineConfig
+)
+
+// SetOnlineConfig 设置在线激活配置，AutoLicenseCheck在授权缺失或失效时先尝试在线激活
+// 传入nil关闭在线激活
+func SetOnlineConfig(config *OnlineConfig) {
+	onlineMu.Lock()
+	defer onlineMu.Unlock()
+	if config == nil {
+		onlineConfig = nil
+		return
+	}
+	copied := *config
+	onlineConfig = &copied
+}
+
+// getOnlineConfig 获取在线激活配置，未配置时返回nil
+func getOnlineConfig() *OnlineConfig {
+	onlineMu.RLock()
+	defer onlineMu.RUnlock()
+	return onlineConfig
+}
+
+// OnlineError 授权服务器或租约服务器拒绝了请求
+type OnlineError struct {
+	StatusCode int    // HTTP状态码
+	Code       string // 错误代码，见shared.APIError*
+	Message    string // 错误说明
+}
+
+// Error 实现error接口
+func (e *OnlineError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("license server returned HTTP %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("license server rejected the request (%s): %s", e.Code, e.Message)
+}
+
+// ActivateOnline 向授权服务器提交本机的授权请求，验证返回的授权后原子地安装到licensePath
+// 安装密钥对保存在licensePath所在目录
+func ActivateOnline(config *OnlineConfig, licensePath string) (*License, error) {
+	if config.Entitlement == "" && config.ActivationCode == "" {
+		return nil, errors.New("online activation requires an entitlement or an activation code")
+	}
+	request, err := NewLicenseRequest(filepath.Dir(licensePath), config.ActivationCode)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := EncodeRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	body := shared.ActivationRequest{
+		Entitlement:    config.Entitlement,
+		ActivationCode: request.ActivationCode,
+		Request:        encoded,
+	}
+	response, err := postOnline(config, shared.APIActivatePath, &body)
+	if err != nil {
+		return nil, err
+	}
+	return installLicense(licensePath, response.License)
+}
+
+// RenewOnline 从授权服务器下载续期后的授权，有新授权时验证后原子地替换licensePath
+// 返回当前生效的授权以及是否安装了新授权
+func RenewOnline(config *OnlineConfig, licensePath string) (*License, bool, error) {
+	request, err := NewLicenseRequest(filepath.Dir(licensePath), "")
+	if err != nil {
+		return nil, false, err
+	}
+	encoded, err := EncodeRequest(request)
+	if err != nil {
+		return nil, false, err
+	}
+
+	response, err := postOnline(config, shared.APIRenewPath, &shared.ActivationRequest{Request: encoded})
+	if err != nil {
+		return nil, false, err
+	}
+	if !response.Renewed {
+		if license, err := validateLicenseFile(licensePath); err == nil {
+			return license, false, nil
+		}
+	}
+	license, err := installLicense(licensePath, response.License)
+	if err != nil {
+		return nil, false, err
+	}
+	return license, true, nil
+}
+
+// postOnline 向授权服务器提交请求并解析响应
+func postOnline(config *OnlineConfig, path string, body *shared.ActivationRequest) (*shared.ActivationResponse, error) {
+	endpoint, err := url.JoinPath(config.ServerURL, path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid license server URL: %v", err)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode activation request: %v", err)
+	}
+
+	httpClient, err := config.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Post(endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to contact license server: %v", err)
+	}
+	defer resp.Body.Close()
+	payload, err := io.ReadAll(io.LimitReader(resp.Body, maxOnlineResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read license server response: %v", err)
+	}
+
+	if err := responseError(resp.StatusCode, payload); err != nil {
+		return nil, err
+	}
+
+	var response shared.ActivationResponse
+	if err := json.Unmarshal(payload, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse license server response: %v", err)
+	}
+	if response.License == "" {
+		return nil, errors.New("license server response contains no license")
+	}
+	return &response, nil
+}
+
+// responseError 将非2xx响应转换为OnlineError
+func responseError(statusCode int, payload []byte) error {
+	if statusCode >= 200 && statusCode < 300 {
+		return nil
+	}
+	onlineErr := &OnlineError{StatusCode: statusCode}
+	var apiErr shared.APIError
+	if json.Unmarshal(payload, &apiErr) == nil && apiErr.Code != "" {
+		onlineErr.Code = apiErr.Code
+		onlineErr.Message = apiErr.Message
+	} else {
+		onlineErr.Message = strings.TrimSpace(string(payload))
+	}
+	return onlineErr
+}
+
+// httpClient 按配置创建HTTP客户端
+func (c *OnlineConfig) httpClient() (*http.Client, error) {
+	if c.HTTPClient != nil {
+		return c.HTTPClient, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.ProxyURL != "" {
+		proxy, err := url.Parse(c.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %v", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if c.CACertFile != "" {
+		pem, err := os.ReadFile(c.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CACertFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultOnlineTimeout
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// installLicense 验证授权服务器返回的license.dat后原子地替换licensePath
+// 先写入同目录的临时文件并完成验证（验证需要同目录的安装密钥），验证失败时不影响已有的授权文件
+func installLicense(licensePath string, encoded string) (*License, error) {
+	dir := filepath.Dir(licensePath)
+	tmp, err := os.CreateTemp(dir, ".license-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary license file: %v", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.WriteString(encoded); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to write license file: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to write license file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write license file: %v", err)
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write license file: %v", err)
+	}
+
+	license, err := validateLicenseFile(tmpPath)
+	if err != nil {
+		return nil, fmt.Errorf("license received from server is invalid: %v", err)
+	}
+	if license.IsAddon() {
+		return nil, errors.New("license received from server is an add-on license")
+	}
+
+	if err := os.Rename(tmpPath, licensePath); err != nil {
+		return nil, fmt.Errorf("failed to install license file: %v", err)
+	}
+	return license, nil
+}
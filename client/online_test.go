@@ -0,0 +1,297 @@
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lengxu/golicense/server"
+	"github.com/lengxu/golicense/shared"
+)
+
+// testKey 测试用的RSA签名私钥，对应替换后的内置公钥
+var testKey *rsa.PrivateKey
+
+// TestMain 用临时生成的RSA密钥替换内置公钥，授权服务器用对应私钥解密req.dat和签名
+func TestMain(m *testing.M) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to generate test key:", err)
+		os.Exit(1)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to encode test key:", err)
+		os.Exit(1)
+	}
+	embeddedPublicKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	testKey = key
+	server.SetPrivateKey(key)
+	os.Exit(m.Run())
+}
+
+// onlineTestEnv 测试用的授权服务器和客户端授权目录
+type onlineTestEnv struct {
+	t                *testing.T
+	server           *httptest.Server
+	ledger           *server.Ledger
+	entitlementsPath string
+	licensePath      string
+}
+
+// newOnlineTestEnv 启动授权服务器，用户配置目录指向临时目录，避免读写本机的吊销缓存和停用记录
+func newOnlineTestEnv(t *testing.T, entitlement server.Entitlement) *onlineTestEnv {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+
+	env := &onlineTestEnv{
+		t:                t,
+		entitlementsPath: filepath.Join(dir, "entitlements.json"),
+		licensePath:      filepath.Join(dir, "app", "license.dat"),
+	}
+	if err := os.MkdirAll(filepath.Dir(env.licensePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	env.writeEntitlement(entitlement)
+	entitlements, err := server.LoadEntitlements(env.entitlementsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.ledger, err = server.OpenLedger(filepath.Join(dir, "ledger.jsonl")); err != nil {
+		t.Fatal(err)
+	}
+	env.server = httptest.NewServer(server.NewLicenseServer(entitlements, env.ledger).Handler())
+	t.Cleanup(env.server.Close)
+	return env
+}
+
+// writeEntitlement 改写授权标识文件，修改时间向后调整，保证授权服务器重新加载
+func (env *onlineTestEnv) writeEntitlement(entitlement server.Entitlement) {
+	env.t.Helper()
+	data, err := json.Marshal([]server.Entitlement{entitlement})
+	if err != nil {
+		env.t.Fatal(err)
+	}
+	modTime := time.Now()
+	if info, err := os.Stat(env.entitlementsPath); err == nil {
+		modTime = info.ModTime().Add(time.Second)
+	}
+	if err := os.WriteFile(env.entitlementsPath, data, 0644); err != nil {
+		env.t.Fatal(err)
+	}
+	if err := os.Chtimes(env.entitlementsPath, modTime, modTime); err != nil {
+		env.t.Fatal(err)
+	}
+}
+
+// config 指向测试授权服务器的在线激活配置
+func (env *onlineTestEnv) config(entitlement string) *OnlineConfig {
+	return &OnlineConfig{ServerURL: env.server.URL, Entitlement: entitlement, Timeout: 10 * time.Second}
+}
+
+// testEntitlement 两年后截止的旗舰版授权标识
+func testEntitlement(seats, days int) server.Entitlement {
+	return server.Entitlement{
+		ID:       "ENT-test-0001",
+		Customer: "测试客户",
+		Edition:  shared.EditionEnterprise,
+		Expires:  time.Now().AddDate(2, 0, 0).Format("2006-01-02"),
+		Days:     days,
+		Seats:    seats,
+	}
+}
+
+func TestActivateOnline(t *testing.T) {
+	env := newOnlineTestEnv(t, testEntitlement(1, 30))
+
+	license, err := ActivateOnline(env.config("ENT-test-0001"), env.licensePath)
+	if err != nil {
+		t.Fatalf("ActivateOnline: %v", err)
+	}
+	if license.CustomerName != "测试客户" || license.Edition != shared.EditionEnterprise {
+		t.Errorf("unexpected license: customer %q, edition %q", license.CustomerName, license.Edition)
+	}
+	if !license.IsBoundTo(GetHardwareFingerprint()) {
+		t.Error("license is not bound to this machine")
+	}
+	if _, err := validateLicenseFile(env.licensePath); err != nil {
+		t.Fatalf("installed license is invalid: %v", err)
+	}
+
+	// 同一机器再次激活重新签发，不占用新的机器数
+	if _, err := ActivateOnline(env.config("ENT-test-0001"), env.licensePath); err != nil {
+		t.Fatalf("reactivating the same machine: %v", err)
+	}
+
+	_, err = ActivateOnline(env.config("ENT-unknown"), env.licensePath)
+	assertOnlineError(t, err, shared.APIErrorUnknownEntitlement)
+}
+
+func TestActivateOnlineSeatsExhausted(t *testing.T) {
+	env := newOnlineTestEnv(t, testEntitlement(1, 30))
+
+	// 唯一的机器数已被另一台机器占用
+	now := time.Now()
+	if err := env.ledger.Append(server.LedgerEntry{
+		SerialNumber: "NSE-000000000000",
+		HardwareIDs:  []string{strings.Repeat("0", 64)},
+		LicenseType:  string(shared.LicenseTypeStandard),
+		CustomerName: "测试客户",
+		Edition:      string(shared.EditionEnterprise),
+		IssuedAt:     now.Unix(),
+		ExpiresAt:    now.AddDate(0, 0, 30).Unix(),
+		Entitlement:  "ENT-test-0001",
+		RecordedAt:   now.Unix(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ActivateOnline(env.config("ENT-test-0001"), env.licensePath)
+	assertOnlineError(t, err, shared.APIErrorSeatsExhausted)
+	if _, err := os.Stat(env.licensePath); !os.IsNotExist(err) {
+		t.Errorf("license.dat was written although activation failed: %v", err)
+	}
+}
+
+func TestRenewOnline(t *testing.T) {
+	env := newOnlineTestEnv(t, testEntitlement(0, 30))
+
+	activated, err := ActivateOnline(env.config("ENT-test-0001"), env.licensePath)
+	if err != nil {
+		t.Fatalf("ActivateOnline: %v", err)
+	}
+
+	// 授权标识未延长时返回当前授权
+	license, renewed, err := RenewOnline(env.config(""), env.licensePath)
+	if err != nil {
+		t.Fatalf("RenewOnline: %v", err)
+	}
+	if renewed || license.ExpiresAt != activated.ExpiresAt {
+		t.Errorf("renewed = %v, expires %d; want the current license expiring %d", renewed, license.ExpiresAt, activated.ExpiresAt)
+	}
+
+	env.writeEntitlement(testEntitlement(0, 90))
+	license, renewed, err = RenewOnline(env.config(""), env.licensePath)
+	if err != nil {
+		t.Fatalf("RenewOnline after extending the entitlement: %v", err)
+	}
+	if !renewed || license.ExpiresAt <= activated.ExpiresAt {
+		t.Fatalf("renewed = %v, expires %d; want a new license expiring after %d", renewed, license.ExpiresAt, activated.ExpiresAt)
+	}
+	installed, err := validateLicenseFile(env.licensePath)
+	if err != nil {
+		t.Fatalf("renewed license is invalid: %v", err)
+	}
+	if installed.ExpiresAt != license.ExpiresAt {
+		t.Errorf("installed license expires %d, want %d", installed.ExpiresAt, license.ExpiresAt)
+	}
+}
+
+func TestRenewOnlineForeignInstallation(t *testing.T) {
+	env := newOnlineTestEnv(t, testEntitlement(0, 30))
+	if _, err := ActivateOnline(env.config("ENT-test-0001"), env.licensePath); err != nil {
+		t.Fatalf("ActivateOnline: %v", err)
+	}
+	env.writeEntitlement(testEntitlement(0, 90))
+
+	// 同一硬件指纹、其他目录中新生成的安装密钥不能取得续期授权
+	foreign := filepath.Join(t.TempDir(), "license.dat")
+	_, _, err := RenewOnline(env.config(""), foreign)
+	assertOnlineError(t, err, shared.APIErrorInstallMismatch)
+	var onlineErr *OnlineError
+	if errors.As(err, &onlineErr) && onlineErr.StatusCode != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", onlineErr.StatusCode, http.StatusForbidden)
+	}
+	if _, err := os.Stat(foreign); !os.IsNotExist(err) {
+		t.Errorf("license.dat was written for the foreign installation: %v", err)
+	}
+
+	// 已激活的安装仍能续期
+	if _, renewed, err := RenewOnline(env.config(""), env.licensePath); err != nil || !renewed {
+		t.Fatalf("RenewOnline from the activated installation: renewed = %v, err = %v", renewed, err)
+	}
+}
+
+func TestActivateOnlineInvalidLicenseKeepsExisting(t *testing.T) {
+	env := newOnlineTestEnv(t, testEntitlement(0, 30))
+	if _, err := ActivateOnline(env.config("ENT-test-0001"), env.licensePath); err != nil {
+		t.Fatalf("ActivateOnline: %v", err)
+	}
+	existing, err := os.ReadFile(env.licensePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 转发到授权服务器，篡改返回的授权文件签名
+	tampering := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := httptest.NewRecorder()
+		env.server.Config.Handler.ServeHTTP(recorder, r)
+		var response shared.ActivationResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || response.License == "" {
+			t.Errorf("unexpected license server response: %s", recorder.Body.String())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var file server.LicenseFile
+		if err := server.DecodeFromString(response.License, &file); err != nil {
+			t.Errorf("failed to decode issued license: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		signature, _ := base64.StdEncoding.DecodeString(file.Signature)
+		signature[0] ^= 0xff
+		file.Signature = base64.StdEncoding.EncodeToString(signature)
+		response.License, _ = server.EncodeLicenseToString(&file)
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer tampering.Close()
+
+	config := env.config("ENT-test-0001")
+	config.ServerURL = tampering.URL
+	_, err = ActivateOnline(config, env.licensePath)
+	if err == nil || !strings.Contains(err.Error(), "license received from server is invalid") {
+		t.Fatalf("ActivateOnline with a tampered license: err = %v", err)
+	}
+
+	current, err := os.ReadFile(env.licensePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(current, existing) {
+		t.Error("existing license.dat was modified")
+	}
+	if _, err := validateLicenseFile(env.licensePath); err != nil {
+		t.Errorf("existing license is no longer valid: %v", err)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(env.licensePath), ".license-*.tmp"))
+	if len(leftovers) > 0 {
+		t.Errorf("temporary license files were left behind: %v", leftovers)
+	}
+}
+
+// assertOnlineError 检查授权服务器返回了指定的错误代码
+func assertOnlineError(t *testing.T, err error, code string) {
+	t.Helper()
+	var onlineErr *OnlineError
+	if !errors.As(err, &onlineErr) {
+		t.Fatalf("err = %v, want an OnlineError with code %s", err, code)
+	}
+	if onlineErr.Code != code {
+		t.Fatalf("error code = %s (%s), want %s", onlineErr.Code, onlineErr.Message, code)
+	}
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lengxu/golicense/shared"
+)
+
+// deactivatedListFile 本机已停用授权列表的文件名，保存在用户配置目录
+const deactivatedListFile = "deactivated.txt"
+
+// ErrLicenseDeactivated 授权已在本机停用并迁移到其他机器
+var ErrLicenseDeactivated = errors.New("license was deactivated on this machine for transfer")
+
+// DeactivateLicense 停用本机授权以迁移到新机器：生成加密给授权方的停用回执并保存到receiptPath，
+// 然后在本机记录停用并删除license.dat。停用后即使恢复备份的license.dat也不能再使用
+func DeactivateLicense(licensePath, receiptPath string) (*DeactivationReceipt, error) {
+	license, licenseFile, payload, err := openLicenseFile(licensePath)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case license.IsTrial(), license.IsAddon():
+		return nil, fmt.Errorf("%s licenses cannot be transferred", license.LicenseType)
+	case license.IsFloating():
+		return nil, errors.New("floating licenses cannot be transferred, request a new lease server license instead")
+	case license.IsSiteLicense():
+		return nil, errors.New("site licenses cannot be transferred machine by machine")
+	}
+	if !shared.IsEnvelopeFormat(licenseFile.Version) {
+		return nil, fmt.Errorf("license format %s cannot be transferred, ask the issuer to reissue the license first", licenseFile.Version)
+	}
+	text, err := os.ReadFile(licensePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read license file: %v", err)
+	}
+
+	// 1. 生成停用回执，用内置公钥加密
+	receipt := &DeactivationReceipt{
+		SerialNumber:  license.SerialNumber,
+		HardwareID:    license.HardwareID,
+		MachineInfo:   GetMachineInfo(),
+		DeactivatedAt: time.Now().Unix(),
+		ExpiresAt:     license.ExpiresAt,
+		License:       strings.TrimSpace(string(text)),
+		Payload:       base64.StdEncoding.EncodeToString(payload),
+	}
+	plaintext, err := json.Marshal(receipt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode deactivation receipt: %v", err)
+	}
+	receiptFile, err := sealRequestFile(plaintext, receipt.DeactivatedAt, shared.DeactivationReceiptFormat)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := encodeWithPrefix(receiptFile, shared.DeactivationReceiptPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode deactivation receipt: %v", err)
+	}
+
+	// 2. 先保存回执，再记录停用并删除授权文件；任何一步失败都不会丢失仍可用的授权
+	file, err := os.OpenFile(receiptPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create deactivation receipt: %v", err)
+	}
+	if _, err := file.WriteString(encoded); err != nil {
+		file.Close()
+		os.Remove(receiptPath)
+		return nil, fmt.Errorf("failed to write deactivation receipt: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(receiptPath)
+		return nil, fmt.Errorf("failed to write deactivation receipt: %v", err)
+	}
+	if err := recordDeactivation(license, licenseFile); err != nil {
+		os.Remove(receiptPath)
+		return nil, err
+	}
+	if err := os.Remove(licensePath); err != nil {
+		return nil, fmt.Errorf("license deactivated but the license file could not be removed: %v", err)
+	}
+	return receipt, nil
+}
+
+// deactivationID 授权文件的停用标识，与吊销列表使用相同的授权文件标识，每次签发都不同
+func deactivationID(license *License, licenseFile *LicenseFile) string {
+	return shared.LicenseFileID(license, licenseFile)
+}
+
+// deactivatedListPath 本机已停用授权列表的路径
+func deactivatedListPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "golicense", deactivatedListFile)
+}
+
+// recordDeactivation 将授权文件加入本机已停用列表
+func recordDeactivation(license *License, licenseFile *LicenseFile) error {
+	path := deactivatedListPath()
+	if path == "" {
+		return errors.New("no user configuration directory to record the deactivation")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to record deactivation: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to record deactivation: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(deactivationID(license, licenseFile) + "\n"); err != nil {
+		return fmt.Errorf("failed to record deactivation: %v", err)
+	}
+	return file.Sync()
+}
+
+// checkDeactivated 检查授权文件是否已在本机停用
+func checkDeactivated(license *License, licenseFile *LicenseFile) error {
+	path := deactivatedListPath()
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	id := deactivationID(license, licenseFile)
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == id {
+			return ErrLicenseDeactivated
+		}
+	}
+	return nil
+}
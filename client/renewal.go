@@ -0,0 +1,183 @@
+package client
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lengxu/golicense/shared"
+)
+
+// GenerateRenewalChallenge 生成离线续期申请码，客户通过电话或邮件告知授权方
+// 申请码包含授权序列号和license.dat中的到期时间，授权已过期时也可以生成
+func GenerateRenewalChallenge(licensePath string) (string, error) {
+	license, err := readRenewableLicense(licensePath)
+	if err != nil {
+		return "", err
+	}
+	payload, err := shared.MarshalRenewalChallenge(&RenewalChallenge{
+		SerialNumber: license.SerialNumber,
+		ExpiresAt:    license.ExpiresAt,
+	})
+	if err != nil {
+		return "", err
+	}
+	return shared.FormatActivationCode(Base58Encode(shared.SealRenewalCode(payload))), nil
+}
+
+// ApplyRenewalToken 验证授权方签发的续期码并保存到授权文件目录下的renewal.dat
+// license.dat保持不变，之后验证授权时按续期码中的到期时间计算有效期；返回续期后的授权
+func ApplyRenewalToken(licensePath string, token string) (*License, error) {
+	license, err := readRenewableLicense(licensePath)
+	if err != nil {
+		return nil, err
+	}
+	token = shared.FormatActivationCode(shared.NormalizeActivationCode(token))
+	expiresAt, err := verifyRenewalToken(license, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// 保留其他授权（如同目录的增购授权）的续期码，替换本授权已应用的续期码
+	dir := filepath.Dir(licensePath)
+	tokens := []string{token}
+	for _, existing := range readRenewalTokens(dir) {
+		applied, err := verifyRenewalToken(license, existing)
+		if err != nil {
+			tokens = append(tokens, existing)
+			continue
+		}
+		if applied >= expiresAt {
+			return validateRenewedLicense(licensePath)
+		}
+	}
+	if err := writeRenewalTokens(dir, tokens); err != nil {
+		return nil, err
+	}
+	return validateRenewedLicense(licensePath)
+}
+
+// readRenewableLicense 读取并验证可以离线续期的授权，不检查有效期
+func readRenewableLicense(licensePath string) (*License, error) {
+	license, licenseFile, _, currentHW, err := readVerifiedLicense(licensePath)
+	if err != nil {
+		return nil, err
+	}
+	if license.IsTrial() {
+		return nil, errors.New("trial licenses cannot be renewed offline")
+	}
+	if !license.IsBoundTo(currentHW) {
+		return nil, errors.New("hardware fingerprint mismatch")
+	}
+	if err := checkRevocation(license, licenseFile, licensePath); err != nil {
+		return nil, err
+	}
+	return license, nil
+}
+
+// validateRenewedLicense 应用续期码后重新验证授权，浮动授权按租约服务器的方式验证
+func validateRenewedLicense(licensePath string) (*License, error) {
+	license, _, _, err := openLicenseFile(licensePath)
+	return license, err
+}
+
+// verifyRenewalToken 用受信任公钥验证续期码是否为该授权签发，返回续期后的到期时间
+func verifyRenewalToken(license *License, token string) (int64, error) {
+	sealed, err := Base58Decode(shared.NormalizeActivationCode(token))
+	if err != nil {
+		return 0, errors.New("invalid renewal code: contains invalid characters")
+	}
+	payload, err := shared.OpenRenewalCode(sealed)
+	if err != nil {
+		return 0, fmt.Errorf("invalid renewal code: %v", err)
+	}
+	expiresAt, head, signature, err := shared.SplitRenewalToken(payload)
+	if err != nil {
+		return 0, fmt.Errorf("invalid renewal code: %v", err)
+	}
+	challenge, err := shared.MarshalRenewalChallenge(&RenewalChallenge{
+		SerialNumber: license.SerialNumber,
+		ExpiresAt:    license.ExpiresAt,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// 续期码可能由密钥轮换后的新私钥签发，依次尝试全部Ed25519和ECDSA受信任公钥
+	publicKeys, err := trustedPublicKeys("")
+	if err != nil {
+		return 0, err
+	}
+	signingInput := shared.RenewalSigningInput(challenge, head)
+	if !verifyWithAny(publicKeys, func(publicKey crypto.PublicKey) bool {
+		alg, err := shared.SignatureAlgorithmForKey(publicKey)
+		return err == nil && shared.IsRenewalAlgorithm(alg) && VerifySignature(alg, signingInput, signature, publicKey)
+	}) {
+		return 0, errors.New("renewal code was not issued for this license")
+	}
+	if expiresAt <= license.ExpiresAt {
+		return 0, errors.New("renewal code does not extend the license")
+	}
+	return expiresAt, nil
+}
+
+// applyRenewal 在授权文件目录下查找适用于该授权的续期码，将授权到期时间延长到其中最晚的时间
+// 返回生效的续期码，没有适用的续期码时返回空字符串；无效或不属于该授权的续期码被忽略
+func applyRenewal(license *License, licenseDir string) string {
+	if license.IsTrial() {
+		return ""
+	}
+	var applied string
+	latest := license.ExpiresAt
+	for _, token := range readRenewalTokens(licenseDir) {
+		if expiresAt, err := verifyRenewalToken(license, token); err == nil && expiresAt > latest {
+			applied = token
+			latest = expiresAt
+		}
+	}
+	license.ExpiresAt = latest
+	return applied
+}
+
+// readRenewalTokens 读取renewal.dat中的续期码，每行一个
+func readRenewalTokens(licenseDir string) []string {
+	data, err := os.ReadFile(filepath.Join(licenseDir, shared.RenewalTokenFile))
+	if err != nil {
+		return nil
+	}
+	var tokens []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			tokens = append(tokens, line)
+		}
+	}
+	return tokens
+}
+
+// writeRenewalTokens 原子地写入renewal.dat
+func writeRenewalTokens(licenseDir string, tokens []string) error {
+	tmp, err := os.CreateTemp(licenseDir, ".renewal-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary renewal file: %v", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.WriteString(strings.Join(tokens, "\n") + "\n"); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write renewal file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write renewal file: %v", err)
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return fmt.Errorf("failed to write renewal file: %v", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(licenseDir, shared.RenewalTokenFile)); err != nil {
+		return fmt.Errorf("failed to install renewal file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lengxu/golicense/server"
+)
+
+func TestRenewalToken(t *testing.T) {
+	env := newOnlineTestEnv(t, testEntitlement(0, 30))
+	activated, err := ActivateOnline(env.config("ENT-test-0001"), env.licensePath)
+	if err != nil {
+		t.Fatalf("ActivateOnline: %v", err)
+	}
+	code, err := GenerateRenewalChallenge(env.licensePath)
+	if err != nil {
+		t.Fatalf("GenerateRenewalChallenge: %v", err)
+	}
+	challenge, err := server.ParseRenewalChallenge(code)
+	if err != nil {
+		t.Fatalf("ParseRenewalChallenge: %v", err)
+	}
+	expiresAt := time.Unix(activated.ExpiresAt, 0).AddDate(1, 0, 0)
+
+	// RSA签名私钥不能签发续期码
+	if _, err := server.GenerateRenewalToken(challenge, expiresAt); !errors.Is(err, server.ErrRenewalKeyUnsupported) {
+		t.Fatalf("GenerateRenewalToken with an RSA key: err = %v, want ErrRenewalKeyUnsupported", err)
+	}
+
+	// 续期专用的Ed25519密钥，公钥加入客户端受信任公钥
+	_, renewalKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SetSigningKey(renewalKey); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.SetPrivateKey(testKey) })
+	publicKey, err := server.MarshalPublicKeyPEM(renewalKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddTrustedPublicKey(publicKey); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := server.GenerateRenewalToken(challenge, expiresAt)
+	if err != nil {
+		t.Fatalf("GenerateRenewalToken: %v", err)
+	}
+	if len(token) > 120 {
+		t.Errorf("renewal code is %d characters long, want at most 120: %s", len(token), token)
+	}
+	renewed, err := ApplyRenewalToken(env.licensePath, token)
+	if err != nil {
+		t.Fatalf("ApplyRenewalToken: %v", err)
+	}
+	if renewed.ExpiresAt != expiresAt.Unix() {
+		t.Errorf("renewed license expires %d, want %d", renewed.ExpiresAt, expiresAt.Unix())
+	}
+	if _, err := ApplyRenewalToken(env.licensePath, token[:len(token)-7]); err == nil {
+		t.Error("ApplyRenewalToken accepted a truncated renewal code")
+	}
+}
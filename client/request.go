@@ -2,77 +2,137 @@ package client
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
+
+	"github.com/lengxu/golicense/shared"
 )
 
 // GenerateRequest 生成授权请求文件req.dat
 func GenerateRequest(reqFilePath string) error {
-	// 1. 获取硬件指纹
-	hardwareID := GetHardwareFingerprint()
-	
-	// 2. 生成请求ID
-	requestID := generateRequestID()
-	
-	// 3. 构造请求数据
-	request := LicenseRequest{
-		HardwareID:  hardwareID,
-		Timestamp:   time.Now().Unix(),
-		Version:     "1.0.0",
-		MachineInfo: GetMachineInfo(),
-		RequestID:   requestID,
+	return GenerateRequestWithCode(reqFilePath, "")
+}
+
+// GenerateRequestWithCode 生成带激活码的授权请求文件，签发方按激活码内容签发授权
+// 激活码为空时与GenerateRequest相同
+func GenerateRequestWithCode(reqFilePath string, activationCode string) error {
+	// 1. 构造请求数据，安装密钥对保存在req.dat所在目录
+	installationDir := filepath.Dir(reqFilePath)
+	request, err := NewLicenseRequest(installationDir, activationCode)
+	if err != nil {
+		return err
 	}
 
-	// 4. 计算请求数据hash
-	requestHash, err := SHA256Hash(request)
+	// 2. 加密并编码请求
+	encodedString, err := EncodeRequest(request)
 	if err != nil {
-		return fmt.Errorf("failed to calculate request hash: %v", err)
+		return err
 	}
 
-	// 5. 生成AES密钥
-	aesKey := GenerateAESKey()
+	// 3. 保存req.dat
+	if err := os.WriteFile(reqFilePath, []byte(encodedString), 0644); err != nil {
+		return fmt.Errorf("failed to write request file: %v", err)
+	}
 
-	// 6. AES加密请求数据
-	encryptedData, err := AESEncrypt(request, aesKey)
-	if err != nil {
-		return fmt.Errorf("failed to encrypt request data: %v", err)
+	fmt.Printf("Request file generated successfully:\n")
+	fmt.Printf("  Request ID: %s\n", request.RequestID)
+	fmt.Printf("  Hardware ID: %s\n", request.HardwareID)
+	fmt.Printf("  Machine Info: %s\n", request.MachineInfo)
+	fmt.Printf("  Installation Key: %s\n", InstallationKeyPath(installationDir))
+	if request.ActivationCode != "" {
+		fmt.Printf("  Activation Code: %s\n", request.ActivationCode)
+	}
+	fmt.Printf("  File: %s\n", reqFilePath)
+
+	return nil
+}
+
+// NewLicenseRequest 构造本机的授权请求，installationDir为安装密钥对所在目录（即license.dat所在目录）
+func NewLicenseRequest(installationDir string, activationCode string) (*LicenseRequest, error) {
+	if activationCode != "" {
+		if _, err := DecodeActivationCode(activationCode); err != nil {
+			return nil, err
+		}
+		activationCode = shared.FormatActivationCode(shared.NormalizeActivationCode(activationCode))
 	}
 
-	// 7. 用内置公钥加密AES密钥
-	publicKey := GetEmbeddedPublicKey()
-	encryptedKey, err := RSAEncrypt(aesKey, publicKey)
+	// 1. 读取或生成安装密钥对，授权内容将加密给该安装
+	installationKey, err := LoadOrCreateInstallationKey(installationDir)
 	if err != nil {
-		return fmt.Errorf("failed to encrypt AES key: %v", err)
+		return nil, err
 	}
 
-	// 8. 构造请求文件
-	reqFile := RequestFile{
-		Data:      base64.StdEncoding.EncodeToString(encryptedData),
-		Key:       base64.StdEncoding.EncodeToString(encryptedKey),
-		Hash:      hex.EncodeToString(requestHash),
-		Timestamp: time.Now().Unix(),
+	// 2. 获取硬件指纹并生成请求ID
+	return &LicenseRequest{
+		HardwareID:     GetHardwareFingerprint(),
+		Timestamp:      time.Now().Unix(),
+		Version:        "1.0.0",
+		MachineInfo:    GetMachineInfo(),
+		RequestID:      generateRequestID(),
+		PublicKey:      base64.StdEncoding.EncodeToString(installationKey.PublicKey().Bytes()),
+		ActivationCode: activationCode,
+	}, nil
+}
+
+// EncodeRequest 加密请求数据并编码为req.dat内容
+// 请求数据的hash、时间戳和密钥标识作为AES-GCM附加数据，修改其中任何一项授权端都会拒绝
+func EncodeRequest(request *LicenseRequest) (string, error) {
+	plaintext, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode request data: %v", err)
+	}
+	reqFile, err := sealRequestFile(plaintext, request.Timestamp, shared.RequestFormatAEAD)
+	if err != nil {
+		return "", err
 	}
 
-	// 9. 编码为字符串并保存req.dat
+	// 编码为字符串
 	encodedString, err := EncodeToString(reqFile)
 	if err != nil {
-		return fmt.Errorf("failed to encode request file: %v", err)
+		return "", fmt.Errorf("failed to encode request file: %v", err)
 	}
+	return encodedString, nil
+}
 
-	if err := os.WriteFile(reqFilePath, []byte(encodedString), 0644); err != nil {
-		return fmt.Errorf("failed to write request file: %v", err)
+// sealRequestFile 用内置公钥加密发给授权方的数据，req.dat和停用回执共用此容器
+func sealRequestFile(plaintext []byte, timestamp int64, version string) (*RequestFile, error) {
+	// 1. 计算数据hash，即加密前JSON明文的SHA256
+	requestHash := sha256.Sum256(plaintext)
+
+	// 2. 构造文件头，时间戳与数据一致
+	reqFile := RequestFile{
+		Hash:      hex.EncodeToString(requestHash[:]),
+		Timestamp: timestamp,
+		KeyID:     GetCurrentKeyID(),
+		Version:   version,
+	}
+	additionalData, err := shared.RequestAdditionalData(&reqFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request header: %v", err)
 	}
 
-	fmt.Printf("Request file generated successfully:\n")
-	fmt.Printf("  Request ID: %s\n", requestID)
-	fmt.Printf("  Hardware ID: %s\n", hardwareID)
-	fmt.Printf("  Machine Info: %s\n", request.MachineInfo)
-	fmt.Printf("  File: %s\n", reqFilePath)
+	// 3. AES加密数据，文件头作为附加数据
+	aesKey := GenerateAESKey()
+	encryptedData, err := AESEncryptBytesWithAAD(plaintext, aesKey, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt request data: %v", err)
+	}
 
-	return nil
+	// 4. 用内置公钥加密AES密钥
+	encryptedKey, err := RSAEncrypt(aesKey, GetEmbeddedPublicKey())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt AES key: %v", err)
+	}
+
+	reqFile.Data = base64.StdEncoding.EncodeToString(encryptedData)
+	reqFile.Key = base64.StdEncoding.EncodeToString(encryptedKey)
+	return &reqFile, nil
 }
 
 // generateRequestID 生成请求唯一标识
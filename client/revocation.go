@@ -0,0 +1,198 @@
+package client
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lengxu/golicense/shared"
+)
+
+// embeddedRevocationList 构建时内置的吊销列表(revoked.dat内容)，为空表示不内置
+// 可以用 -ldflags "-X github.com/lengxu/golicense/client.embeddedRevocationList=CRL:..." 设置
+var embeddedRevocationList = ""
+
+var (
+	revocationMu        sync.RWMutex
+	installedRevocation *RevocationList
+	embeddedOnce        sync.Once
+	embeddedRevocation  *RevocationList
+	embeddedErr         error
+)
+
+// LicenseRevokedError 授权已被吊销
+type LicenseRevokedError struct {
+	SerialNumber string // 被吊销的授权序列号
+	Reason       string // 吊销原因
+	RevokedAt    int64  // 吊销时间
+}
+
+// Error 实现error接口
+func (e *LicenseRevokedError) Error() string {
+	msg := fmt.Sprintf("license %s was revoked on %s", e.SerialNumber, time.Unix(e.RevokedAt, 0).Format("2006-01-02"))
+	if e.Reason != "" {
+		msg += " (" + e.Reason + ")"
+	}
+	return msg
+}
+
+// ParseRevocationList 解码吊销列表并用受信任公钥验证签名
+func ParseRevocationList(encoded string) (*RevocationList, error) {
+	var file SignedRevocationList
+	if err := DecodeFromString(strings.TrimSpace(encoded), &file); err != nil {
+		return nil, fmt.Errorf("failed to decode revocation list: %v", err)
+	}
+	if file.Version != shared.RevocationFormat {
+		return nil, fmt.Errorf("unsupported revocation list format: %s", file.Version)
+	}
+	if file.KeyID == "" {
+		return nil, errors.New("revocation list has no key ID")
+	}
+
+	publicKeys, err := trustedPublicKeys(file.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("revocation list was signed by untrusted key %s", file.KeyID)
+	}
+	signature, err := base64.StdEncoding.DecodeString(file.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode revocation list signature: %v", err)
+	}
+	signingInput, err := shared.RevocationSigningInput(&file)
+	if err != nil {
+		return nil, err
+	}
+	if !verifyWithAny(publicKeys, func(pub crypto.PublicKey) bool {
+		return VerifySignature(file.Algorithm, signingInput, signature, pub)
+	}) {
+		return nil, errors.New("revocation list signature verification failed")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(file.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode revocation list data: %v", err)
+	}
+	var list RevocationList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse revocation list: %v", err)
+	}
+	return &list, nil
+}
+
+// LoadRevocationList 读取并验证吊销列表文件
+func LoadRevocationList(path string) (*RevocationList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read revocation list: %v", err)
+	}
+	return ParseRevocationList(string(data))
+}
+
+// SetRevocationList 设置程序内置的吊销列表(revoked.dat内容，如通过go:embed嵌入)
+// 与授权文件目录下的revoked.dat同时生效；传入空字符串清除
+func SetRevocationList(encoded string) error {
+	var list *RevocationList
+	if encoded != "" {
+		var err error
+		if list, err = ParseRevocationList(encoded); err != nil {
+			return err
+		}
+	}
+
+	revocationMu.Lock()
+	defer revocationMu.Unlock()
+	installedRevocation = list
+	return nil
+}
+
+// checkRevocation 检查授权是否已被吊销
+// 依次检查程序设置的列表、构建时内置的列表、授权文件目录下的revoked.dat和本机缓存的最新列表；
+// revoked.dat存在但签名无效时拒绝授权，防止用伪造的文件掩盖吊销；
+// 吊销记录绑定到具体的授权文件，之后为本机重新签发的授权不受影响
+func checkRevocation(license *License, licenseFile *LicenseFile, licensePath string) error {
+	lists, err := revocationLists(licensePath)
+	if err != nil {
+		return err
+	}
+	licenseID := shared.LicenseFileID(license, licenseFile)
+	for _, list := range lists {
+		if entry, ok := list.Find(license.SerialNumber, licenseID); ok {
+			return &LicenseRevokedError{
+				SerialNumber: entry.SerialNumber,
+				Reason:       entry.Reason,
+				RevokedAt:    entry.RevokedAt,
+			}
+		}
+	}
+	return nil
+}
+
+// revocationLists 收集当前生效的全部吊销列表
+func revocationLists(licensePath string) ([]*RevocationList, error) {
+	var lists []*RevocationList
+
+	revocationMu.RLock()
+	if installedRevocation != nil {
+		lists = append(lists, installedRevocation)
+	}
+	revocationMu.RUnlock()
+
+	embeddedOnce.Do(func() {
+		if embeddedRevocationList != "" {
+			embeddedRevocation, embeddedErr = ParseRevocationList(embeddedRevocationList)
+		}
+	})
+	if embeddedErr != nil {
+		return nil, fmt.Errorf("embedded revocation list is invalid: %v", embeddedErr)
+	}
+	if embeddedRevocation != nil {
+		lists = append(lists, embeddedRevocation)
+	}
+
+	cachePath := revocationCachePath()
+	var cached *RevocationList
+	if cachePath != "" {
+		// 缓存只是防止回退的副本，损坏时忽略
+		cached, _ = LoadRevocationList(cachePath)
+		if cached != nil {
+			lists = append(lists, cached)
+		}
+	}
+
+	localPath := filepath.Join(filepath.Dir(licensePath), shared.RevocationListFile)
+	data, err := os.ReadFile(localPath)
+	if os.IsNotExist(err) {
+		return lists, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read revocation list: %v", err)
+	}
+	local, err := ParseRevocationList(string(data))
+	if err != nil {
+		return nil, err
+	}
+	lists = append(lists, local)
+
+	// 保存更新的列表，之后删除或换回旧的revoked.dat也不会恢复已吊销的授权
+	if cachePath != "" && (cached == nil || local.Sequence > cached.Sequence) {
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0700); err == nil {
+			os.WriteFile(cachePath, data, 0600)
+		}
+	}
+	return lists, nil
+}
+
+// revocationCachePath 本机缓存的最新吊销列表路径
+func revocationCachePath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "golicense", shared.RevocationListFile)
+}
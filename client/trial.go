@@ -0,0 +1,185 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// trialClockSkew 允许的时钟误差，超过则认为系统时间被回拨
+const trialClockSkew = 3600
+
+// trialState 试用状态记录，首次运行时写入，用于计算试用期并保证每台机器只能试用一次
+type trialState struct {
+	Fingerprint string `json:"fingerprint"`  // 机器指纹hash
+	Serial      string `json:"serial"`       // 已使用的试用授权序列号
+	StartedAt   int64  `json:"started_at"`   // 首次运行时间
+	LastSeenAt  int64  `json:"last_seen_at"` // 最近一次运行时间，用于检测时钟回拨
+	MAC         string `json:"mac"`          // 防篡改校验值
+}
+
+// checkTrialLicense 检查试用授权并返回按首次运行时间计算有效期后的授权数据
+func checkTrialLicense(license *License, licensePath string, hardwareID string) (*License, error) {
+	if license.TrialDays <= 0 || license.TrialDays > MaxTrialDays {
+		return nil, fmt.Errorf("invalid trial duration: %d days", license.TrialDays)
+	}
+
+	now := time.Now().Unix()
+	if now < license.IssuedAt {
+		return nil, errors.New("license not yet valid")
+	}
+	if now > license.ExpiresAt {
+		return nil, fmt.Errorf("trial license expired on %s", time.Unix(license.ExpiresAt, 0).Format("2006-01-02 15:04:05"))
+	}
+
+	paths := trialStatePaths(licensePath, hardwareID)
+	state, err := loadTrialState(paths, hardwareID)
+	if err != nil {
+		return nil, err
+	}
+
+	if state == nil {
+		// 首次运行，开始计算试用期
+		state = &trialState{
+			Fingerprint: trialFingerprint(hardwareID),
+			Serial:      license.SerialNumber,
+			StartedAt:   now,
+			LastSeenAt:  now,
+		}
+	} else {
+		if state.Serial != license.SerialNumber {
+			return nil, errors.New("a trial has already been used on this machine")
+		}
+		if now+trialClockSkew < state.LastSeenAt {
+			return nil, errors.New("system clock has been rolled back")
+		}
+		if now > state.LastSeenAt {
+			state.LastSeenAt = now
+		}
+	}
+
+	// 试用期不能超过试用授权本身的有效期
+	trialEnd := state.StartedAt + int64(license.TrialDays)*86400
+	if trialEnd > license.ExpiresAt {
+		trialEnd = license.ExpiresAt
+	}
+	if now > trialEnd {
+		return nil, fmt.Errorf("trial period ended on %s", time.Unix(trialEnd, 0).Format("2006-01-02 15:04:05"))
+	}
+
+	if err := saveTrialState(paths, state, hardwareID); err != nil {
+		return nil, err
+	}
+
+	effective := *license
+	effective.ExpiresAt = trialEnd
+	return &effective, nil
+}
+
+// trialStatePaths 试用状态的保存位置：授权文件目录、用户配置目录和本机共享目录各保存一份
+// 本机共享目录中的文件名由硬件指纹派生，同一台机器上的其他用户和其他安装目录共用这份记录
+func trialStatePaths(licensePath string, hardwareID string) []string {
+	paths := []string{filepath.Join(filepath.Dir(licensePath), ".trial.state")}
+	if configDir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(configDir, "golicense", "trial.state"))
+	}
+	if machineDir := machineStateDir(); machineDir != "" {
+		paths = append(paths, filepath.Join(machineDir, ".golicense-"+trialFingerprint(hardwareID)[:16]))
+	}
+	return paths
+}
+
+// machineStateDir 本机所有用户都可以写入、重启后保留的目录
+func machineStateDir() string {
+	switch runtime.GOOS {
+	case "windows":
+		return os.Getenv("ProgramData")
+	case "darwin":
+		return "/Users/Shared"
+	default:
+		return "/var/tmp"
+	}
+}
+
+// loadTrialState 读取试用状态，任何一份记录被篡改都视为无效
+// 存在多份记录时以最早开始的记录为准
+func loadTrialState(paths []string, hardwareID string) (*trialState, error) {
+	var result *trialState
+	var lastSeenAt int64
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trial state: %v", err)
+		}
+
+		var state trialState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, errors.New("trial state has been tampered with")
+		}
+		if state.Fingerprint != trialFingerprint(hardwareID) || state.MAC != trialStateMAC(&state, hardwareID) {
+			return nil, errors.New("trial state has been tampered with")
+		}
+
+		if state.LastSeenAt > lastSeenAt {
+			lastSeenAt = state.LastSeenAt
+		}
+		if result == nil || state.StartedAt < result.StartedAt {
+			loaded := state
+			result = &loaded
+		}
+	}
+
+	if result != nil {
+		result.LastSeenAt = lastSeenAt
+	}
+	return result, nil
+}
+
+// saveTrialState 保存试用状态，至少需要成功写入一份
+func saveTrialState(paths []string, state *trialState, hardwareID string) error {
+	state.MAC = trialStateMAC(state, hardwareID)
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode trial state: %v", err)
+	}
+
+	saved := 0
+	for _, path := range paths {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			continue
+		}
+		// 本机共享目录中的记录需要其他用户可读
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			continue
+		}
+		saved++
+	}
+	if saved == 0 {
+		return errors.New("failed to record trial state")
+	}
+	return nil
+}
+
+// trialFingerprint 试用状态中记录的机器指纹
+func trialFingerprint(hardwareID string) string {
+	hash := sha256.Sum256([]byte("trial_" + hardwareID))
+	return hex.EncodeToString(hash[:])
+}
+
+// trialStateMAC 计算试用状态的校验值
+func trialStateMAC(state *trialState, hardwareID string) string {
+	key := sha256.Sum256([]byte(hardwareID + "_trial_state_key_2024"))
+	mac := hmac.New(sha256.New, key[:])
+	fmt.Fprintf(mac, "%s|%s|%d|%d", state.Fingerprint, state.Serial, state.StartedAt, state.LastSeenAt)
+	return hex.EncodeToString(mac.Sum(nil))
+}
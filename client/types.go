@@ -7,9 +7,21 @@ type LicenseRequest = shared.LicenseRequest
 type RequestFile = shared.RequestFile
 type License = shared.License
 type LicenseFile = shared.LicenseFile
+type LicenseRecipient = shared.LicenseRecipient
 type LicenseEdition = shared.LicenseEdition
 type LicenseModule = shared.LicenseModule
 type ModulePermissions = shared.ModulePermissions
+type LicenseType = shared.LicenseType
+type RevocationList = shared.RevocationList
+type RevokedLicense = shared.RevokedLicense
+type SignedRevocationList = shared.SignedRevocationList
+type ActivationCode = shared.ActivationCode
+type Lease = shared.Lease
+type SignedLease = shared.SignedLease
+type LeasePoolStatus = shared.LeasePoolStatus
+type LeaseSummary = shared.LeaseSummary
+type RenewalChallenge = shared.RenewalChallenge
+type DeactivationReceipt = shared.DeactivationReceipt
 
 // 常量也从shared包导入
 const (
@@ -20,8 +32,19 @@ const (
 	ModuleVulnerabilityScan = shared.ModuleVulnerabilityScan
 	ModulePasswordAudit     = shared.ModulePasswordAudit
 	ModuleCameraScan        = shared.ModuleCameraScan
+
+	LicenseTypeStandard = shared.LicenseTypeStandard
+	LicenseTypeAddon    = shared.LicenseTypeAddon
+	LicenseTypeTrial    = shared.LicenseTypeTrial
+	LicenseTypeFloating = shared.LicenseTypeFloating
+
+	MaxTrialDays = shared.MaxTrialDays
+
+	AddonFilePattern = shared.AddonFilePattern
 )
 
 // 导入shared包中的函数
 var GetDefaultModulePermissions = shared.GetDefaultModulePermissions
-var GetModulesForEdition = shared.GetModulesForEdition
\ No newline at end of file
+var GetModulesForEdition = shared.GetModulesForEdition
+var GetDefaultModulePermission = shared.GetDefaultModulePermission
+var ParseLicenseModule = shared.ParseLicenseModule
\ No newline at end of file
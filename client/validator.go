@@ -1,122 +1,408 @@
 package client
 
 import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sync"
 	"time"
+
+	"github.com/lengxu/golicense/shared"
 )
 
-// ValidateLicense 验证授权文件
-func ValidateLicense(licenseFilePath string) error {
-	// 1. 检查license.dat是否存在
-	if _, err := os.Stat(licenseFilePath); os.IsNotExist(err) {
-		return errors.New("license file not found")
+var (
+	minFormatMu      sync.RWMutex
+	minFormatVersion string
+)
+
+// SetMinFormatVersion 设置接受的最低授权文件格式版本，防止被替换为旧格式的授权文件
+// 例如设置为 shared.LicenseFormatEnvelope 后只接受信封签名的授权；为空表示接受所有版本
+func SetMinFormatVersion(version string) {
+	minFormatMu.Lock()
+	defer minFormatMu.Unlock()
+	minFormatVersion = version
+}
+
+// checkFormatVersion 检查授权文件格式版本是否满足最低要求
+func checkFormatVersion(version string) error {
+	minFormatMu.RLock()
+	defer minFormatMu.RUnlock()
+	if minFormatVersion != "" && shared.CompareFormatVersion(version, minFormatVersion) < 0 {
+		return fmt.Errorf("license format %s is older than the minimum accepted format %s", version, minFormatVersion)
 	}
+	return nil
+}
 
-	// 2. 读取license.dat
-	licenseData, err := os.ReadFile(licenseFilePath)
+// ValidateLicense 验证授权文件
+func ValidateLicense(licenseFilePath string) error {
+	license, err := validateLicenseFile(licenseFilePath)
 	if err != nil {
-		return fmt.Errorf("failed to read license file: %v", err)
+		return err
 	}
 
-	var licenseFile LicenseFile
-	if err := DecodeFromString(string(licenseData), &licenseFile); err != nil {
-		return fmt.Errorf("failed to decode license file: %v", err)
+	// 增购授权不能单独作为基础授权使用
+	if license.IsAddon() {
+		return errors.New("add-on license cannot be used as a base license")
 	}
 
-	// 3. 获取当前硬件指纹
-	currentHW := GetHardwareFingerprint()
+	return nil
+}
 
-	// 4. 用硬件指纹派生的密钥解密授权数据
-	licenseKey := DeriveKeyFromHardware(currentHW)
-	
-	// 验证密钥hash
-	keyHashArray := sha256.Sum256(licenseKey)
-	expectedKeyHash := hex.EncodeToString(keyHashArray[:])
-	if licenseFile.Key != expectedKeyHash {
-		return errors.New("license key mismatch - hardware fingerprint changed")
+// validateLicenseFile 验证授权文件并返回解密后的授权数据
+// 浮动授权只能由租约服务器使用，本机不能直接凭浮动授权运行
+func validateLicenseFile(licenseFilePath string) (*License, error) {
+	license, _, _, err := openLicenseFile(licenseFilePath)
+	if err != nil {
+		return nil, err
+	}
+	if license.IsFloating() {
+		return nil, errors.New("floating license can only be used through a lease server")
 	}
+	return license, nil
+}
 
-	// 5. 解密授权数据
-	encryptedData, err := base64.StdEncoding.DecodeString(licenseFile.Data)
+// openLicenseFile 验证授权文件，返回解密后的授权数据、授权文件和解密后的载荷
+// 授权目录下有适用的离线续期码时，返回的授权到期时间为续期后的时间
+func openLicenseFile(licenseFilePath string) (*License, *LicenseFile, []byte, error) {
+	// 1-5. 读取、解密并验证签名
+	license, licenseFile, payload, currentHW, err := readVerifiedLicense(licenseFilePath)
 	if err != nil {
-		return fmt.Errorf("failed to decode license data: %v", err)
+		return nil, nil, nil, err
 	}
 
-	var license License
-	if err := AESDecrypt(encryptedData, licenseKey, &license); err != nil {
-		return fmt.Errorf("failed to decrypt license data: %v", err)
+	// 6. 检查吊销列表
+	if err := checkRevocation(license, licenseFile, licenseFilePath); err != nil {
+		return nil, nil, nil, err
 	}
 
-	// 6. 验证硬件指纹绑定
-	if license.HardwareID != currentHW {
-		return errors.New("hardware fingerprint mismatch")
+	// 7. 试用授权不绑定硬件，按首次运行时间计算有效期
+	if license.IsTrial() {
+		license, err := checkTrialLicense(license, licenseFilePath, currentHW)
+		return license, licenseFile, payload, err
 	}
 
-	// 7. 验证时间
+	// 8. 验证硬件指纹绑定
+	if !license.IsBoundTo(currentHW) {
+		return nil, nil, nil, errors.New("hardware fingerprint mismatch")
+	}
+	if license.MaxSeats > 0 && len(license.HardwareIDs) > license.MaxSeats {
+		return nil, nil, nil, errors.New("site license exceeds its seat cap")
+	}
+
+	// 9. 应用离线续期码，再验证时间
+	applyRenewal(license, filepath.Dir(licenseFilePath))
 	now := time.Now().Unix()
 	if now < license.IssuedAt {
-		return errors.New("license not yet valid")
+		return nil, nil, nil, errors.New("license not yet valid")
 	}
 	if now > license.ExpiresAt {
-		return fmt.Errorf("license expired on %s", time.Unix(license.ExpiresAt, 0).Format("2006-01-02 15:04:05"))
+		return nil, nil, nil, fmt.Errorf("license expired on %s", time.Unix(license.ExpiresAt, 0).Format("2006-01-02 15:04:05"))
 	}
 
-	// 8. 验证RSA签名
-	signature, err := base64.StdEncoding.DecodeString(licenseFile.Signature)
+	return license, licenseFile, payload, nil
+}
+
+// readVerifiedLicense 读取license.dat，用本机硬件指纹或安装密钥解密并验证签名，不检查绑定和有效期
+// 同时返回当前硬件指纹
+func readVerifiedLicense(licenseFilePath string) (*License, *LicenseFile, []byte, string, error) {
+	// 1. 检查license.dat是否存在
+	if _, err := os.Stat(licenseFilePath); os.IsNotExist(err) {
+		return nil, nil, nil, "", errors.New("license file not found")
+	}
+
+	// 2. 读取license.dat
+	licenseFile, err := readLicenseFile(licenseFilePath)
 	if err != nil {
-		return fmt.Errorf("failed to decode signature: %v", err)
+		return nil, nil, nil, "", err
 	}
 
-	publicKey := GetEmbeddedPublicKey()
-	if !RSAVerify(license, signature, publicKey) {
-		return errors.New("invalid license signature")
+	if err := checkFormatVersion(licenseFile.Version); err != nil {
+		return nil, nil, nil, "", err
 	}
 
-	return nil
-}
+	// 3. 获取当前硬件指纹
+	currentHW := GetHardwareFingerprint()
 
-// GetLicenseInfo 获取授权信息
-func GetLicenseInfo(licenseFilePath string) (*License, error) {
-	// 先验证授权
-	if err := ValidateLicense(licenseFilePath); err != nil {
-		return nil, err
+	// 4. 用硬件指纹派生的密钥解密授权载荷
+	payload, binding, err := decryptLicensePayload(licenseFile, currentHW, filepath.Dir(licenseFilePath))
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
+
+	// 5. 验证签名并解析授权数据
+	license, err := verifyLicensePayload(licenseFile, binding, payload)
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
+
+	// 已停用迁移的授权即使恢复了备份也不能再使用
+	if err := checkDeactivated(license, licenseFile); err != nil {
+		return nil, nil, nil, "", err
 	}
+	return license, licenseFile, payload, currentHW, nil
+}
 
-	// 读取并解密授权信息
+// readLicenseFile 读取并解码license.dat
+func readLicenseFile(licenseFilePath string) (*LicenseFile, error) {
 	licenseData, err := os.ReadFile(licenseFilePath)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to read license file: %v", err)
 	}
 
 	var licenseFile LicenseFile
 	if err := DecodeFromString(string(licenseData), &licenseFile); err != nil {
+		return nil, fmt.Errorf("failed to decode license file: %v", err)
+	}
+
+	return &licenseFile, nil
+}
+
+// verifyLicensePayload 验证签名并解析授权数据
+// 4.0格式的签名覆盖信封头和载荷；3.0格式先验证签发时的载荷字节再反序列化；
+// 2.0格式的签名覆盖重新序列化的License结构体
+func verifyLicensePayload(licenseFile *LicenseFile, binding string, payload []byte) (*License, error) {
+	signature, err := base64.StdEncoding.DecodeString(licenseFile.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode signature: %v", err)
+	}
+	// 签名只有一种合法编码，防止重新编码签名字段（换行、填充位）得到不同的授权文件
+	if base64.StdEncoding.EncodeToString(signature) != licenseFile.Signature {
+		return nil, errors.New("license signature is not canonically encoded")
+	}
+
+	publicKeys, err := trustedPublicKeys(licenseFile.KeyID)
+	if err != nil {
 		return nil, err
 	}
+	var license License
 
-	currentHW := GetHardwareFingerprint()
-	licenseKey := DeriveKeyFromHardware(currentHW)
+	if shared.IsEnvelopeFormat(licenseFile.Version) {
+		if licenseFile.KeyID == "" {
+			return nil, errors.New("license envelope has no key ID")
+		}
+		signingInput, err := shared.LicenseSigningInput(shared.BuildLicenseHeader(licenseFile, binding, payload))
+		if err != nil {
+			return nil, fmt.Errorf("failed to build license header: %v", err)
+		}
+		if !verifyWithAny(publicKeys, func(publicKey crypto.PublicKey) bool {
+			return VerifySignature(licenseFile.Algorithm, signingInput, signature, publicKey)
+		}) {
+			return nil, errors.New("invalid license signature")
+		}
+		if err := shared.UnmarshalLicense(payload, &license); err != nil {
+			return nil, fmt.Errorf("failed to parse license data: %v", err)
+		}
+		if shared.LicenseBinding(&license) != binding {
+			return nil, errors.New("license binding does not match its envelope")
+		}
+		return &license, nil
+	}
+
+	if shared.IsCanonicalFormat(licenseFile.Version) {
+		if !verifyWithAny(publicKeys, func(publicKey crypto.PublicKey) bool {
+			return VerifySignature(licenseFile.Algorithm, payload, signature, publicKey)
+		}) {
+			return nil, errors.New("invalid license signature")
+		}
+		if err := shared.UnmarshalLicense(payload, &license); err != nil {
+			return nil, fmt.Errorf("failed to parse license data: %v", err)
+		}
+		return &license, nil
+	}
+
+	if err := json.Unmarshal(payload, &license); err != nil {
+		return nil, fmt.Errorf("failed to parse license data: %v", err)
+	}
+	// 旧格式只有RSA签名
+	if !verifyWithAny(publicKeys, func(publicKey crypto.PublicKey) bool {
+		rsaKey, ok := publicKey.(*rsa.PublicKey)
+		return ok && RSAVerify(license, signature, rsaKey)
+	}) {
+		return nil, errors.New("invalid license signature")
+	}
+	return &license, nil
+}
+
+// verifyWithAny 任一公钥验证通过即可
+func verifyWithAny(publicKeys []crypto.PublicKey, verify func(crypto.PublicKey) bool) bool {
+	for _, publicKey := range publicKeys {
+		if verify(publicKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// decryptLicensePayload 解密授权载荷，同时返回信封的绑定方式
+// 内容密钥可能用硬件指纹派生的密钥或license.dat所在目录的安装密钥加密
+func decryptLicensePayload(licenseFile *LicenseFile, hardwareID string, licenseDir string) ([]byte, string, error) {
+	var licenseKey []byte
+	var binding string
+	var err error
+
+	switch licenseFile.KDF {
+	case shared.KDFHKDFSHA256:
+		licenseKey, binding, err = deriveHKDFLicenseKey(licenseFile, hardwareID, licenseDir)
+	case shared.KDFLegacy:
+		licenseKey, binding, err = deriveLegacyLicenseKey(licenseFile, hardwareID, licenseDir)
+	default:
+		return nil, "", fmt.Errorf("unsupported license key derivation: %s", licenseFile.KDF)
+	}
+	if err != nil {
+		return nil, "", err
+	}
 
 	encryptedData, err := base64.StdEncoding.DecodeString(licenseFile.Data)
 	if err != nil {
-		return nil, err
+		return nil, "", fmt.Errorf("failed to decode license data: %v", err)
 	}
 
-	var license License
-	if err := AESDecrypt(encryptedData, licenseKey, &license); err != nil {
+	payload, err := AESDecryptBytes(encryptedData, licenseKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decrypt license data: %v", err)
+	}
+
+	if licenseFile.Binding != "" {
+		binding = licenseFile.Binding
+	}
+	return payload, binding, nil
+}
+
+// deriveHKDFLicenseKey 用HKDF和授权文件中的salt派生解密密钥
+func deriveHKDFLicenseKey(licenseFile *LicenseFile, hardwareID string, licenseDir string) ([]byte, string, error) {
+	salt, err := base64.StdEncoding.DecodeString(licenseFile.Salt)
+	if err != nil || len(salt) == 0 {
+		return nil, "", errors.New("invalid license key salt")
+	}
+
+	licenseKey, keyCheck := shared.DeriveLicenseKey([]byte(hardwareID), salt)
+
+	// 多机授权：先用派生密钥解出内容密钥
+	if len(licenseFile.Recipients) > 0 {
+		contentKey, err := unwrapContentKey(licenseFile.Recipients, keyCheck, licenseKey, licenseDir)
+		if err != nil {
+			return nil, "", err
+		}
+		return contentKey, shared.BindingSite, nil
+	}
+	if hmac.Equal([]byte(licenseFile.Key), []byte(keyCheck)) {
+		return licenseKey, shared.BindingHardware, nil
+	}
+
+	// 试用授权使用固定的试用密钥材料
+	trialKey, trialCheck := shared.DeriveLicenseKey(DeriveTrialKey(), salt)
+	if hmac.Equal([]byte(licenseFile.Key), []byte(trialCheck)) {
+		return trialKey, shared.BindingTrial, nil
+	}
+	return nil, "", errors.New("license key mismatch - hardware fingerprint changed")
+}
+
+// deriveLegacyLicenseKey 旧授权：密钥为sha256(硬件指纹 + 固定salt)，校验值为密钥的SHA256
+func deriveLegacyLicenseKey(licenseFile *LicenseFile, hardwareID string, licenseDir string) ([]byte, string, error) {
+	licenseKey := DeriveKeyFromHardware(hardwareID)
+
+	// 计算密钥hash
+	keyHashArray := sha256.Sum256(licenseKey)
+	expectedKeyHash := hex.EncodeToString(keyHashArray[:])
+
+	// 多机授权：先用派生密钥解出内容密钥
+	if len(licenseFile.Recipients) > 0 {
+		contentKey, err := unwrapContentKey(licenseFile.Recipients, expectedKeyHash, licenseKey, licenseDir)
+		if err != nil {
+			return nil, "", err
+		}
+		return contentKey, shared.BindingSite, nil
+	}
+	if licenseFile.Key == expectedKeyHash {
+		return licenseKey, shared.BindingHardware, nil
+	}
+
+	// 试用授权使用固定的试用密钥
+	trialKey := DeriveTrialKey()
+	trialKeyHash := sha256.Sum256(trialKey)
+	if licenseFile.Key != hex.EncodeToString(trialKeyHash[:]) {
+		return nil, "", errors.New("license key mismatch - hardware fingerprint changed")
+	}
+	return trialKey, shared.BindingTrial, nil
+}
+
+// unwrapContentKey 从接收方列表中找到本机并解出内容密钥
+// 硬件接收方按派生密钥校验值匹配，X25519接收方按本安装的公钥标识匹配
+func unwrapContentKey(recipients []LicenseRecipient, recipientID string, recipientKey []byte, licenseDir string) ([]byte, error) {
+	var installationKey *ecdh.PrivateKey
+	var installationErr error
+	installationLoaded := false
+	installationMismatch := false
+
+	for _, recipient := range recipients {
+		switch recipient.Type {
+		case shared.RecipientTypeHardware:
+			if recipient.ID != recipientID {
+				continue
+			}
+			wrappedKey, err := base64.StdEncoding.DecodeString(recipient.Key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode content key: %v", err)
+			}
+			var contentKey []byte
+			if err := AESDecrypt(wrappedKey, recipientKey, &contentKey); err != nil {
+				return nil, fmt.Errorf("failed to decrypt content key: %v", err)
+			}
+			return contentKey, nil
+		case shared.RecipientTypeX25519:
+			if !installationLoaded {
+				installationKey, installationErr = LoadInstallationKey(licenseDir)
+				installationLoaded = true
+			}
+			if installationErr != nil {
+				continue
+			}
+			if recipient.ID != shared.InstallationKeyID(installationKey.PublicKey().Bytes()) {
+				installationMismatch = true
+				continue
+			}
+			return unwrapInstallationKey(recipient, installationKey)
+		}
+	}
+
+	if installationLoaded && installationErr != nil {
+		if os.IsNotExist(installationErr) {
+			return nil, errors.New("license is encrypted to an installation key that is not present next to the license file")
+		}
+		return nil, installationErr
+	}
+	if installationMismatch {
+		return nil, errors.New("license was issued to a different installation key")
+	}
+	return nil, errors.New("license key mismatch - this machine is not included in the license")
+}
+
+// GetLicenseInfo 获取授权信息
+func GetLicenseInfo(licenseFilePath string) (*License, error) {
+	license, err := validateLicenseFile(licenseFilePath)
+	if err != nil {
 		return nil, err
 	}
 
-	return &license, nil
+	if license.IsAddon() {
+		return nil, errors.New("add-on license cannot be used as a base license")
+	}
+
+	return license, nil
 }
 
 // CheckLicenseModule 检查模块授权（兼容旧版本）
 func CheckLicenseModule(licensePath string, module string) error {
-	license, err := GetLicenseInfo(licensePath)
+	license, err := GetEffectiveLicense(licensePath)
 	if err != nil {
 		return err
 	}
@@ -143,7 +429,7 @@ func CheckLicenseModule(licensePath string, module string) error {
 
 // CheckModulePermission 检查模块的详细权限
 func CheckModulePermission(licensePath string, module LicenseModule) (*ModulePermissions, error) {
-	license, err := GetLicenseInfo(licensePath)
+	license, err := GetEffectiveLicense(licensePath)
 	if err != nil {
 		return nil, err
 	}
@@ -213,7 +499,7 @@ func CheckAppModulePermission(licensePath string, appName string) error {
 
 // GetAvailableModules 获取可用的模块列表
 func GetAvailableModules(licensePath string) ([]LicenseModule, error) {
-	license, err := GetLicenseInfo(licensePath)
+	license, err := GetEffectiveLicense(licensePath)
 	if err != nil {
 		return nil, err
 	}
@@ -23,7 +23,7 @@ func main() {
 
 	// 3. 显示密钥派生结果
 	key := client.DeriveKeyFromHardware(hwID)
-	fmt.Printf("✓ 派生密钥 (完整32字节):\n  %s\n\n", hex.EncodeToString(key))
+	fmt.Printf("✓ 旧格式派生密钥 (完整32字节，新授权使用HKDF和随机salt):\n  %s\n\n", hex.EncodeToString(key))
 
 	// 4. 检查license.dat文件
 	exePath, _ := os.Executable()
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/lengxu/golicense/server"
+	"github.com/lengxu/golicense/shared"
+)
+
+func main() {
+	var (
+		alg      = flag.String("alg", server.KeyAlgorithmRSA, "密钥算法 (rsa|ed25519|ecdsa)")
+		bits     = flag.Int("bits", server.DefaultKeyBits, "RSA密钥长度")
+		output   = flag.String("o", "signing_key.pem", "输出的私钥PEM文件路径")
+		pubOut   = flag.String("pub", "", "输出的公钥PEM文件路径 (默认为私钥文件名加 .pub)")
+		passEnv  = flag.String("pass-env", "", "从指定环境变量读取私钥密码，输出加密的PKCS#8")
+		passFile = flag.String("pass-file", "", "从文件读取私钥密码，输出加密的PKCS#8")
+		force    = flag.Bool("f", false, "覆盖已存在的文件")
+		help     = flag.Bool("h", false, "显示帮助信息")
+	)
+	flag.Parse()
+
+	if *help {
+		fmt.Println("keygen - 签名密钥生成工具")
+		fmt.Println()
+		fmt.Println("用法:")
+		fmt.Println("  keygen [选项]")
+		fmt.Println()
+		fmt.Println("选项:")
+		fmt.Println("  -alg string")
+		fmt.Println("        密钥算法 rsa|ed25519|ecdsa(P-256) (默认 \"rsa\")")
+		fmt.Println("        Ed25519/ECDSA签名更短、验证更快，但req.dat仍需RSA密钥加密")
+		fmt.Println("  -bits int")
+		fmt.Printf("        RSA密钥长度，仅对rsa有效 (默认 %d)\n", server.DefaultKeyBits)
+		fmt.Println("  -o string")
+		fmt.Println("        输出的私钥PEM文件路径 (默认 \"signing_key.pem\")")
+		fmt.Println("  -pub string")
+		fmt.Println("        输出的公钥PEM文件路径 (默认为私钥文件名加 .pub)")
+		fmt.Println("  -pass-env string")
+		fmt.Println("        从指定环境变量读取私钥密码，输出密码保护的PKCS#8")
+		fmt.Println("  -pass-file string")
+		fmt.Println("        从文件读取私钥密码，输出密码保护的PKCS#8")
+		fmt.Println("  -f    覆盖已存在的文件")
+		fmt.Println("  -h    显示帮助信息")
+		fmt.Println()
+		fmt.Println("密钥轮换:")
+		fmt.Println("  1. 用 keygen 生成新密钥，妥善保存私钥")
+		fmt.Println("  2. 把 client/keys.go 中原来的 embeddedPublicKey 移到 retiredPublicKeys，")
+		fmt.Println("     再把 embeddedPublicKey 替换为新公钥，发布新版本客户端")
+		fmt.Println("  3. licgen 用 -key 指定新私钥签名；旧客户端生成的req.dat用 -retired-key 指定旧私钥解密")
+		fmt.Println("  Ed25519/ECDSA签名公钥放入 signingPublicKeys，licgen 另用 -req-key 指定解密req.dat的RSA私钥")
+		fmt.Println("  4. 旧私钥泄露时，客户换发新授权后从 retiredPublicKeys 中删除旧公钥")
+		return
+	}
+
+	publicPath := *pubOut
+	if publicPath == "" {
+		publicPath = strings.TrimSuffix(*output, ".pem") + ".pub"
+	}
+
+	if !*force {
+		for _, path := range []string{*output, publicPath} {
+			if _, err := os.Stat(path); err == nil {
+				log.Fatalf("文件已存在: %s (使用 -f 覆盖)", path)
+			}
+		}
+	}
+
+	password := ""
+	if *passEnv != "" {
+		password = os.Getenv(*passEnv)
+		if password == "" {
+			log.Fatalf("环境变量 %s 未设置", *passEnv)
+		}
+	}
+	if *passFile != "" {
+		data, err := os.ReadFile(*passFile)
+		if err != nil {
+			log.Fatal("读取密码文件失败:", err)
+		}
+		password = strings.TrimRight(string(data), "\r\n")
+	}
+
+	if *alg == server.KeyAlgorithmRSA {
+		fmt.Printf("正在生成 %d 位RSA密钥...\n", *bits)
+	} else {
+		fmt.Printf("正在生成 %s 密钥...\n", *alg)
+	}
+	key, err := server.GenerateSigningKey(*alg, *bits)
+	if err != nil {
+		log.Fatal("生成密钥失败:", err)
+	}
+
+	privatePEM, err := server.MarshalPrivateKeyPEM(key, password)
+	if err != nil {
+		log.Fatal("编码私钥失败:", err)
+	}
+	publicPEM, err := server.MarshalPublicKeyPEM(key.Public())
+	if err != nil {
+		log.Fatal("编码公钥失败:", err)
+	}
+	keyID, err := shared.KeyID(key.Public())
+	if err != nil {
+		log.Fatal("计算密钥标识失败:", err)
+	}
+
+	if err := os.WriteFile(*output, privatePEM, 0600); err != nil {
+		log.Fatal("保存私钥失败:", err)
+	}
+	if err := os.WriteFile(publicPath, publicPEM, 0644); err != nil {
+		log.Fatal("保存公钥失败:", err)
+	}
+
+	fmt.Println()
+	fmt.Printf("✓ 密钥标识: %s\n", keyID)
+	if password != "" {
+		fmt.Printf("✓ 私钥(密码保护): %s\n", *output)
+	} else {
+		fmt.Printf("✓ 私钥: %s\n", *output)
+	}
+	fmt.Printf("✓ 公钥: %s\n", publicPath)
+	fmt.Println()
+	if *alg == server.KeyAlgorithmRSA {
+		fmt.Println("请将公钥内容设置为 client/keys.go 中的 embeddedPublicKey，")
+		fmt.Println("并把原公钥移到 retiredPublicKeys，使轮换前签发的授权继续有效")
+	} else {
+		fmt.Println("请将公钥内容加入 client/keys.go 中的 signingPublicKeys，")
+		fmt.Println("签发时 licgen 需用 -req-key 指定与 embeddedPublicKey 对应的RSA私钥解密req.dat")
+	}
+}
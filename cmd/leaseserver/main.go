@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/lengxu/golicense/client"
+	"github.com/lengxu/golicense/shared"
+)
+
+func main() {
+	var (
+		initMode = flag.Bool("init", false, "生成租约签名密钥和申请浮动授权的req.dat")
+		license  = flag.String("license", "license.dat", "浮动授权文件，租约签名密钥和安装密钥需在同一目录")
+		addr     = flag.String("addr", ":8500", "监听地址")
+		ttl      = flag.Duration("ttl", client.DefaultLeaseTTL, "租约期限，客户端每隔三分之一期限续租")
+		tlsCert  = flag.String("tls-cert", "", "TLS证书文件，与 -tls-key 同时指定时启用HTTPS")
+		tlsKey   = flag.String("tls-key", "", "TLS私钥文件")
+		help     = flag.Bool("h", false, "显示帮助信息")
+	)
+	flag.Parse()
+
+	if *help {
+		fmt.Println("leaseserver - 浮动授权租约服务器")
+		fmt.Println()
+		fmt.Println("用法:")
+		fmt.Println("  leaseserver -init [-license license.dat]      生成req.dat，发送给授权方申请浮动授权")
+		fmt.Println("  leaseserver -license license.dat [选项]       启动租约服务器")
+		fmt.Println()
+		fmt.Println("选项:")
+		flag.PrintDefaults()
+		fmt.Println()
+		fmt.Println("接口:")
+		fmt.Printf("  POST %s   借出租约\n", shared.LeaseCheckoutPath)
+		fmt.Printf("  POST %s  续租\n", shared.LeaseHeartbeatPath)
+		fmt.Printf("  POST %s    归还租约\n", shared.LeaseReleasePath)
+		fmt.Printf("  GET  %s     查询租约池使用情况\n", shared.LeaseStatusPath)
+		return
+	}
+
+	dir := filepath.Dir(*license)
+	if *initMode {
+		reqPath := filepath.Join(dir, "req.dat")
+		if err := client.GenerateLeaseServerRequest(reqPath); err != nil {
+			log.Fatal("生成请求文件失败:", err)
+		}
+		fmt.Printf("✓ 租约签名密钥: %s\n", client.LeaseKeyPath(dir))
+		fmt.Printf("✓ 授权请求文件已生成: %s\n", reqPath)
+		fmt.Println("请将req.dat发送给授权方申请浮动授权 (licgen -floating N)，")
+		fmt.Printf("并将签发的license.dat放在 %s 目录中；请勿删除该目录下的 %s 和 %s\n", dir,
+			shared.LeaseKeyFile, shared.InstallationKeyFile)
+		return
+	}
+
+	leaseServer, err := client.NewLeaseServer(*license)
+	if err != nil {
+		log.Fatal("加载浮动授权失败:", err)
+	}
+	leaseServer.TTL = *ttl
+	leaseServer.Logger = log.New(os.Stderr, "leaseserver ", log.LstdFlags)
+
+	floating := leaseServer.License()
+	fmt.Printf("浮动授权: %s (%s)，最多 %d 个并发租约，有效期至 %s\n", floating.SerialNumber, floating.Edition,
+		floating.MaxSeats, time.Unix(floating.ExpiresAt, 0).Format("2006-01-02"))
+
+	httpServer := &http.Server{
+		Addr:              *addr,
+		Handler:           leaseServer.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(ctx)
+	}()
+
+	useTLS := *tlsCert != "" && *tlsKey != ""
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	fmt.Printf("租约服务器已启动: %s://%s\n", scheme, *addr)
+
+	if useTLS {
+		err = httpServer.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal("租约服务器异常退出:", err)
+	}
+}
@@ -5,15 +5,22 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/lengxu/golicense/client"
+	"github.com/lengxu/golicense/shared"
 )
 
 func main() {
 	var (
 		license = flag.String("l", "license.dat", "license.dat文件路径")
 		module  = flag.String("m", "", "检查特定模块授权")
+		minFmt  = flag.String("min-format", "", "接受的最低授权文件格式版本 (如 4.0)")
+		renewRq = flag.Bool("renew-request", false, "生成离线续期申请码")
+		renew   = flag.String("renew", "", "应用授权方提供的离线续期码")
+		deact   = flag.Bool("deactivate", false, "停用本机授权以迁移到新机器，生成停用回执")
+		receipt = flag.String("receipt", shared.DeactivationReceiptFile, "停用回执的输出路径")
 		help    = flag.Bool("h", false, "显示帮助信息")
 	)
 	flag.Parse()
@@ -29,12 +36,60 @@ func main() {
 		fmt.Println("        license.dat文件路径 (默认 \"license.dat\")")
 		fmt.Println("  -m string")
 		fmt.Println("        检查特定模块授权 (如: goscan, gopasswd, goweb)")
+		fmt.Println("  -min-format string")
+		fmt.Println("        接受的最低授权文件格式版本，如 4.0 只接受信封签名的授权")
+		fmt.Println("  -renew-request")
+		fmt.Println("        生成离线续期申请码，告知授权方后换取续期码 (授权已过期时也可生成)")
+		fmt.Println("  -renew string")
+		fmt.Println("        应用授权方提供的离线续期码，延长授权有效期，license.dat不变")
+		fmt.Println("  -deactivate")
+		fmt.Println("        停用本机授权以迁移到新机器：生成停用回执并删除license.dat，停用后本机不能再使用该授权")
+		fmt.Println("  -receipt string")
+		fmt.Printf("        停用回执的输出路径 (默认 \"%s\")\n", shared.DeactivationReceiptFile)
 		fmt.Println("  -h    显示帮助信息")
 		fmt.Println()
 		fmt.Println("示例:")
 		fmt.Println("  liccheck                          # 检查默认授权文件")
 		fmt.Println("  liccheck -l goweb/bin/license.dat # 检查指定授权文件")
 		fmt.Println("  liccheck -m goscan                # 检查goscan模块授权")
+		fmt.Println("  liccheck -renew-request           # 生成离线续期申请码")
+		fmt.Println("  liccheck -renew XXXXX-XXXXX-...   # 应用离线续期码")
+		fmt.Println("  liccheck -deactivate              # 停用本机授权，生成deactivation.dat")
+		return
+	}
+
+	client.SetMinFormatVersion(*minFmt)
+
+	if *renewRq {
+		challenge, err := client.GenerateRenewalChallenge(*license)
+		if err != nil {
+			log.Fatal("生成续期申请码失败:", err)
+		}
+		fmt.Println("离线续期申请码:")
+		fmt.Println()
+		fmt.Println("  " + challenge)
+		fmt.Println()
+		fmt.Println("请将申请码告知授权方，收到续期码后执行: liccheck -l", *license, "-renew <续期码>")
+		return
+	}
+	if *renew != "" {
+		renewed, err := client.ApplyRenewalToken(*license, *renew)
+		if err != nil {
+			log.Fatal("应用续期码失败:", err)
+		}
+		fmt.Printf("✓ 续期成功，授权 %s 有效期至 %s\n", renewed.SerialNumber,
+			time.Unix(renewed.ExpiresAt, 0).Format("2006-01-02 15:04:05"))
+		return
+	}
+
+	if *deact {
+		deactivated, err := client.DeactivateLicense(*license, *receipt)
+		if err != nil {
+			log.Fatal("停用授权失败:", err)
+		}
+		fmt.Printf("✓ 授权 %s 已在本机停用，license.dat已删除\n", deactivated.SerialNumber)
+		fmt.Printf("停用回执已保存到: %s\n", *receipt)
+		fmt.Println("请将停用回执和新机器生成的req.dat一起发送给授权方，换取新机器的授权")
 		return
 	}
 
@@ -81,7 +136,45 @@ func main() {
 		fmt.Printf("  剩余天数: %d 天\n", remainingDays)
 	}
 	
-	fmt.Printf("  最大扫描次数: %d\n", licenseInfo.MaxScans)
-	fmt.Printf("  授权模块: %v\n", licenseInfo.Modules)
-	fmt.Printf("  授权功能: %v\n", licenseInfo.Features)
+	fmt.Printf("  序列号: %s\n", licenseInfo.SerialNumber)
+	if licenseInfo.IsSiteLicense() {
+		fmt.Printf("  多机授权: %d 台机器", len(licenseInfo.HardwareIDs))
+		if licenseInfo.MaxSeats > 0 {
+			fmt.Printf(" (最多 %d 台)", licenseInfo.MaxSeats)
+		}
+		fmt.Println()
+	}
+
+	// 显示增购授权
+	for _, addonPath := range client.FindAddonLicenses(*license) {
+		addon, err := client.LoadAddonLicense(addonPath, licenseInfo)
+		if err != nil {
+			fmt.Printf("  ⚠️ 增购授权 %s 无效: %v\n", addonPath, err)
+			continue
+		}
+		fmt.Printf("  增购授权: %s (模块 %v, 过期时间 %s)\n", addon.SerialNumber, addon.Modules,
+			time.Unix(addon.ExpiresAt, 0).Format("2006-01-02 15:04:05"))
+	}
+
+	// 合并增购授权后的有效授权
+	effective, err := client.GetEffectiveLicense(*license)
+	if err != nil {
+		log.Fatal("获取有效授权失败:", err)
+	}
+	fmt.Printf("  最大扫描次数: %d\n", effective.MaxScans)
+	fmt.Printf("  授权模块: %v\n", effective.Modules)
+	fmt.Printf("  授权功能: %v\n", effective.Features)
+
+	// 显示自定义声明
+	if len(effective.Claims) > 0 {
+		fmt.Println("  自定义声明:")
+		keys := make([]string, 0, len(effective.Claims))
+		for key := range effective.Claims {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Printf("    %s: %v\n", key, effective.Claims[key])
+		}
+	}
 }
\ No newline at end of file
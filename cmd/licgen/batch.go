@@ -0,0 +1,384 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lengxu/golicense/server"
+	"github.com/lengxu/golicense/shared"
+)
+
+// batchColumns 批量签发清单的列，request为必需列
+var batchColumns = []string{"request", "customer", "org", "edition", "days", "modules", "output"}
+
+// batchItem 批量签发清单中的一项
+type batchItem struct {
+	Line     int      `json:"-"`                  // CSV清单中的行号，JSON清单为0
+	Request  string   `json:"request"`            // req.dat路径，相对路径相对于清单所在目录
+	Customer string   `json:"customer,omitempty"` // 客户名称
+	Org      string   `json:"org,omitempty"`      // 客户组织
+	Edition  string   `json:"edition,omitempty"`  // 授权版本，为空时使用 -edition
+	Days     int      `json:"days,omitempty"`     // 授权天数，为0时使用 -d
+	Modules  []string `json:"modules,omitempty"`  // 版本之外额外包含的模块
+	Output   string   `json:"output,omitempty"`   // 输出文件路径，为空时按序列号命名，相对路径相对于 -out-dir
+}
+
+// batchResult 批量签发的一项结果，写入汇总报告
+type batchResult struct {
+	Item         int    `json:"item"`
+	Line         int    `json:"line,omitempty"`
+	Request      string `json:"request"`
+	CustomerName string `json:"customer_name"`
+	CustomerOrg  string `json:"customer_org"`
+	Edition      string `json:"edition"`
+	SerialNumber string `json:"serial_number"`
+	ExpiresAt    string `json:"expires_at"`
+	Output       string `json:"output"`
+	Status       string `json:"status"` // ok 或 failed
+	Error        string `json:"error,omitempty"`
+}
+
+// batchReportColumns 汇总报告CSV的列
+var batchReportColumns = []string{
+	"item", "line", "request", "customer_name", "customer_org", "edition",
+	"serial_number", "expires_at", "output", "status", "error",
+}
+
+// runBatch licgen batch 子命令：按清单批量签发授权，单项失败不影响其他项
+func runBatch(args []string) {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	var keys keyOptions
+	var (
+		outDir  = fs.String("out-dir", "licenses", "授权文件输出目录")
+		report  = fs.String("report", "", "汇总报告文件，扩展名为.json时输出JSON，否则输出CSV (默认 <out-dir>/batch_report.csv)")
+		days    = fs.Int("d", 365, "清单中未指定天数时的授权有效期（天数）")
+		edition = fs.String("edition", "enterprise", "清单中未指定版本时的授权版本 (basic|enterprise)")
+		maxAge  = fs.Duration("max-req-age", defaultMaxRequestAge, "req.dat的最长有效期，0表示不限制")
+		ledger  = fs.String("ledger", server.DefaultLedgerFile, "签发记录文件，为空时不检查重复签发")
+		reissue = fs.Bool("reissue", false, "允许对已签发过授权的请求或机器重新签发")
+		issuer  = fs.String("issuer", currentUser(), "签发人，写入签发记录")
+	)
+	fs.StringVar(&keys.file, "key", "", "签名私钥PEM文件")
+	fs.StringVar(&keys.env, "key-env", "", "从指定环境变量读取签名私钥PEM内容")
+	fs.StringVar(&keys.passEnv, "key-pass-env", server.SigningKeyPasswordEnv, "保存私钥密码的环境变量")
+	fs.StringVar(&keys.passFile, "key-pass-file", "", "保存私钥密码的文件")
+	fs.StringVar(&keys.reqKey, "req-key", "", "解密req.dat的RSA私钥PEM文件，签名私钥不是RSA时必需")
+	fs.Var((*listFlag)(&keys.retired), "retired-key", "已轮换的历史私钥PEM文件，仅用于解密旧客户端的req.dat，可重复指定")
+	fs.Usage = func() {
+		fmt.Println("licgen batch - 批量签发授权")
+		fmt.Println()
+		fmt.Println("用法:")
+		fmt.Println("  licgen batch [选项] <清单.csv|清单.json>")
+		fmt.Println()
+		fmt.Println("选项:")
+		fs.PrintDefaults()
+		fmt.Println()
+		fmt.Println("清单格式:")
+		fmt.Printf("  CSV   第一行为列名，可用的列: %s，除request外均可省略\n", strings.Join(batchColumns, ", "))
+		fmt.Println("        modules列中多个模块用分号分隔，如 \"camera_scan;password_audit\"")
+		fmt.Println("  JSON  对象数组，字段与CSV列名相同，days为数字，modules为字符串数组")
+		fmt.Println()
+		fmt.Println("request的相对路径相对于清单所在目录；未指定output时授权文件按序列号命名，写入 -out-dir。")
+		fmt.Println("每一项单独签发并写入签发记录，某一项失败时继续处理其余各项，")
+		fmt.Println("全部处理完后输出汇总报告；有失败项时列出失败原因并以非0状态退出。")
+		fmt.Println()
+		fmt.Println("示例:")
+		fmt.Println("  licgen batch -key signing_key.pem rollout.csv")
+		fmt.Println("  licgen batch -key signing_key.pem -d 730 -out-dir rollout/ -report rollout/report.json rollout.json")
+		fmt.Println()
+		fmt.Println("  rollout.csv:")
+		fmt.Println("    request,customer,org,edition,days,modules")
+		fmt.Println("    reqs/site01.dat,张三,ABC公司,enterprise,365,")
+		fmt.Println("    reqs/site02.dat,张三,ABC公司,basic,180,camera_scan")
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *days <= 0 {
+		log.Fatal("授权天数必须大于0")
+	}
+	if _, ok := parseEdition(*edition); !ok {
+		log.Fatal("无效的授权版本:", *edition, "。请使用 basic 或 enterprise")
+	}
+	manifest := fs.Arg(0)
+	items, err := readBatchManifest(manifest)
+	if err != nil {
+		log.Fatal("读取批量签发清单失败:", err)
+	}
+	if len(items) == 0 {
+		log.Fatal("批量签发清单为空:", manifest)
+	}
+	if *report == "" {
+		*report = filepath.Join(*outDir, "batch_report.csv")
+	}
+
+	if err := loadSigningKey(keys, os.Stdout); err != nil {
+		log.Fatal("加载签名私钥失败:", err)
+	}
+	opts := server.LicenseOptions{
+		MaxRequestAge: *maxAge,
+		Reissue:       *reissue,
+		Issuer:        *issuer,
+	}
+	if *ledger != "" {
+		issueLedger, err := server.OpenLedger(*ledger)
+		if err != nil {
+			log.Fatal("打开签发记录失败:", err)
+		}
+		opts.Ledger = issueLedger
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		log.Fatal("创建输出目录失败:", err)
+	}
+
+	fmt.Printf("正在批量签发: %s，共 %d 项\n\n", manifest, len(items))
+	baseDir := filepath.Dir(manifest)
+	results := make([]batchResult, 0, len(items))
+	var failures []batchResult
+	for i, item := range items {
+		if item.Days == 0 {
+			item.Days = *days
+		}
+		if item.Edition == "" {
+			item.Edition = *edition
+		}
+		if item.Request != "" && !filepath.IsAbs(item.Request) {
+			item.Request = filepath.Join(baseDir, item.Request)
+		}
+
+		result := issueBatchItem(item, *outDir, opts)
+		result.Item = i + 1
+		fmt.Printf("[%d/%d] %s ", i+1, len(items), item.Request)
+		if result.Status == "ok" {
+			fmt.Printf("✓ %s -> %s\n", result.SerialNumber, result.Output)
+		} else {
+			fmt.Printf("✗ %s\n", result.Error)
+			failures = append(failures, result)
+		}
+		results = append(results, result)
+	}
+
+	if err := writeBatchReport(*report, results); err != nil {
+		log.Fatal("写入汇总报告失败:", err)
+	}
+	fmt.Printf("\n批量签发完成: 成功 %d 项，失败 %d 项\n", len(results)-len(failures), len(failures))
+	fmt.Printf("汇总报告: %s\n", *report)
+	if len(failures) > 0 {
+		fmt.Fprintln(os.Stderr, "\n失败的项:")
+		for _, failure := range failures {
+			fmt.Fprintf(os.Stderr, "  [%d] ", failure.Item)
+			if failure.Line > 0 {
+				fmt.Fprintf(os.Stderr, "第 %d 行 ", failure.Line)
+			}
+			fmt.Fprintf(os.Stderr, "%s: %s\n", failure.Request, failure.Error)
+		}
+		os.Exit(1)
+	}
+}
+
+// issueBatchItem 签发清单中的一项，失败原因记录在结果中
+func issueBatchItem(item batchItem, outDir string, opts server.LicenseOptions) batchResult {
+	result := batchResult{
+		Line:         item.Line,
+		Request:      item.Request,
+		CustomerName: item.Customer,
+		CustomerOrg:  item.Org,
+		Edition:      item.Edition,
+		Status:       "failed",
+	}
+	fail := func(format string, a ...interface{}) batchResult {
+		result.Error = fmt.Sprintf(format, a...)
+		return result
+	}
+
+	if item.Request == "" {
+		return fail("未指定req.dat (request)")
+	}
+	if _, err := os.Stat(item.Request); err != nil {
+		return fail("输入文件不存在: %s", item.Request)
+	}
+	edition, ok := parseEdition(strings.ToLower(item.Edition))
+	if !ok {
+		return fail("无效的授权版本: %s", item.Edition)
+	}
+	if item.Days <= 0 {
+		return fail("无效的授权天数，必须为大于0的整数")
+	}
+	for _, name := range item.Modules {
+		module, ok := shared.ParseLicenseModule(name)
+		if !ok {
+			return fail("无效的模块名称: %s", name)
+		}
+		opts.Modules = append(opts.Modules, module)
+	}
+	opts.Days = item.Days
+	opts.Customer = server.CustomerInfo{
+		Name:    item.Customer,
+		Org:     item.Org,
+		Edition: edition,
+	}
+
+	// 未指定输出文件时先写入临时文件，签发后按序列号命名
+	output := item.Output
+	if output != "" && !filepath.IsAbs(output) {
+		output = filepath.Join(outDir, output)
+	}
+	target := output
+	if target == "" {
+		target = filepath.Join(outDir, fmt.Sprintf(".batch_%d.dat", os.Getpid()))
+	} else if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fail("创建输出目录失败: %v", err)
+	}
+
+	license, err := server.IssueLicense(item.Request, target, opts)
+	if err != nil {
+		return fail("%s", issueErrorText(err))
+	}
+	if output == "" {
+		output = filepath.Join(outDir, "license_"+license.SerialNumber+".dat")
+		if err := os.Rename(target, output); err != nil {
+			result.Output = target
+			return fail("授权已签发为 %s，重命名为 %s 失败: %v", license.SerialNumber, output, err)
+		}
+	}
+
+	result.SerialNumber = license.SerialNumber
+	result.ExpiresAt = time.Unix(license.ExpiresAt, 0).Format("2006-01-02")
+	result.Output = output
+	result.Status = "ok"
+	return result
+}
+
+// readBatchManifest 读取批量签发清单，扩展名为.json时按JSON数组解析，否则按CSV解析
+func readBatchManifest(path string) ([]batchItem, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var items []batchItem
+		if err := json.NewDecoder(file).Decode(&items); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest: %v", err)
+		}
+		return items, nil
+	}
+	return readBatchCSV(file)
+}
+
+// readBatchCSV 按列名读取CSV清单，跳过空行；列名不区分大小写，未知的列视为错误以免拼写错误被忽略
+func readBatchCSV(r io.Reader) ([]batchItem, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest header: %v", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		known := false
+		for _, column := range batchColumns {
+			known = known || column == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown manifest column %q, expected %s", name, strings.Join(batchColumns, ", "))
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["request"]; !ok {
+		return nil, fmt.Errorf("manifest is missing the request column")
+	}
+
+	var items []batchItem
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest: %v", err)
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		line, _ := cr.FieldPos(0)
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		item := batchItem{
+			Line:     line,
+			Request:  field("request"),
+			Customer: field("customer"),
+			Org:      field("org"),
+			Edition:  field("edition"),
+			Output:   field("output"),
+			Modules:  splitList(strings.ReplaceAll(field("modules"), ";", ",")),
+		}
+		if days := field("days"); days != "" {
+			// 天数无效时保留为负数，由签发时报告为该项的失败
+			if item.Days, err = strconv.Atoi(days); err != nil || item.Days <= 0 {
+				item.Days = -1
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// writeBatchReport 写入批量签发的汇总报告
+func writeBatchReport(path string, results []batchResult) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+	cw := csv.NewWriter(file)
+	if err := cw.Write(batchReportColumns); err != nil {
+		return err
+	}
+	for _, result := range results {
+		line := ""
+		if result.Line > 0 {
+			line = strconv.Itoa(result.Line)
+		}
+		record := []string{
+			strconv.Itoa(result.Item), line, result.Request, result.CustomerName, result.CustomerOrg, result.Edition,
+			result.SerialNumber, result.ExpiresAt, result.Output, result.Status, result.Error,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lengxu/golicense/server"
+	"github.com/lengxu/golicense/shared"
+)
+
+// runCodes licgen codes 子命令：批量生成激活码
+func runCodes(args []string) {
+	fs := flag.NewFlagSet("codes", flag.ExitOnError)
+	var (
+		count      = fs.Int("n", 1, "生成的激活码数量")
+		edition    = fs.String("edition", "enterprise", "授权版本 (basic|enterprise)")
+		modules    = fs.String("modules", "", "版本之外额外包含的模块，逗号分隔")
+		days       = fs.Int("d", 365, "授权有效期（天数），从激活时开始计算")
+		seats      = fs.Int("seats", 1, "每个激活码可激活的机器数，0表示不限制")
+		secretPath = fs.String("secret", server.DefaultActivationSecretFile, "激活码密钥文件，不存在时自动生成")
+		output     = fs.String("o", "", "输出CSV文件，为空时输出到终端")
+	)
+	fs.Usage = func() {
+		fmt.Println("licgen codes - 生成激活码")
+		fmt.Println()
+		fmt.Println("用法:")
+		fmt.Println("  licgen codes [-n 数量] [-edition basic|enterprise] [-modules ...] [-d 天数] [-seats 机器数] [选项]")
+		fmt.Println()
+		fmt.Println("选项:")
+		fs.PrintDefaults()
+		fmt.Println()
+		fmt.Println("激活码包含授权版本、额外模块、有效期和可激活的机器数，用激活码密钥防伪。")
+		fmt.Printf("客户可在生成req.dat时输入激活码 (reqgen -code)，由licgen离线兑换或授权服务器在线兑换。\n")
+		fmt.Printf("未指定 -secret 文件时也可通过环境变量 %s 提供密钥(hex)。\n", server.ActivationSecretEnv)
+		fmt.Println()
+		fmt.Println("示例:")
+		fmt.Println("  licgen codes -n 100 -edition basic -d 365 -o codes.csv")
+		fmt.Println("  licgen codes -edition basic -modules camera_scan -seats 5")
+	}
+	fs.Parse(args)
+
+	if *count <= 0 {
+		log.Fatal("激活码数量必须大于0")
+	}
+	licenseEdition, ok := parseEdition(*edition)
+	if !ok {
+		log.Fatal("无效的授权版本:", *edition, "。请使用 basic 或 enterprise")
+	}
+	var codeModules []shared.LicenseModule
+	for _, name := range splitList(*modules) {
+		module, ok := shared.ParseLicenseModule(name)
+		if !ok {
+			log.Fatal("无效的模块名称:", name)
+		}
+		codeModules = append(codeModules, module)
+	}
+
+	if err := loadActivationSecret(*secretPath, true); err != nil {
+		log.Fatal("加载激活码密钥失败:", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.OpenFile(*output, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			log.Fatal("创建输出文件失败:", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	writer := csv.NewWriter(out)
+	writer.Write([]string{"code", "id", "edition", "modules", "days", "seats"})
+	for i := 0; i < *count; i++ {
+		code := server.ActivationCode{
+			Edition: licenseEdition,
+			Modules: codeModules,
+			Days:    *days,
+			Seats:   *seats,
+		}
+		text, err := server.GenerateActivationCode(&code)
+		if err != nil {
+			log.Fatal("生成激活码失败:", err)
+		}
+		names := make([]string, len(code.Modules))
+		for j, module := range code.Modules {
+			names[j] = string(module)
+		}
+		writer.Write([]string{text, code.ID, string(code.Edition), strings.Join(names, ";"),
+			strconv.Itoa(code.Days), strconv.Itoa(code.Seats)})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Fatal("写入激活码失败:", err)
+	}
+
+	if *output != "" {
+		fmt.Printf("✓ 已生成 %d 个激活码: %s\n", *count, *output)
+	}
+}
+
+// loadActivationSecret 加载激活码密钥，文件不存在时依次尝试环境变量和自动生成
+func loadActivationSecret(path string, create bool) error {
+	if path != "" {
+		if _, err := os.Stat(path); err == nil {
+			return server.LoadActivationSecretFile(path)
+		}
+	}
+	if os.Getenv(server.ActivationSecretEnv) != "" {
+		return server.LoadActivationSecretFromEnv(server.ActivationSecretEnv)
+	}
+	if !create || path == "" {
+		return fmt.Errorf("%v (请用 -code-secret 指定激活码密钥文件)", server.ErrNoActivationSecret)
+	}
+
+	if err := server.CreateActivationSecretFile(path); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "已生成新的激活码密钥: %s\n", path)
+	fmt.Fprintln(os.Stderr, "请妥善备份此文件：丢失后已发出的激活码将无法兑换，泄露后他人可伪造激活码")
+	return nil
+}
+
+// parseEdition 解析命令行指定的授权版本
+func parseEdition(name string) (shared.LicenseEdition, bool) {
+	switch name {
+	case "basic", "b":
+		return shared.EditionBasic, true
+	case "enterprise", "e":
+		return shared.EditionEnterprise, true
+	}
+	return "", false
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lengxu/golicense/server"
+)
+
+// runExtend licgen extend 子命令：为离线续期申请码签发续期码
+func runExtend(args []string) {
+	fs := flag.NewFlagSet("extend", flag.ExitOnError)
+	var (
+		days       = fs.Int("d", 365, "续期天数，从当前到期时间（已过期时从今天）开始计算")
+		until      = fs.String("until", "", "续期到指定日期 (YYYY-MM-DD)，指定时忽略 -d")
+		ledgerPath = fs.String("ledger", server.DefaultLedgerFile, "签发记录文件，用于核对序列号和记录续期，为空时不记录")
+		issuer     = fs.String("issuer", currentUser(), "签发人，写入签发记录")
+		keyFile    = fs.String("key", "", "签名私钥PEM文件")
+		keyEnv     = fs.String("key-env", "", "从指定环境变量读取签名私钥PEM内容")
+		passEnv    = fs.String("key-pass-env", server.SigningKeyPasswordEnv, "保存私钥密码的环境变量")
+		passFile   = fs.String("key-pass-file", "", "保存私钥密码的文件")
+	)
+	fs.Usage = func() {
+		fmt.Println("licgen extend - 离线续期")
+		fmt.Println()
+		fmt.Println("用法:")
+		fmt.Println("  licgen extend [-d 天数 | -until YYYY-MM-DD] [选项] <续期申请码>")
+		fmt.Println()
+		fmt.Println("选项:")
+		fs.PrintDefaults()
+		fmt.Println()
+		fmt.Println("客户在无法联网的机器上执行 liccheck -renew-request 得到续期申请码，")
+		fmt.Println("授权方用签名私钥签发续期码，客户执行 liccheck -renew <续期码> 应用。")
+		fmt.Println("续期码只延长该授权的到期时间，不改变版本、模块等其他内容，也不需要替换license.dat。")
+		fmt.Println("续期码约100个字符，可以通过电话口述；签名私钥须为Ed25519或ECDSA，不支持RSA，")
+		fmt.Println("可以用 keygen -alg ed25519 生成续期专用密钥，其公钥需在客户端的受信任公钥中。")
+		fmt.Println()
+		fmt.Println("示例:")
+		fmt.Println("  licgen extend -key signing_key.pem -d 365 2xKq9-...")
+		fmt.Println("  licgen extend -key signing_key.pem -until 2027-12-31 2xKq9-...")
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	challenge, err := server.ParseRenewalChallenge(strings.Join(fs.Args(), ""))
+	if err != nil {
+		log.Fatal("续期申请码无效:", err)
+	}
+
+	if err := loadSigningKey(keyOptions{
+		file:     *keyFile,
+		env:      *keyEnv,
+		passEnv:  *passEnv,
+		passFile: *passFile,
+	}, os.Stdout); err != nil {
+		log.Fatal("加载签名私钥失败:", err)
+	}
+	if err := server.CheckRenewalKey(); err != nil {
+		log.Fatalf("签名私钥不能签发续期码: %v\n离线续期需要Ed25519或ECDSA签名私钥，可以用 keygen -alg ed25519 生成续期专用密钥，"+
+			"并将其公钥加入客户端的受信任公钥", err)
+	}
+
+	// 核对签发记录，以记录中最近一次续期后的到期时间为起点
+	var ledger *server.Ledger
+	current := challenge.ExpiresAt
+	if *ledgerPath != "" {
+		if _, err := os.Stat(*ledgerPath); err == nil {
+			ledger, err = server.OpenLedger(*ledgerPath)
+			if err != nil {
+				log.Fatal("打开签发记录失败:", err)
+			}
+			entries, err := ledger.FindBySerial(challenge.SerialNumber)
+			if err != nil {
+				log.Fatal("查询签发记录失败:", err)
+			}
+			if len(entries) == 0 {
+				fmt.Printf("注意: 签发记录中没有序列号 %s\n", challenge.SerialNumber)
+			} else {
+				entry := entries[len(entries)-1]
+				if entry.TransferredTo != "" {
+					log.Fatalf("授权 %s 已迁移到 %s，请为新授权续期", challenge.SerialNumber, entry.TransferredTo)
+				}
+				if entry.SupersededBy != "" {
+					log.Fatalf("授权 %s 已升级为 %s，请为新授权续期", challenge.SerialNumber, entry.SupersededBy)
+				}
+				fmt.Printf("续期 %s: %s", challenge.SerialNumber, entry.CustomerName)
+				if entry.CustomerOrg != "" {
+					fmt.Printf(" (%s)", entry.CustomerOrg)
+				}
+				fmt.Printf("，%s，当前到期 %s\n", entry.Edition, time.Unix(entry.ExpiresAt, 0).Format("2006-01-02"))
+				if entry.ExpiresAt > current {
+					current = entry.ExpiresAt
+				}
+			}
+		}
+	}
+
+	var expiresAt time.Time
+	if *until != "" {
+		date, err := time.ParseInLocation("2006-01-02", *until, time.Local)
+		if err != nil {
+			log.Fatal("无效的日期:", *until)
+		}
+		expiresAt = date.Add(24*time.Hour - time.Second)
+	} else {
+		if *days <= 0 {
+			log.Fatal("续期天数必须大于0")
+		}
+		start := time.Unix(current, 0)
+		if now := time.Now(); start.Before(now) {
+			start = now
+		}
+		expiresAt = start.AddDate(0, 0, *days)
+	}
+
+	token, err := server.GenerateRenewalToken(challenge, expiresAt)
+	if err != nil {
+		log.Fatal("签发续期码失败:", err)
+	}
+
+	if ledger != nil {
+		if _, err := server.RecordRenewal(ledger, challenge, expiresAt, *issuer); err != nil {
+			log.Fatal("写入签发记录失败:", err)
+		}
+	}
+
+	fmt.Printf("授权 %s 续期至 %s\n", challenge.SerialNumber, expiresAt.Format("2006-01-02 15:04:05"))
+	fmt.Println()
+	fmt.Println("续期码:")
+	fmt.Println()
+	fmt.Println("  " + token)
+	fmt.Println()
+	fmt.Println("客户执行 liccheck -renew <续期码> 应用，续期码只对该授权有效")
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lengxu/golicense/server"
+	"github.com/lengxu/golicense/shared"
+)
+
+// inspectResult licgen inspect 的JSON输出，每个文件为数组中的一项
+type inspectResult struct {
+	Path        string                 `json:"path"`
+	Type        string                 `json:"type"` // license 或 request
+	Header      interface{}            `json:"header,omitempty"`
+	License     *server.License        `json:"license,omitempty"`
+	Request     *server.LicenseRequest `json:"request,omitempty"`
+	DecryptedBy string                 `json:"decrypted_by,omitempty"`
+	Verified    bool                   `json:"verified"`
+	Problem     string                 `json:"problem,omitempty"`
+	Ledger      []server.LedgerEntry   `json:"ledger,omitempty"`
+}
+
+// licenseHeader license.dat中未加密的信封头
+type licenseHeader struct {
+	Version    string            `json:"version"`
+	KeyID      string            `json:"key_id,omitempty"`
+	Algorithm  string            `json:"alg,omitempty"`
+	Binding    string            `json:"binding,omitempty"`
+	KDF        string            `json:"kdf,omitempty"`
+	Recipients []recipientHeader `json:"recipients,omitempty"`
+}
+
+// recipientHeader 内容密钥接收方，不包含加密的密钥
+type recipientHeader struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// requestHeader req.dat中未加密的文件头
+type requestHeader struct {
+	Version   string `json:"version"`
+	KeyID     string `json:"key_id,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+	Hash      string `json:"hash"`
+}
+
+// runInspect licgen inspect 子命令：用签发方的密钥解密并核对license.dat或req.dat
+func runInspect(args []string) {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	var keys keyOptions
+	var (
+		format     = fs.String("format", "text", "输出格式 (text|json)")
+		hardware   = fs.String("hw", "", "授权绑定的硬件指纹，逗号分隔；仅在license.dat不在签发记录中时需要")
+		ledgerPath = fs.String("ledger", server.DefaultLedgerFile, "签发记录文件，用于解密托管的授权内容和显示签发历史，为空时不使用")
+	)
+	fs.StringVar(&keys.file, "key", "", "签名私钥PEM文件")
+	fs.StringVar(&keys.env, "key-env", "", "从指定环境变量读取签名私钥PEM内容")
+	fs.StringVar(&keys.passEnv, "key-pass-env", server.SigningKeyPasswordEnv, "保存私钥密码的环境变量")
+	fs.StringVar(&keys.passFile, "key-pass-file", "", "保存私钥密码的文件")
+	fs.StringVar(&keys.reqKey, "req-key", "", "解密req.dat和托管授权内容的RSA私钥PEM文件，签名私钥不是RSA时必需")
+	fs.Var((*listFlag)(&keys.retired), "retired-key", "已轮换的历史私钥PEM文件，用于核对旧授权的签名和解密旧req.dat，可重复指定")
+	fs.Usage = func() {
+		fmt.Println("licgen inspect - 查看授权文件和请求文件")
+		fmt.Println()
+		fmt.Println("用法:")
+		fmt.Println("  licgen inspect [选项] <license.dat|req.dat> ...")
+		fmt.Println()
+		fmt.Println("选项:")
+		fs.PrintDefaults()
+		fmt.Println()
+		fmt.Println("用签发方的密钥解密文件并显示全部字段，不需要在授权绑定的机器上执行。")
+		fmt.Println("license.dat在签发记录中有原文时用托管内容解密，否则用 -hw 或签发记录中的硬件指纹解密，")
+		fmt.Println("并核对授权内容与签名一致；加密给安装公钥且不在签发记录中的授权无法解密。")
+		fmt.Println("2.0和3.0格式的旧授权需要用 -hw 指定绑定的硬件指纹。")
+		fmt.Println("任一文件无法解密或签名核对失败时以非0状态退出。")
+		fmt.Println()
+		fmt.Println("示例:")
+		fmt.Println("  licgen inspect -key signing_key.pem license.dat")
+		fmt.Println("  licgen inspect -key signing_key.pem -format json req.dat license.dat")
+		fmt.Println("  licgen inspect -key signing_key.pem -ledger \"\" -hw 00df8290... license.dat")
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *format != "text" && *format != "json" {
+		log.Fatal("无效的输出格式:", *format, "。请使用 text 或 json")
+	}
+	// JSON输出时签名密钥信息写到stderr，保持stdout为合法JSON
+	var keyInfo io.Writer = os.Stdout
+	if *format == "json" {
+		keyInfo = os.Stderr
+	}
+	if err := loadSigningKey(keys, keyInfo); err != nil {
+		log.Fatal("加载签名私钥失败:", err)
+	}
+
+	// 签发记录不存在时不创建
+	var ledger *server.Ledger
+	if *ledgerPath != "" {
+		if _, err := os.Stat(*ledgerPath); err == nil {
+			if ledger, err = server.OpenLedger(*ledgerPath); err != nil {
+				log.Fatal("打开签发记录失败:", err)
+			}
+		}
+	}
+
+	failed := false
+	results := make([]inspectResult, 0, fs.NArg())
+	for _, path := range fs.Args() {
+		result := inspectFile(path, ledger, splitList(*hardware))
+		if !result.Verified {
+			failed = true
+		}
+		if *format == "text" {
+			printInspection(result)
+		}
+		results = append(results, result)
+	}
+
+	if *format == "json" {
+		// 文件数量不同时输出格式保持一致，总是输出数组
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(results); err != nil {
+			log.Fatal("输出JSON失败:", err)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// inspectFile 按文件前缀识别并解密一个文件，错误记录在Problem中
+func inspectFile(path string, ledger *server.Ledger, hardwareIDs []string) inspectResult {
+	result := inspectResult{Path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		result.Problem = fmt.Sprintf("failed to read file: %v", err)
+		return result
+	}
+	encoded := strings.TrimSpace(string(data))
+
+	switch {
+	case strings.HasPrefix(encoded, "LIC:"):
+		result.Type = "license"
+		inspection, err := server.InspectLicense(encoded, ledger, hardwareIDs)
+		if err != nil {
+			result.Problem = err.Error()
+			return result
+		}
+		header := licenseHeader{
+			Version:   inspection.File.Version,
+			KeyID:     inspection.File.KeyID,
+			Algorithm: inspection.File.Algorithm,
+			Binding:   inspection.File.Binding,
+			KDF:       inspection.File.KDF,
+		}
+		for _, recipient := range inspection.File.Recipients {
+			recipientType := recipient.Type
+			if recipientType == shared.RecipientTypeHardware {
+				recipientType = "hardware"
+			}
+			header.Recipients = append(header.Recipients, recipientHeader{Type: recipientType, ID: recipient.ID})
+		}
+		result.Header = header
+		result.License = inspection.License
+		result.DecryptedBy = inspection.DecryptedBy
+		result.Verified = inspection.Verified
+		result.Problem = inspection.Problem
+		result.Ledger = stripLedgerEntries(inspection.Entries)
+	case strings.HasPrefix(encoded, "REQ:"):
+		result.Type = "request"
+		inspection, err := server.InspectRequest(encoded, ledger)
+		if err != nil {
+			result.Problem = err.Error()
+			return result
+		}
+		result.Header = requestHeader{
+			Version:   inspection.File.Version,
+			KeyID:     inspection.File.KeyID,
+			Timestamp: inspection.File.Timestamp,
+			Hash:      inspection.File.Hash,
+		}
+		result.Request = inspection.Request
+		// req.dat的哈希和AEAD认证在解密时已核对
+		result.Verified = true
+		result.Ledger = stripLedgerEntries(inspection.Entries)
+	default:
+		result.Problem = "not a license.dat or req.dat file"
+	}
+	return result
+}
+
+// stripLedgerEntries 去掉签发记录中的授权原文和托管内容，只保留可读字段
+func stripLedgerEntries(entries []server.LedgerEntry) []server.LedgerEntry {
+	stripped := make([]server.LedgerEntry, 0, len(entries))
+	for _, entry := range entries {
+		entry.Encoded = ""
+		entry.Escrow = ""
+		stripped = append(stripped, entry)
+	}
+	return stripped
+}
+
+// printInspection 以文本形式输出一个文件的全部字段
+func printInspection(result inspectResult) {
+	fmt.Printf("\n文件: %s\n", result.Path)
+	switch header := result.Header.(type) {
+	case licenseHeader:
+		fmt.Println("类型: 授权文件 (license.dat)")
+		fmt.Printf("  格式版本: %s\n", header.Version)
+		fmt.Printf("  签名密钥: %s (%s)\n", header.KeyID, header.Algorithm)
+		if header.Binding != "" {
+			fmt.Printf("  绑定方式: %s\n", header.Binding)
+		}
+		if header.KDF != "" {
+			fmt.Printf("  密钥派生: %s\n", header.KDF)
+		}
+		for _, recipient := range header.Recipients {
+			fmt.Printf("  接收方:   %s %s\n", recipient.Type, recipient.ID)
+		}
+	case requestHeader:
+		fmt.Println("类型: 请求文件 (req.dat)")
+		if header.Version != "" {
+			fmt.Printf("  格式版本: %s\n", header.Version)
+		} else {
+			fmt.Println("  格式版本: 旧格式")
+		}
+		if header.KeyID != "" {
+			fmt.Printf("  加密密钥: %s\n", header.KeyID)
+		}
+		fmt.Printf("  生成时间: %s\n", formatTime(header.Timestamp))
+		fmt.Printf("  数据哈希: %s\n", header.Hash)
+	}
+
+	switch {
+	case result.License != nil:
+		printInspectedLicense(result)
+	case result.Request != nil:
+		printInspectedRequest(result.Request)
+	}
+
+	if result.Problem != "" {
+		fmt.Printf("✗ %s\n", result.Problem)
+	} else if result.Type == "license" {
+		fmt.Println("✓ 签名有效")
+	}
+
+	if len(result.Ledger) > 0 {
+		if result.Type == "request" {
+			fmt.Println("该机器已签发的授权:")
+		} else {
+			fmt.Println("签发记录:")
+		}
+		for _, entry := range result.Ledger {
+			printInspectedEntry(entry)
+		}
+	}
+}
+
+// printInspectedLicense 输出授权内容的全部字段
+func printInspectedLicense(result inspectResult) {
+	license := result.License
+	switch result.DecryptedBy {
+	case server.DecryptedByEscrow:
+		fmt.Println("解密方式: 签发记录中托管的授权内容")
+	case server.DecryptedByHardware:
+		fmt.Println("解密方式: 硬件指纹")
+	}
+	fmt.Println("授权内容:")
+	fmt.Printf("  序列号:     %s\n", license.SerialNumber)
+	licenseType := string(license.LicenseType)
+	if licenseType == "" {
+		licenseType = "standard"
+	}
+	fmt.Printf("  授权类型:   %s\n", licenseType)
+	if license.Edition != "" {
+		fmt.Printf("  授权版本:   %s\n", license.Edition)
+	}
+	if license.BaseSerial != "" {
+		fmt.Printf("  基础授权:   %s\n", license.BaseSerial)
+	}
+	fmt.Printf("  客户:       %s", license.CustomerName)
+	if license.CustomerOrg != "" {
+		fmt.Printf(" (%s)", license.CustomerOrg)
+	}
+	fmt.Println()
+	if license.CustomerID != "" {
+		fmt.Printf("  客户ID:     %s\n", license.CustomerID)
+	}
+	if license.HardwareID != "" {
+		fmt.Printf("  硬件指纹:   %s\n", license.HardwareID)
+	}
+	for _, hardwareID := range license.HardwareIDs {
+		fmt.Printf("  多机指纹:   %s\n", hardwareID)
+	}
+	if license.MaxSeats > 0 {
+		fmt.Printf("  最大机器数: %d\n", license.MaxSeats)
+	}
+	if license.RequestID != "" {
+		fmt.Printf("  请求ID:     %s\n", license.RequestID)
+	}
+	fmt.Printf("  签发时间:   %s\n", formatTime(license.IssuedAt))
+	fmt.Printf("  到期时间:   %s", formatTime(license.ExpiresAt))
+	if remaining := int((license.ExpiresAt - time.Now().Unix()) / 86400); remaining >= 0 {
+		fmt.Printf(" (剩余 %d 天)\n", remaining)
+	} else {
+		fmt.Println(" (已过期)")
+	}
+	if license.TrialDays > 0 {
+		fmt.Printf("  试用天数:   %d\n", license.TrialDays)
+	}
+	fmt.Printf("  授权密钥:   %s\n", license.LicenseKey)
+	if license.LeaseKey != "" {
+		fmt.Printf("  租约公钥:   %s\n", license.LeaseKey)
+	}
+	fmt.Printf("  扫描次数:   %d\n", license.MaxScans)
+	fmt.Printf("  资产数量:   %d\n", license.MaxAssets)
+	fmt.Printf("  用户数量:   %d\n", license.MaxUsers)
+	fmt.Printf("  功能特性:   %s\n", strings.Join(license.Features, ", "))
+	modules := make([]string, 0, len(license.Modules))
+	for _, module := range license.Modules {
+		modules = append(modules, string(module))
+	}
+	fmt.Printf("  授权模块:   %s\n", strings.Join(modules, ", "))
+	if len(license.ModulePerms) > 0 {
+		fmt.Println("  模块权限:")
+		for _, perm := range license.ModulePerms {
+			state := "启用"
+			if !perm.Enabled {
+				state = "停用"
+			}
+			fmt.Printf("    - %s: %s，扫描次数 %d，目标数量 %d\n", perm.Module, state, perm.MaxScans, perm.MaxTargets)
+			if len(perm.Features) > 0 {
+				fmt.Printf("      功能: %s\n", strings.Join(perm.Features, ", "))
+			}
+			if len(perm.Permissions) > 0 {
+				fmt.Printf("      权限: %s\n", strings.Join(perm.Permissions, ", "))
+			}
+		}
+	}
+	if len(license.Claims) > 0 {
+		fmt.Println("  自定义声明:")
+		keys := make([]string, 0, len(license.Claims))
+		for key := range license.Claims {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Printf("    %s: %v\n", key, license.Claims[key])
+		}
+	}
+}
+
+// printInspectedRequest 输出请求内容的全部字段
+func printInspectedRequest(request *server.LicenseRequest) {
+	fmt.Println("请求内容:")
+	fmt.Printf("  硬件指纹: %s\n", request.HardwareID)
+	fmt.Printf("  机器信息: %s\n", request.MachineInfo)
+	fmt.Printf("  请求ID:   %s\n", request.RequestID)
+	fmt.Printf("  请求时间: %s\n", formatTime(request.Timestamp))
+	fmt.Printf("  程序版本: %s\n", request.Version)
+	if request.PublicKey != "" {
+		fmt.Printf("  安装公钥: %s\n", request.PublicKey)
+	}
+	if request.ActivationCode != "" {
+		fmt.Printf("  激活码:   %s\n", request.ActivationCode)
+	}
+	if request.LeaseKey != "" {
+		fmt.Printf("  租约公钥: %s\n", request.LeaseKey)
+	}
+}
+
+// printInspectedEntry 输出一条签发记录，标明续期、续订、迁移和升级
+func printInspectedEntry(entry server.LedgerEntry) {
+	fmt.Printf("  %s  %s  到期 %s", time.Unix(entry.RecordedAt, 0).Format("2006-01-02 15:04"),
+		entry.SerialNumber, time.Unix(entry.ExpiresAt, 0).Format("2006-01-02"))
+	switch {
+	case entry.SupersededBy != "":
+		fmt.Printf("  已升级为 %s", entry.SupersededBy)
+	case entry.TransferredTo != "":
+		fmt.Printf("  已迁移到 %s", entry.TransferredTo)
+	case entry.Renewal:
+		fmt.Print("  离线续期")
+	case entry.TransferredFrom != "":
+		fmt.Printf("  迁移自 %s", entry.TransferredFrom)
+	case entry.PreviousSerial != "" && entry.PreviousSerial != entry.SerialNumber:
+		fmt.Printf("  升级自 %s", entry.PreviousSerial)
+	case entry.PreviousSerial != "":
+		fmt.Print("  续订")
+	case entry.Reissued:
+		fmt.Print("  重新签发")
+	default:
+		fmt.Print("  签发")
+	}
+	if entry.Issuer != "" {
+		fmt.Printf("  (%s)", entry.Issuer)
+	}
+	fmt.Println()
+}
+
+// formatTime 格式化Unix时间
+func formatTime(unix int64) string {
+	return time.Unix(unix, 0).Format("2006-01-02 15:04:05")
+}
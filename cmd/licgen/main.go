@@ -1,10 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"crypto"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/user"
 	"path/filepath"
 	"strings"
 	"time"
@@ -14,13 +20,72 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "report":
+			runReport(os.Args[2:])
+			return
+		case "revoke":
+			runRevoke(os.Args[2:])
+			return
+		case "codes":
+			runCodes(os.Args[2:])
+			return
+		case "extend":
+			runExtend(os.Args[2:])
+			return
+		case "renew":
+			runRenew(os.Args[2:])
+			return
+		case "upgrade":
+			runUpgrade(os.Args[2:])
+			return
+		case "inspect":
+			runInspect(os.Args[2:])
+			return
+		case "batch":
+			runBatch(os.Args[2:])
+			return
+		}
+	}
+
+	var inputs listFlag
+	flag.Var(&inputs, "i", "输入的req.dat文件路径，可重复指定或用逗号分隔以生成多机授权")
+	claims := claimFlag{}
+	flag.Var(claims, "claim", "自定义声明 key=value，值作为字符串，可重复指定")
+	flag.Var(claimJSONFlag(claims), "claim-json", "自定义声明 key=JSON值，用于数字、布尔、数组等类型，可重复指定")
+	var retired listFlag
+	reqKey := flag.String("req-key", "", "解密req.dat的RSA私钥PEM文件，签名私钥不是RSA时必需")
+	flag.Var(&retired, "retired-key", "已轮换的历史私钥PEM文件，仅用于解密旧客户端的req.dat，可重复指定")
 	var (
-		input    = flag.String("i", "", "输入的req.dat文件路径")
 		output   = flag.String("o", "license.dat", "输出的license.dat文件路径")
 		days     = flag.Int("d", 365, "授权有效期（天数）")
 		customer = flag.String("c", "", "客户名称")
 		org      = flag.String("org", "", "客户组织")
 		edition  = flag.String("edition", "enterprise", "授权版本 (basic|enterprise)")
+		addon    = flag.String("addon", "", "生成增购授权，指定基础授权序列号")
+		modules  = flag.String("modules", "", "增购的模块列表，逗号分隔")
+		features = flag.String("features", "", "增购的功能特性列表，逗号分隔")
+		maxScans = flag.Int("max-scans", 0, "增购的扫描次数")
+		maxAsset = flag.Int("max-assets", 0, "增购的资产数量")
+		maxUsers = flag.Int("max-users", 0, "增购的用户数量")
+		seats    = flag.Int("seats", 0, "多机授权的最大机器数，0表示不限制")
+		floating = flag.Int("floating", 0, "签发浮动授权，指定最大并发租约数 (req.dat须由 leaseserver -init 生成)")
+		maxAge   = flag.Duration("max-req-age", defaultMaxRequestAge, "req.dat的最长有效期，0表示不限制")
+		trial    = flag.Int("trial", 0, "生成试用授权，指定首次运行后的试用天数")
+		claimsIn = flag.String("claims-file", "", "从JSON文件读取自定义声明")
+		keyFile  = flag.String("key", "", "签名私钥PEM文件（PKCS#1、PKCS#8或加密的PKCS#8）")
+		keyEnv   = flag.String("key-env", "", "从指定环境变量读取签名私钥PEM内容")
+		passEnv  = flag.String("key-pass-env", server.SigningKeyPasswordEnv, "保存私钥密码的环境变量")
+		passFile = flag.String("key-pass-file", "", "保存私钥密码的文件")
+		ledger   = flag.String("ledger", server.DefaultLedgerFile, "签发记录文件，为空时不检查重复签发")
+		reissue  = flag.Bool("reissue", false, "允许对已签发过授权的请求或机器重新签发")
+		issuer   = flag.String("issuer", currentUser(), "签发人，写入签发记录")
+		code     = flag.String("code", "", "兑换激活码，按激活码内容签发授权")
+		secret   = flag.String("code-secret", server.DefaultActivationSecretFile, "激活码密钥文件")
+		transfer = flag.String("transfer", "", "授权迁移，指定原机器生成的停用回执 (deactivation.dat)")
+		maxMoves = flag.Int("max-transfers", server.DefaultMaxTransfersPerYear, "同一授权每年允许的迁移次数，0表示不限制")
+		crlPath  = flag.String("crl", shared.RevocationListFile, "吊销列表文件，迁移授权时将原授权文件加入该列表")
 		help     = flag.Bool("h", false, "显示帮助信息")
 	)
 	flag.Parse()
@@ -30,10 +95,18 @@ func main() {
 		fmt.Println()
 		fmt.Println("用法:")
 		fmt.Println("  licgen -i <req.dat> [选项]")
+		fmt.Println("  licgen report [选项]          查询签发记录，详见 licgen report -h")
+		fmt.Println("  licgen revoke [选项]          吊销已签发的授权，详见 licgen revoke -h")
+		fmt.Println("  licgen codes [选项]           生成激活码，详见 licgen codes -h")
+		fmt.Println("  licgen extend [选项] <申请码> 为离线续期申请码签发续期码，详见 licgen extend -h")
+		fmt.Println("  licgen renew [选项] <序列号>  从原到期时间起续订授权，详见 licgen renew -h")
+		fmt.Println("  licgen upgrade [选项] <序列号> 升级授权版本或追加模块，详见 licgen upgrade -h")
+		fmt.Println("  licgen inspect [选项] <文件>  解密并查看license.dat或req.dat，详见 licgen inspect -h")
+		fmt.Println("  licgen batch [选项] <清单>    按CSV或JSON清单批量签发授权，详见 licgen batch -h")
 		fmt.Println()
 		fmt.Println("选项:")
 		fmt.Println("  -i string")
-		fmt.Println("        输入的req.dat文件路径 (必需)")
+		fmt.Println("        输入的req.dat文件路径 (必需)，可重复指定或用逗号分隔以生成多机授权")
 		fmt.Println("  -o string")
 		fmt.Println("        输出的license.dat文件路径 (默认 \"license.dat\")")
 		fmt.Println("  -d int")
@@ -44,8 +117,72 @@ func main() {
 		fmt.Println("        客户组织")
 		fmt.Println("  -edition string")
 		fmt.Println("        授权版本 basic(基础版)|enterprise(旗舰版) (默认 \"enterprise\")")
+		fmt.Println("  -addon string")
+		fmt.Println("        生成增购授权，指定基础授权序列号 (如 NSB-xxxxxxxxxxxx)")
+		fmt.Println("  -modules string")
+		fmt.Println("        增购的模块列表，逗号分隔 (admission,vulnerability_scan,password_audit,camera_scan)")
+		fmt.Println("  -features string")
+		fmt.Println("        增购的功能特性列表，逗号分隔")
+		fmt.Println("  -max-scans int")
+		fmt.Println("        增购的扫描次数")
+		fmt.Println("  -max-assets int")
+		fmt.Println("        增购的资产数量")
+		fmt.Println("  -max-users int")
+		fmt.Println("        增购的用户数量")
+		fmt.Println("  -seats int")
+		fmt.Println("        多机授权的最大机器数 (默认 0，不限制)")
+		fmt.Println("  -floating int")
+		fmt.Println("        签发浮动授权，指定租约服务器最多同时借出的租约数；req.dat须由 leaseserver -init 生成")
+		fmt.Println("  -max-req-age duration")
+		fmt.Printf("        拒绝生成时间早于此期限的req.dat，0表示不限制 (默认 %s)\n", defaultMaxRequestAge)
+		fmt.Printf("  -trial int\n")
+		fmt.Printf("        生成试用授权，指定首次运行后的试用天数 (最多 %d 天，无需 -i)\n", shared.MaxTrialDays)
+		fmt.Println("        试用授权不绑定硬件，-d 为试用授权可被激活的期限")
+		fmt.Println("  -claim key=value")
+		fmt.Println("        自定义声明，可重复指定；值总是作为字符串，如合同编号 -claim contract=123")
+		fmt.Println("  -claim-json key=value")
+		fmt.Println("        类型化的自定义声明，可重复指定；值必须是合法的JSON (数字、布尔、数组、对象)")
+		fmt.Println("  -claims-file string")
+		fmt.Println("        从JSON对象文件读取自定义声明，-claim/-claim-json 指定的同名声明优先")
+		fmt.Println("  -key string")
+		fmt.Println("        签名私钥PEM文件 (RSA、Ed25519或ECDSA P-256)，支持PKCS#1、SEC 1、PKCS#8和密码保护的PKCS#8")
+		fmt.Println("  -key-env string")
+		fmt.Println("        从指定环境变量读取签名私钥PEM内容")
+		fmt.Println("  -key-pass-env string")
+		fmt.Printf("        保存私钥密码的环境变量 (默认 \"%s\")\n", server.SigningKeyPasswordEnv)
+		fmt.Println("  -key-pass-file string")
+		fmt.Println("        保存私钥密码的文件")
+		fmt.Println("  -req-key string")
+		fmt.Println("        解密req.dat的RSA私钥PEM文件 (默认使用RSA签名私钥)；")
+		fmt.Println("        签名私钥为Ed25519或ECDSA时必需，与客户端内置的RSA公钥对应")
+		fmt.Println("  -retired-key string")
+		fmt.Println("        已轮换的历史私钥PEM文件，可重复指定；仅用于解密仍内置旧公钥的客户端生成的req.dat，")
+		fmt.Println("        签名始终使用 -key 指定的当前私钥")
+		fmt.Println("  -ledger string")
+		fmt.Printf("        签发记录文件，用于发现重复签发和请求重放，为空时不检查 (默认 \"%s\")\n", server.DefaultLedgerFile)
+		fmt.Println("  -reissue")
+		fmt.Println("        明确允许对已签发过授权的req.dat或机器重新签发 (如授权文件丢失)")
+		fmt.Println("  -issuer string")
+		fmt.Println("        签发人，写入签发记录 (默认当前系统用户)")
+		fmt.Println("  -code string")
+		fmt.Println("        兑换激活码：版本、模块和有效期取自激活码，忽略 -edition 和 -d；")
+		fmt.Println("        未指定时使用客户生成req.dat时输入的激活码")
+		fmt.Println("  -code-secret string")
+		fmt.Printf("        激活码密钥文件 (默认 \"%s\"，也可通过环境变量 %s 提供)\n", server.DefaultActivationSecretFile, server.ActivationSecretEnv)
+		fmt.Println("  -transfer string")
+		fmt.Println("        授权迁移：凭原机器执行 liccheck -deactivate 生成的停用回执为 -i 指定的新机器签发授权，")
+		fmt.Println("        沿用原授权的客户、版本、模块、配额和到期时间，忽略 -edition、-d 等参数；需要签发记录")
+		fmt.Println("  -max-transfers int")
+		fmt.Printf("        同一客户的授权过去一年内允许的迁移次数，0表示不限制 (默认 %d)\n", server.DefaultMaxTransfersPerYear)
+		fmt.Println("  -crl string")
+		fmt.Printf("        吊销列表文件，迁移授权时将原授权文件加入该列表，已存在时追加 (默认 \"%s\")\n", shared.RevocationListFile)
 		fmt.Println("  -h    显示帮助信息")
 		fmt.Println()
+		fmt.Println("签名私钥:")
+		fmt.Println("  licgen 不内置私钥，未指定 -key/-key-env 时依次读取以下环境变量:")
+		fmt.Printf("  %s  私钥PEM文件路径\n", server.SigningKeyFileEnv)
+		fmt.Printf("  %s       私钥PEM内容\n", server.SigningKeyEnv)
+		fmt.Println()
 		fmt.Println("授权版本说明:")
 		fmt.Println("  basic      - 基础版: 仅包含准入管理功能")
 		fmt.Println("  enterprise - 旗舰版: 包含全部功能(漏洞扫描、弱口令扫描、摄像头扫描)")
@@ -56,18 +193,28 @@ func main() {
 		fmt.Println("  licgen -i req.dat -c \"张三\" -org \"ABC公司\"                # 指定客户信息")
 		fmt.Println("  licgen -i req.dat -edition basic -d 30                      # 生成30天期限基础版")
 		fmt.Println("  licgen -i req.dat -c \"李四\" -d 180 -o custom.dat           # 完整参数")
+		fmt.Println("  licgen -i req.dat -addon NSB-xxxxxxxxxxxx -modules camera_scan  # 为基础授权增购摄像头扫描")
+		fmt.Println("  licgen -i a.dat,b.dat,c.dat -seats 20 -c \"王五\"              # 生成多机授权")
+		fmt.Println("  licgen -i lease_req.dat -floating 20 -c \"某大学\"            # 生成20个并发的浮动授权")
+		fmt.Println("  licgen -trial 14 -d 180 -o trial/license.dat                # 生成14天试用授权，随评估版本分发")
+		fmt.Println("  licgen -i req.dat -reissue                                  # 授权文件丢失时为同一机器重新签发")
+		fmt.Println("  licgen -i req.dat -c \"张三\" -code 5KdP2-...                 # 兑换激活码")
+		fmt.Println("  licgen -i new_req.dat -transfer deactivation.dat            # 迁移授权到新机器")
+		fmt.Println("  licgen -i req.dat -claim contract=HT-2025-001 -claim support_tier=gold -claim-json 'networks=[\"10.0.0.0/8\"]'")
 		return
 	}
 
-	if *input == "" {
+	if len(inputs) == 0 && *trial == 0 {
 		fmt.Println("错误: 必须指定输入文件 (-i)")
 		fmt.Println("使用 -h 查看帮助信息")
 		os.Exit(1)
 	}
 
 	// 检查输入文件是否存在
-	if _, err := os.Stat(*input); os.IsNotExist(err) {
-		log.Fatal("输入文件不存在:", *input)
+	for _, input := range inputs {
+		if _, err := os.Stat(input); os.IsNotExist(err) {
+			log.Fatal("输入文件不存在:", input)
+		}
 	}
 
 	// 确保输出目录存在
@@ -94,15 +241,118 @@ func main() {
 		log.Fatal("无效的授权版本:", *edition, "。请使用 basic 或 enterprise")
 	}
 
-	// 准备客户信息
-	customerInfo := server.CustomerInfo{
-		Name:    *customer,
-		Org:     *org,
-		Edition: licenseEdition,
+	if *seats < 0 {
+		log.Fatal("最大机器数不能为负数")
+	}
+	if *floating < 0 {
+		log.Fatal("浮动授权的并发数不能为负数")
+	}
+	if *floating > 0 && (len(inputs) != 1 || *seats > 0) {
+		log.Fatal("浮动授权只能指定一个租约服务器生成的req.dat，且不能与 -seats 同时使用")
+	}
+
+	// 加载签名私钥
+	if err := loadSigningKey(keyOptions{
+		file:     *keyFile,
+		env:      *keyEnv,
+		passEnv:  *passEnv,
+		passFile: *passFile,
+		reqKey:   *reqKey,
+		retired:  retired,
+	}, os.Stdout); err != nil {
+		log.Fatal("加载签名私钥失败:", err)
+	}
+
+	// 准备签发选项
+	opts := server.LicenseOptions{
+		Days: *days,
+		Customer: server.CustomerInfo{
+			Name:    *customer,
+			Org:     *org,
+			Edition: licenseEdition,
+		},
+		MaxSeats:       *seats,
+		MaxRequestAge:  *maxAge,
+		Reissue:        *reissue,
+		Issuer:         *issuer,
+		ActivationCode: *code,
+		Floating:       *floating,
+	}
+
+	// 激活码密钥：指定了激活码时必需，否则仅在客户的req.dat中带有激活码时使用
+	if err := loadActivationSecret(*secret, false); err != nil && *code != "" {
+		log.Fatal("加载激活码密钥失败:", err)
+	}
+	if *ledger != "" {
+		issueLedger, err := server.OpenLedger(*ledger)
+		if err != nil {
+			log.Fatal("打开签发记录失败:", err)
+		}
+		opts.Ledger = issueLedger
+	}
+
+	// 自定义声明
+	if *claimsIn != "" {
+		data, err := os.ReadFile(*claimsIn)
+		if err != nil {
+			log.Fatal("读取声明文件失败:", err)
+		}
+		// 数字保留原始文本，避免大整数丢失精度
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		var fileClaims map[string]interface{}
+		if err := decoder.Decode(&fileClaims); err != nil {
+			log.Fatal("解析声明文件失败:", err)
+		}
+		for key, value := range fileClaims {
+			if _, ok := claims[key]; !ok {
+				claims[key] = value
+			}
+		}
+	}
+	if len(claims) > 0 {
+		opts.Claims = claims
+	}
+
+	// 试用授权
+	if *trial != 0 {
+		opts.TrialDays = *trial
+		generateTrial(*output, opts)
+		return
+	}
+
+	// 授权迁移
+	if *transfer != "" {
+		if *maxMoves < 0 {
+			log.Fatal("每年迁移次数不能为负数")
+		}
+		generateTransfer(inputs, *output, *transfer, *crlPath, *maxMoves, opts)
+		return
+	}
+
+	// 增购授权
+	if *addon != "" {
+		addonSpec := server.AddonSpec{
+			BaseSerial: *addon,
+			Features:   splitList(*features),
+			MaxScans:   *maxScans,
+			MaxAssets:  *maxAsset,
+			MaxUsers:   *maxUsers,
+		}
+		for _, name := range splitList(*modules) {
+			module, ok := shared.ParseLicenseModule(name)
+			if !ok {
+				log.Fatal("无效的模块名称:", name)
+			}
+			addonSpec.Modules = append(addonSpec.Modules, module)
+		}
+		opts.Addon = &addonSpec
+		generateAddon(inputs, *output, opts)
+		return
 	}
 
 	// 生成授权文件
-	fmt.Printf("正在处理授权请求: %s\n", *input)
+	fmt.Printf("正在处理授权请求: %s\n", strings.Join(inputs, ", "))
 	if *customer != "" {
 		fmt.Printf("客户信息: %s", *customer)
 		if *org != "" {
@@ -110,22 +360,37 @@ func main() {
 		}
 		fmt.Println()
 	}
-	fmt.Printf("授权版本: %s", licenseEdition)
-	switch licenseEdition {
-	case shared.EditionBasic:
-		fmt.Print(" (基础版 - 准入管理)")
-	case shared.EditionEnterprise:
-		fmt.Print(" (旗舰版 - 全功能)")
+	if *code != "" {
+		fmt.Printf("激活码: %s\n", *code)
+	} else {
+		fmt.Printf("授权版本: %s", licenseEdition)
+		switch licenseEdition {
+		case shared.EditionBasic:
+			fmt.Print(" (基础版 - 准入管理)")
+		case shared.EditionEnterprise:
+			fmt.Print(" (旗舰版 - 全功能)")
+		}
+		fmt.Println()
+		fmt.Printf("授权有效期: %d 天\n", *days)
+	}
+	if *floating > 0 {
+		fmt.Printf("浮动授权: 最多 %d 个并发租约\n", *floating)
+	}
+	if len(inputs) > 1 || *seats > 0 {
+		fmt.Printf("多机授权: %d 台机器", len(inputs))
+		if *seats > 0 {
+			fmt.Printf("，最多 %d 台", *seats)
+		}
+		fmt.Println()
 	}
-	fmt.Println()
-	fmt.Printf("授权有效期: %d 天\n", *days)
 
-	if err := server.GenerateLicenseWithEdition(*input, *output, *days, customerInfo); err != nil {
-		log.Fatal("生成授权文件失败:", err)
+	license, err := server.IssueSiteLicense(inputs, *output, opts)
+	if err != nil {
+		fatalIssueError("生成授权文件失败", err)
 	}
 
 	// 生成智能文件名
-	smartOutput := generateSmartFilename(*output, *input, licenseEdition, *customer)
+	smartOutput := generateSmartFilename(*output, inputs[0], license.Edition, *customer, "license")
 
 	// 如果智能文件名与原文件名不同，则重命名
 	if smartOutput != *output {
@@ -136,11 +401,252 @@ func main() {
 	}
 
 	fmt.Printf("\n✓ 授权文件已生成: %s\n", smartOutput)
-	fmt.Println("请将此文件放置到客户端的goweb/bin/目录下")
+	if license.IsFloating() {
+		fmt.Println("请将此文件放置到租约服务器生成req.dat的目录下，由 leaseserver 借出租约")
+	} else {
+		fmt.Println("请将此文件放置到客户端的goweb/bin/目录下")
+	}
 
 	// 显示授权包含的模块
-	modules := shared.GetModulesForEdition(licenseEdition)
 	fmt.Printf("\n授权包含的模块:\n")
+	printModules(license.Modules)
+}
+
+// defaultMaxRequestAge licgen默认接受的req.dat最长有效期
+const defaultMaxRequestAge = 30 * 24 * time.Hour
+
+// rejectReasonText 请求拒绝原因的说明
+var rejectReasonText = map[server.RejectReason]string{
+	server.RejectUnreadable:        "无法读取请求文件",
+	server.RejectMalformed:         "请求文件格式错误",
+	server.RejectUnsupported:       "不支持的请求文件版本，请升级licgen",
+	server.RejectUnknownKey:        "请求使用的服务端公钥未加载，请用 -retired-key 指定对应私钥",
+	server.RejectDecryptFailed:     "请求文件被修改或损坏",
+	server.RejectHashMismatch:      "请求数据与校验值不一致，请求文件被修改",
+	server.RejectTimestampMismatch: "请求时间戳被修改",
+	server.RejectStale:             "请求已过期，请客户重新生成req.dat (或调整 -max-req-age)",
+	server.RejectFutureTimestamp:   "请求时间晚于当前时间，请检查客户端系统时间",
+}
+
+// fatalIssueError 输出签发失败原因并退出，重复签发和迁移超限时列出之前的签发记录
+func fatalIssueError(prefix string, err error) {
+	var transferLimit *server.TransferLimitError
+	if errors.As(err, &transferLimit) {
+		fmt.Fprintf(os.Stderr, "%s: 该授权过去一年内已迁移 %d 次，达到上限\n", prefix, len(transferLimit.Previous))
+		for _, entry := range transferLimit.Previous {
+			printLedgerEntry(entry)
+		}
+		fmt.Fprintln(os.Stderr, "\n如确需再次迁移，请用 -max-transfers 调整上限")
+		os.Exit(1)
+	}
+	var duplicate *server.DuplicateLicenseError
+	if errors.As(err, &duplicate) {
+		fmt.Fprintf(os.Stderr, "%s: 该请求或机器已签发过授权\n", prefix)
+		for _, entry := range duplicate.Previous {
+			printLedgerEntry(entry)
+		}
+		fmt.Fprintln(os.Stderr, "\n如确需重新签发(如授权文件丢失)，请添加 -reissue 参数")
+		os.Exit(1)
+	}
+	log.Fatalf("%s: %s", prefix, issueErrorText(err))
+}
+
+// issueErrorText 签发失败原因的单行说明，请求被拒绝时给出具体原因
+func issueErrorText(err error) string {
+	var rejected *server.RequestRejectedError
+	if errors.As(err, &rejected) {
+		return fmt.Sprintf("请求文件 %s 被拒绝 [%s] %s: %s", rejected.Path, rejected.Reason,
+			rejectReasonText[rejected.Reason], rejected.Detail)
+	}
+	var invalidCode *server.InvalidActivationCodeError
+	if errors.As(err, &invalidCode) {
+		return fmt.Sprintf("激活码无效 (%s)，请核对激活码是否输入正确", invalidCode.Reason)
+	}
+	if errors.Is(err, server.ErrActivationCodeExhausted) {
+		return "激活码已达到可激活的机器数上限"
+	}
+	if errors.Is(err, server.ErrActivationCodeExpired) {
+		return "本机用此激活码兑换的授权已到期，请购买新的激活码"
+	}
+	if errors.Is(err, server.ErrReceiptAlreadyUsed) {
+		return "该停用回执已经换取过迁移授权"
+	}
+	var transferLimit *server.TransferLimitError
+	if errors.As(err, &transferLimit) {
+		return fmt.Sprintf("该授权过去一年内已迁移 %d 次，达到上限", len(transferLimit.Previous))
+	}
+	var duplicate *server.DuplicateLicenseError
+	if errors.As(err, &duplicate) {
+		serials := make([]string, 0, len(duplicate.Previous))
+		for _, entry := range duplicate.Previous {
+			serials = append(serials, entry.SerialNumber)
+		}
+		return fmt.Sprintf("该请求或机器已签发过授权 (%s)，如确需重新签发请添加 -reissue", strings.Join(serials, ", "))
+	}
+	return err.Error()
+}
+
+// currentUser 当前系统用户名，作为默认签发人
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// printLedgerEntry 输出之前的签发记录
+func printLedgerEntry(entry server.LedgerEntry) {
+	fmt.Fprintf(os.Stderr, "\n  序列号:   %s", entry.SerialNumber)
+	if entry.Reissued {
+		fmt.Fprint(os.Stderr, " (重新签发)")
+	}
+	if entry.TransferredFrom != "" {
+		fmt.Fprintf(os.Stderr, " (迁移自 %s)", entry.TransferredFrom)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintf(os.Stderr, "  客户:     %s", entry.CustomerName)
+	if entry.CustomerOrg != "" {
+		fmt.Fprintf(os.Stderr, " (%s)", entry.CustomerOrg)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintf(os.Stderr, "  版本:     %s\n", entry.Edition)
+	fmt.Fprintf(os.Stderr, "  签发时间: %s\n", time.Unix(entry.IssuedAt, 0).Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(os.Stderr, "  到期时间: %s\n", time.Unix(entry.ExpiresAt, 0).Format("2006-01-02"))
+	if entry.Issuer != "" {
+		fmt.Fprintf(os.Stderr, "  签发人:   %s\n", entry.Issuer)
+	}
+	if len(entry.RequestIDs) > 0 {
+		fmt.Fprintf(os.Stderr, "  请求ID:   %s\n", strings.Join(entry.RequestIDs, ", "))
+	}
+	if len(entry.HardwareIDs) > 0 {
+		fmt.Fprintf(os.Stderr, "  硬件指纹: %s\n", strings.Join(entry.HardwareIDs, ", "))
+	}
+}
+
+// keyOptions 签名和解密私钥的命令行参数
+type keyOptions struct {
+	file     string   // 签名私钥文件
+	env      string   // 保存签名私钥PEM的环境变量
+	passEnv  string   // 保存私钥密码的环境变量
+	passFile string   // 保存私钥密码的文件
+	reqKey   string   // 解密req.dat的RSA私钥文件
+	retired  []string // 已轮换的历史RSA私钥文件
+}
+
+// loadSigningKey 按命令行参数或默认环境变量加载签名私钥，以及解密req.dat的RSA私钥，
+// 加载的密钥标识输出到w
+func loadSigningKey(opts keyOptions, w io.Writer) error {
+	password := ""
+	if opts.passEnv != "" {
+		password = os.Getenv(opts.passEnv)
+	}
+	if opts.passFile != "" {
+		data, err := os.ReadFile(opts.passFile)
+		if err != nil {
+			return fmt.Errorf("读取密码文件失败: %v", err)
+		}
+		password = strings.TrimRight(string(data), "\r\n")
+	}
+
+	var key crypto.Signer
+	var err error
+	switch {
+	case opts.file != "":
+		key, err = server.LoadSigningKeyFile(opts.file, password)
+	case opts.env != "":
+		key, err = server.LoadSigningKeyFromEnv(opts.env, password)
+	case os.Getenv(server.SigningKeyFileEnv) != "":
+		key, err = server.LoadSigningKeyFile(os.Getenv(server.SigningKeyFileEnv), password)
+	case os.Getenv(server.SigningKeyEnv) != "":
+		key, err = server.LoadSigningKeyFromEnv(server.SigningKeyEnv, password)
+	default:
+		return server.ErrNoSigningKey
+	}
+	if err != nil {
+		return err
+	}
+	if err := server.SetSigningKey(key); err != nil {
+		return err
+	}
+
+	if opts.reqKey != "" {
+		requestKey, err := server.LoadPrivateKeyFile(opts.reqKey, password)
+		if err != nil {
+			return fmt.Errorf("加载请求解密私钥失败: %v", err)
+		}
+		server.SetRequestKey(requestKey)
+	}
+
+	for _, path := range opts.retired {
+		retiredKey, err := server.LoadPrivateKeyFile(path, password)
+		if err != nil {
+			return fmt.Errorf("加载历史私钥 %s 失败: %v", path, err)
+		}
+		server.AddRetiredKey(retiredKey)
+	}
+
+	keyID, err := server.GetKeyID()
+	if err != nil {
+		return err
+	}
+	alg, _ := shared.SignatureAlgorithmForKey(key.Public())
+	fmt.Fprintf(w, "签名密钥: %s (%s)\n", keyID, alg)
+	return nil
+}
+
+// generateTrial 生成试用授权文件
+func generateTrial(output string, opts server.LicenseOptions) {
+	fmt.Printf("正在生成试用授权: %s 版，试用 %d 天\n", opts.Customer.Edition, opts.TrialDays)
+	fmt.Printf("激活期限: %d 天内首次运行有效\n", opts.Days)
+
+	license, err := server.IssueTrialLicense(output, opts)
+	if err != nil {
+		log.Fatal("生成试用授权文件失败:", err)
+	}
+
+	fmt.Printf("\n✓ 试用授权文件已生成: %s\n", output)
+	fmt.Println("请将此文件作为license.dat随评估版本分发，首次运行时开始计算试用期")
+	fmt.Println("每台机器只能试用一次")
+
+	fmt.Printf("\n试用包含的模块:\n")
+	printModules(license.Modules)
+}
+
+// generateAddon 生成增购授权文件
+func generateAddon(inputs []string, output string, opts server.LicenseOptions) {
+	addonSpec := opts.Addon
+	fmt.Printf("正在处理增购授权请求: %s\n", strings.Join(inputs, ", "))
+	fmt.Printf("基础授权序列号: %s\n", addonSpec.BaseSerial)
+	fmt.Printf("授权有效期: %d 天\n", opts.Days)
+
+	if _, err := server.IssueSiteLicense(inputs, output, opts); err != nil {
+		fatalIssueError("生成增购授权文件失败", err)
+	}
+
+	// 增购授权文件名必须匹配 addon*.dat，客户端才能自动加载
+	smartOutput := output
+	if output == "license.dat" {
+		smartOutput = generateSmartFilename(output, inputs[0], opts.Customer.Edition, opts.Customer.Name, "addon")
+		if err := os.Rename(output, smartOutput); err != nil {
+			log.Printf("重命名文件失败: %v，使用原文件名", err)
+			smartOutput = output
+		}
+	}
+
+	fmt.Printf("\n✓ 增购授权文件已生成: %s\n", smartOutput)
+	fmt.Println("请将此文件与license.dat放置在客户端的同一目录下")
+	if matched, _ := filepath.Match(shared.AddonFilePattern, filepath.Base(smartOutput)); !matched {
+		fmt.Printf("⚠️  文件名需匹配 %s 才能被客户端自动加载，请重命名后再分发\n", shared.AddonFilePattern)
+	}
+
+	if len(addonSpec.Modules) > 0 {
+		fmt.Printf("\n增购的模块:\n")
+		printModules(addonSpec.Modules)
+	}
+}
+
+// printModules 显示模块说明
+func printModules(modules []shared.LicenseModule) {
 	for _, module := range modules {
 		switch module {
 		case shared.ModuleAdmission:
@@ -155,8 +661,75 @@ func main() {
 	}
 }
 
+// claimFlag 可重复指定的 key=value 自定义声明参数
+type claimFlag map[string]interface{}
+
+func (c claimFlag) String() string {
+	var items []string
+	for key, value := range c {
+		items = append(items, fmt.Sprintf("%s=%v", key, value))
+	}
+	return strings.Join(items, ",")
+}
+
+func (c claimFlag) Set(value string) error {
+	key, raw, ok := strings.Cut(value, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return fmt.Errorf("声明格式应为 key=value: %s", value)
+	}
+	c[key] = raw
+	return nil
+}
+
+// claimJSONFlag 可重复指定的 key=JSON值 自定义声明参数，与claimFlag写入同一组声明
+type claimJSONFlag map[string]interface{}
+
+func (c claimJSONFlag) String() string {
+	return claimFlag(c).String()
+}
+
+func (c claimJSONFlag) Set(value string) error {
+	key, raw, ok := strings.Cut(value, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return fmt.Errorf("声明格式应为 key=JSON值: %s", value)
+	}
+	parsed, err := server.ParseClaimValue(raw)
+	if err != nil {
+		return err
+	}
+	c[key] = parsed
+	return nil
+}
+
+// listFlag 可重复指定、支持逗号分隔的命令行参数
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, splitList(value)...)
+	return nil
+}
+
+// splitList 解析逗号分隔的参数列表
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
 // generateSmartFilename 生成智能文件名
-func generateSmartFilename(originalOutput, inputFile string, edition shared.LicenseEdition, customer string) string {
+// fileType 为 license 或 addon，增购授权文件以addon开头以便客户端自动加载
+func generateSmartFilename(originalOutput, inputFile string, edition shared.LicenseEdition, customer string, fileType string) string {
 	// 如果用户明确指定了输出文件名（不是默认的license.dat），则保持用户指定的名称
 	if originalOutput != "license.dat" {
 		return originalOutput
@@ -199,6 +772,9 @@ func generateSmartFilename(originalOutput, inputFile string, edition shared.Lice
 	default:
 		editionPrefix = "NSC"
 	}
+	if fileType == "addon" {
+		editionPrefix = "NSA"
+	}
 
 	// 清理客户名称（移除特殊字符）
 	cleanCustomer := strings.ReplaceAll(customer, " ", "")
@@ -208,9 +784,9 @@ func generateSmartFilename(originalOutput, inputFile string, edition shared.Lice
 		cleanCustomer = "customer"
 	}
 
-	// 生成文件名：license_[版本]_[客户名]_[硬件ID]_[日期].dat
-	filename := fmt.Sprintf("license_%s_%s_%s_%s.dat",
-		editionPrefix, cleanCustomer, hwID, date)
+	// 生成文件名：[license|addon]_[版本]_[客户名]_[硬件ID]_[日期].dat
+	filename := fmt.Sprintf("%s_%s_%s_%s_%s.dat",
+		fileType, editionPrefix, cleanCustomer, hwID, date)
 
 	return filename
 }
\ No newline at end of file
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lengxu/golicense/server"
+	"github.com/lengxu/golicense/shared"
+)
+
+// reissueFlags renew和upgrade共用的参数
+type reissueFlags struct {
+	output     *string
+	ledgerPath *string
+	crlPath    *string
+	hardware   *string
+	issuer     *string
+	keys       keyOptions
+}
+
+// addReissueFlags 注册renew和upgrade共用的参数
+func addReissueFlags(fs *flag.FlagSet) *reissueFlags {
+	f := &reissueFlags{
+		output:     fs.String("o", "license.dat", "输出的license.dat文件路径"),
+		ledgerPath: fs.String("ledger", server.DefaultLedgerFile, "签发记录文件，用于按序列号查找原授权和记录新授权"),
+		crlPath:    fs.String("crl", shared.RevocationListFile, "吊销列表文件，已吊销的授权不能续订或升级"),
+		hardware:   fs.String("hw", "", "原授权绑定的硬件指纹，逗号分隔；仅在license.dat不在签发记录中时需要"),
+		issuer:     fs.String("issuer", currentUser(), "签发人，写入签发记录"),
+	}
+	fs.StringVar(&f.keys.file, "key", "", "签名私钥PEM文件")
+	fs.StringVar(&f.keys.env, "key-env", "", "从指定环境变量读取签名私钥PEM内容")
+	fs.StringVar(&f.keys.passEnv, "key-pass-env", server.SigningKeyPasswordEnv, "保存私钥密码的环境变量")
+	fs.StringVar(&f.keys.passFile, "key-pass-file", "", "保存私钥密码的文件")
+	fs.StringVar(&f.keys.reqKey, "req-key", "", "解密托管授权内容的RSA私钥PEM文件，签名私钥不是RSA时必需")
+	fs.Var((*listFlag)(&f.keys.retired), "retired-key", "已轮换的历史私钥PEM文件，可重复指定")
+	return f
+}
+
+// reissueInputHelp 原授权的指定方式说明
+const reissueInputHelp = `原授权可以用以下任一方式指定:
+  序列号           在签发记录中查找，如 NSE-1a2b3c4d5e6f
+  license.dat      客户现有的授权文件，在签发记录中有原文时按记录读取，否则需要 -hw
+  签发记录.json    签发记录文件中的一行，另存为JSON文件`
+
+// openReissueSource 加载密钥和签发记录，按参数找到要续订或升级的原授权
+func openReissueSource(f *reissueFlags, input string) (*server.IssuedLicense, *server.Ledger) {
+	if err := loadSigningKey(f.keys, os.Stdout); err != nil {
+		log.Fatal("加载签名私钥失败:", err)
+	}
+
+	var ledger *server.Ledger
+	if *f.ledgerPath != "" {
+		var err error
+		if ledger, err = server.OpenLedger(*f.ledgerPath); err != nil {
+			log.Fatal("打开签发记录失败:", err)
+		}
+	}
+
+	var issued *server.IssuedLicense
+	data, readErr := os.ReadFile(input)
+	switch {
+	case readErr == nil && strings.HasPrefix(strings.TrimSpace(string(data)), "{"):
+		var entry server.LedgerEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			log.Fatal("解析签发记录失败:", err)
+		}
+		var err error
+		if issued, err = server.LoadIssuedLicense(ledger, entry); err != nil {
+			log.Fatal("读取原授权失败:", err)
+		}
+	case readErr == nil:
+		var err error
+		if issued, err = server.ReadIssuedLicense(ledger, string(data), splitList(*f.hardware)); err != nil {
+			log.Fatal("读取原授权失败:", err)
+		}
+	default:
+		if !os.IsNotExist(readErr) {
+			log.Fatal("读取原授权失败:", readErr)
+		}
+		if ledger == nil {
+			log.Fatal("按序列号查找原授权需要签发记录 (-ledger)")
+		}
+		var err error
+		if issued, err = server.FindIssuedLicense(ledger, input); err != nil {
+			log.Fatal("查找原授权失败:", err)
+		}
+	}
+
+	// 已吊销的授权不能续订或升级
+	if crl, err := os.ReadFile(*f.crlPath); err == nil {
+		list, err := server.DecodeRevocationList(string(crl))
+		if err != nil {
+			log.Fatal("读取吊销列表失败:", err)
+		}
+		if revoked, ok := list.Find(issued.License.SerialNumber, shared.LicenseFileID(issued.License, issued.File)); ok {
+			log.Fatalf("授权 %s 已于 %s 吊销 (%s)", revoked.SerialNumber,
+				time.Unix(revoked.RevokedAt, 0).Format("2006-01-02"), revoked.Reason)
+		}
+	}
+
+	license := issued.License
+	fmt.Printf("原授权: %s，%s", license.SerialNumber, license.CustomerName)
+	if license.CustomerOrg != "" {
+		fmt.Printf(" (%s)", license.CustomerOrg)
+	}
+	fmt.Printf("，%s，到期 %s\n", license.Edition, time.Unix(issued.ExpiresAt, 0).Format("2006-01-02"))
+	return issued, ledger
+}
+
+// writeReissued 签发续订或升级后的授权并写入文件
+func writeReissued(f *reissueFlags, issued *server.IssuedLicense, ledger *server.Ledger, change server.LicenseChange) *server.License {
+	if dir := filepath.Dir(*f.output); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Fatal("创建输出目录失败:", err)
+		}
+	}
+	// 授权文件写入成功后才写入签发记录
+	license, _, err := server.ReissueLicense(issued, change, server.LicenseOptions{
+		Ledger: ledger,
+		Issuer: *f.issuer,
+		Deliver: func(encoded string) error {
+			if err := os.WriteFile(*f.output, []byte(encoded), 0644); err != nil {
+				return fmt.Errorf("failed to write license file: %v", err)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		log.Fatal("签发授权失败:", err)
+	}
+	if ledger == nil {
+		fmt.Println("注意: 未指定签发记录，本次签发没有记录")
+	}
+
+	fmt.Printf("\n✓ 授权文件已生成: %s\n", *f.output)
+	if license.SerialNumber != issued.License.SerialNumber {
+		fmt.Printf("  %s -> %s", issued.License.SerialNumber, license.SerialNumber)
+	} else {
+		fmt.Printf("  %s", license.SerialNumber)
+	}
+	fmt.Printf("，%s，到期时间 %s\n", license.Edition, time.Unix(license.ExpiresAt, 0).Format("2006-01-02"))
+	fmt.Println("请将此文件替换客户端原有的license.dat")
+	return license
+}
+
+// runRenew licgen renew 子命令：从原到期时间起续订授权
+func runRenew(args []string) {
+	fs := flag.NewFlagSet("renew", flag.ExitOnError)
+	var (
+		days  = fs.Int("d", 365, "续订天数，从原授权的到期时间（包括离线续期）开始计算")
+		until = fs.String("until", "", "续订到指定日期 (YYYY-MM-DD)，指定时忽略 -d")
+	)
+	f := addReissueFlags(fs)
+	fs.Usage = func() {
+		fmt.Println("licgen renew - 续订授权")
+		fmt.Println()
+		fmt.Println("用法:")
+		fmt.Println("  licgen renew [-d 天数 | -until YYYY-MM-DD] [选项] <序列号|license.dat|签发记录.json>")
+		fmt.Println()
+		fmt.Println("选项:")
+		fs.PrintDefaults()
+		fmt.Println()
+		fmt.Println(reissueInputHelp)
+		fmt.Println()
+		fmt.Println("续订不需要客户重新生成req.dat，新授权沿用原授权的硬件绑定、客户、版本、模块、配额和自定义声明，")
+		fmt.Println("序列号不变，只延长到期时间。到期时间从原到期时间起算，提前或逾期续订都不会改变续订周期。")
+		fmt.Println()
+		fmt.Println("示例:")
+		fmt.Println("  licgen renew -key signing_key.pem NSE-1a2b3c4d5e6f")
+		fmt.Println("  licgen renew -key signing_key.pem -d 730 -o renewed/license.dat license.dat")
+		fmt.Println("  licgen renew -key signing_key.pem -until 2028-06-30 NSE-1a2b3c4d5e6f")
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *until == "" && *days <= 0 {
+		log.Fatal("续订天数必须大于0")
+	}
+	issued, ledger := openReissueSource(f, fs.Arg(0))
+
+	var expiresAt time.Time
+	if *until != "" {
+		date, err := time.ParseInLocation("2006-01-02", *until, time.Local)
+		if err != nil {
+			log.Fatal("无效的日期:", *until)
+		}
+		expiresAt = date.Add(24*time.Hour - time.Second)
+	} else {
+		expiresAt = time.Unix(issued.ExpiresAt, 0).AddDate(0, 0, *days)
+	}
+	if expiresAt.Unix() <= issued.ExpiresAt {
+		log.Fatalf("续订后的到期时间 %s 早于原到期时间 %s", expiresAt.Format("2006-01-02"),
+			time.Unix(issued.ExpiresAt, 0).Format("2006-01-02"))
+	}
+
+	writeReissued(f, issued, ledger, server.LicenseChange{ExpiresAt: expiresAt.Unix()})
+}
+
+// runUpgrade licgen upgrade 子命令：升级授权版本或追加模块，到期时间不变
+func runUpgrade(args []string) {
+	fs := flag.NewFlagSet("upgrade", flag.ExitOnError)
+	var (
+		edition = fs.String("edition", "", "升级到的版本 (enterprise)")
+		modules = fs.String("modules", "", "追加的模块列表，逗号分隔")
+	)
+	f := addReissueFlags(fs)
+	fs.Usage = func() {
+		fmt.Println("licgen upgrade - 升级授权")
+		fmt.Println()
+		fmt.Println("用法:")
+		fmt.Println("  licgen upgrade [-edition enterprise] [-modules 模块,...] [选项] <序列号|license.dat|签发记录.json>")
+		fmt.Println()
+		fmt.Println("选项:")
+		fs.PrintDefaults()
+		fmt.Println()
+		fmt.Println(reissueInputHelp)
+		fmt.Println()
+		fmt.Println("升级不需要客户重新生成req.dat，新授权沿用原授权的硬件绑定、客户、自定义声明和到期时间。")
+		fmt.Println("基础版升级为旗舰版时模块、功能和配额换成旗舰版的默认值，保留原来额外购买的模块；")
+		fmt.Println("序列号随版本变化，原序列号在签发记录中结束，原授权的增购授权需要为新序列号重新签发。")
+		fmt.Println("只追加模块时序列号不变，也可以用 licgen -addon 签发增购授权而不替换license.dat。")
+		fmt.Println()
+		fmt.Println("示例:")
+		fmt.Println("  licgen upgrade -key signing_key.pem -edition enterprise NSB-1a2b3c4d5e6f")
+		fmt.Println("  licgen upgrade -key signing_key.pem -modules camera_scan license.dat")
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	var change server.LicenseChange
+	switch *edition {
+	case "":
+	case "basic", "b":
+		change.Edition = shared.EditionBasic
+	case "enterprise", "e":
+		change.Edition = shared.EditionEnterprise
+	default:
+		log.Fatal("无效的授权版本:", *edition, "。请使用 basic 或 enterprise")
+	}
+	for _, name := range splitList(*modules) {
+		module, ok := shared.ParseLicenseModule(name)
+		if !ok {
+			log.Fatal("无效的模块名称:", name)
+		}
+		change.Modules = append(change.Modules, module)
+	}
+	if change.Edition == "" && len(change.Modules) == 0 {
+		log.Fatal("请指定升级到的版本 (-edition) 或追加的模块 (-modules)")
+	}
+
+	issued, ledger := openReissueSource(f, fs.Arg(0))
+	previous := issued.License
+	if change.Edition == previous.Edition {
+		change.Edition = ""
+	}
+	var added []shared.LicenseModule
+	for _, module := range change.Modules {
+		if !containsModule(previous.Modules, module) {
+			added = append(added, module)
+		}
+	}
+	if change.Edition == "" && len(added) == 0 {
+		log.Fatal("原授权已包含指定的版本和模块，无需升级")
+	}
+
+	license := writeReissued(f, issued, ledger, change)
+	var gained []shared.LicenseModule
+	for _, module := range license.Modules {
+		if !containsModule(previous.Modules, module) {
+			gained = append(gained, module)
+		}
+	}
+	if len(gained) > 0 {
+		fmt.Printf("\n新增的模块:\n")
+		printModules(gained)
+	}
+
+	// 增购授权按序列号叠加在原授权上，序列号变化后需要重新签发
+	if ledger != nil && license.SerialNumber != previous.SerialNumber {
+		if addons := addonsOf(ledger, previous.SerialNumber); len(addons) > 0 {
+			fmt.Printf("\n⚠️  原授权的增购授权需要用 -addon %s 重新签发: %s\n",
+				license.SerialNumber, strings.Join(addons, ", "))
+		}
+	}
+}
+
+// addonsOf 签发记录中叠加在指定基础授权上的增购授权序列号
+func addonsOf(ledger *server.Ledger, baseSerial string) []string {
+	entries, err := ledger.Entries()
+	if err != nil {
+		log.Printf("查询增购授权失败: %v", err)
+		return nil
+	}
+	seen := make(map[string]bool)
+	var addons []string
+	for _, entry := range entries {
+		if entry.BaseSerial == baseSerial && !seen[entry.SerialNumber] {
+			seen[entry.SerialNumber] = true
+			addons = append(addons, entry.SerialNumber)
+		}
+	}
+	return addons
+}
+
+// containsModule 检查模块列表中是否包含指定模块
+func containsModule(modules []shared.LicenseModule, module shared.LicenseModule) bool {
+	for _, m := range modules {
+		if m == module {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lengxu/golicense/server"
+	"github.com/lengxu/golicense/shared"
+)
+
+// reportRow 报表中的一行，CSV和JSON输出使用相同的字段名
+type reportRow struct {
+	SerialNumber  string   `json:"serial_number"`
+	CustomerName  string   `json:"customer_name"`
+	CustomerOrg   string   `json:"customer_org"`
+	Edition       string   `json:"edition"`
+	LicenseType   string   `json:"license_type"`
+	Modules       []string `json:"modules"`
+	HardwareIDs   []string `json:"hardware_ids"`
+	IssuedAt      string   `json:"issued_at"`
+	ExpiresAt     string   `json:"expires_at"`
+	DaysRemaining int      `json:"days_remaining"`
+	Issuer        string   `json:"issuer"`
+}
+
+// reportColumns CSV表头，与reportRow字段顺序一致
+var reportColumns = []string{
+	"serial_number", "customer_name", "customer_org", "edition", "license_type",
+	"modules", "hardware_ids", "issued_at", "expires_at", "days_remaining", "issuer",
+}
+
+// runReport licgen report 子命令：按条件查询签发记录并输出报表
+func runReport(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	var (
+		ledgerPath = fs.String("ledger", server.DefaultLedgerFile, "签发记录文件")
+		customer   = fs.String("customer", "", "客户名称、组织或客户ID，名称和组织按子串匹配")
+		edition    = fs.String("edition", "", "授权版本 (basic|enterprise)")
+		module     = fs.String("module", "", "包含指定模块的授权")
+		licType    = fs.String("type", "", "授权类型 (standard|site|floating|trial|addon)，standard包括多机授权")
+		expiring   = fs.Int("expiring", 0, "只列出未来N天内到期的授权")
+		expired    = fs.Bool("expired", false, "包含已过期的授权")
+		format     = fs.String("format", "table", "输出格式 (table|csv|json)")
+		output     = fs.String("o", "", "输出文件，默认输出到标准输出")
+	)
+	fs.Usage = func() {
+		fmt.Println("licgen report - 签发记录查询与报表")
+		fmt.Println()
+		fmt.Println("用法:")
+		fmt.Println("  licgen report [选项]")
+		fmt.Println()
+		fmt.Println("选项:")
+		fs.PrintDefaults()
+		fmt.Println()
+		fmt.Println("同一序列号为同一客户重新签发过时只列出最后一次签发；同一机器签发给不同客户时分别列出。结果按到期时间升序排列。")
+		fmt.Println()
+		fmt.Println("示例:")
+		fmt.Println("  licgen report -customer ABC                            # 某客户的全部有效授权")
+		fmt.Println("  licgen report -expiring 30 -format csv -o renew.csv    # 30天内到期的续费清单")
+		fmt.Println("  licgen report -module camera_scan -edition basic       # 增购了摄像头扫描的基础版客户")
+		fmt.Println("  licgen report -expired -format json                    # 包含已过期授权，输出JSON")
+	}
+	fs.Parse(args)
+
+	if _, err := os.Stat(*ledgerPath); err != nil {
+		log.Fatal("读取签发记录失败:", err)
+	}
+	ledger, err := server.OpenLedger(*ledgerPath)
+	if err != nil {
+		log.Fatal("打开签发记录失败:", err)
+	}
+
+	query := server.LedgerQuery{
+		Customer:       *customer,
+		IncludeExpired: *expired,
+	}
+	switch *edition {
+	case "":
+	case "basic", "b":
+		query.Edition = shared.EditionBasic
+	case "enterprise", "e":
+		query.Edition = shared.EditionEnterprise
+	default:
+		log.Fatal("无效的授权版本:", *edition, "。请使用 basic 或 enterprise")
+	}
+	if *module != "" {
+		m, ok := shared.ParseLicenseModule(*module)
+		if !ok {
+			log.Fatal("无效的模块名称:", *module)
+		}
+		query.Module = m
+	}
+	switch *licType {
+	case "":
+	case "site":
+		query.SiteLicense = true
+	case string(shared.LicenseTypeStandard), string(shared.LicenseTypeFloating),
+		string(shared.LicenseTypeTrial), string(shared.LicenseTypeAddon):
+		query.LicenseType = shared.LicenseType(*licType)
+	default:
+		log.Fatal("无效的授权类型:", *licType, "。请使用 standard、site、floating、trial 或 addon")
+	}
+	if *expiring < 0 {
+		log.Fatal("到期天数不能为负数")
+	}
+	query.ExpiringWithin = time.Duration(*expiring) * 24 * time.Hour
+
+	entries, err := ledger.Query(query)
+	if err != nil {
+		log.Fatal("查询签发记录失败:", err)
+	}
+
+	now := time.Now()
+	rows := make([]reportRow, 0, len(entries))
+	for _, entry := range entries {
+		rows = append(rows, newReportRow(entry, now))
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatal("创建输出文件失败:", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	switch *format {
+	case "table":
+		err = writeReportTable(w, rows)
+	case "csv":
+		err = writeReportCSV(w, rows)
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(rows)
+	default:
+		log.Fatal("无效的输出格式:", *format, "。请使用 table、csv 或 json")
+	}
+	if err != nil {
+		log.Fatal("输出报表失败:", err)
+	}
+	if *output != "" {
+		fmt.Printf("✓ 已输出 %d 条授权记录: %s\n", len(rows), *output)
+	}
+}
+
+// newReportRow 将签发记录转换为报表行
+func newReportRow(entry server.LedgerEntry, now time.Time) reportRow {
+	modules := make([]string, 0, len(entry.Modules))
+	for _, m := range entry.Modules {
+		modules = append(modules, string(m))
+	}
+	return reportRow{
+		SerialNumber:  entry.SerialNumber,
+		CustomerName:  entry.CustomerName,
+		CustomerOrg:   entry.CustomerOrg,
+		Edition:       entry.Edition,
+		LicenseType:   entry.LicenseType,
+		Modules:       modules,
+		HardwareIDs:   entry.HardwareIDs,
+		IssuedAt:      time.Unix(entry.IssuedAt, 0).Format("2006-01-02"),
+		ExpiresAt:     time.Unix(entry.ExpiresAt, 0).Format("2006-01-02"),
+		DaysRemaining: entry.DaysRemaining(now),
+		Issuer:        entry.Issuer,
+	}
+}
+
+// writeReportTable 以对齐的表格输出报表
+func writeReportTable(w io.Writer, rows []reportRow) error {
+	if len(rows) == 0 {
+		_, err := fmt.Fprintln(w, "没有符合条件的授权记录")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "序列号\t客户\t组织\t版本\t类型\t模块\t签发日期\t到期日期\t剩余天数\t签发人")
+	for _, row := range rows {
+		remaining := strconv.Itoa(row.DaysRemaining)
+		if row.DaysRemaining < 0 {
+			remaining = "已过期"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			row.SerialNumber, row.CustomerName, row.CustomerOrg, row.Edition, row.LicenseType,
+			strings.Join(row.Modules, ","), row.IssuedAt, row.ExpiresAt, remaining, row.Issuer)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n共 %d 条授权记录\n", len(rows))
+	return err
+}
+
+// writeReportCSV 以CSV输出报表，列表字段用分号分隔
+func writeReportCSV(w io.Writer, rows []reportRow) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(reportColumns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := []string{
+			row.SerialNumber, row.CustomerName, row.CustomerOrg, row.Edition, row.LicenseType,
+			strings.Join(row.Modules, ";"), strings.Join(row.HardwareIDs, ";"),
+			row.IssuedAt, row.ExpiresAt, strconv.Itoa(row.DaysRemaining), row.Issuer,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
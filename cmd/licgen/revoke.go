@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/lengxu/golicense/server"
+	"github.com/lengxu/golicense/shared"
+)
+
+// runRevoke licgen revoke 子命令：将授权序列号加入签名的吊销列表
+func runRevoke(args []string) {
+	fs := flag.NewFlagSet("revoke", flag.ExitOnError)
+	var serials listFlag
+	fs.Var(&serials, "serial", "要吊销的授权序列号，可重复指定或用逗号分隔")
+	var (
+		reason     = fs.String("reason", "", "吊销原因 (refunded|compromised|superseded|fraud 或其他说明)")
+		crlPath    = fs.String("o", shared.RevocationListFile, "吊销列表文件，已存在时追加")
+		ledgerPath = fs.String("ledger", server.DefaultLedgerFile, "签发记录文件，用于核对序列号，为空时不核对")
+		list       = fs.Bool("list", false, "只列出吊销列表中的授权")
+		keyFile    = fs.String("key", "", "签名私钥PEM文件")
+		keyEnv     = fs.String("key-env", "", "从指定环境变量读取签名私钥PEM内容")
+		passEnv    = fs.String("key-pass-env", server.SigningKeyPasswordEnv, "保存私钥密码的环境变量")
+		passFile   = fs.String("key-pass-file", "", "保存私钥密码的文件")
+	)
+	fs.Usage = func() {
+		fmt.Println("licgen revoke - 吊销已签发的授权")
+		fmt.Println()
+		fmt.Println("用法:")
+		fmt.Println("  licgen revoke -serial <序列号> [-reason 原因] [选项]")
+		fmt.Println("  licgen revoke -list [-o revoked.dat]")
+		fmt.Println()
+		fmt.Println("选项:")
+		fs.PrintDefaults()
+		fmt.Println()
+		fmt.Println("吊销列表用当前签名私钥签名，序号每次递增。将生成的revoked.dat与授权文件放在同一目录，")
+		fmt.Println("或内置到程序中，客户端验证授权时会拒绝列表中的授权文件。")
+		fmt.Println()
+		fmt.Println("序列号由硬件指纹和版本计算，同一机器重新签发时不变。吊销只针对签发记录中该序列号已签发的")
+		fmt.Println("授权文件，之后为同一机器签发的授权（转售、迁回原机器、续订）不受影响；")
+		fmt.Println("签发记录中没有该序列号时吊销该序列号的全部授权。")
+		fmt.Println()
+		fmt.Println("示例:")
+		fmt.Println("  licgen revoke -key signing_key.pem -serial NSE-xxxxxxxxxxxx -reason refunded")
+		fmt.Println("  licgen revoke -key signing_key.pem -serial NSE-aaaa,NSB-bbbb -reason fraud")
+		fmt.Println("  licgen revoke -key signing_key.pem -list")
+	}
+	fs.Parse(args)
+
+	if !*list && len(serials) == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	if err := loadSigningKey(keyOptions{
+		file:     *keyFile,
+		env:      *keyEnv,
+		passEnv:  *passEnv,
+		passFile: *passFile,
+	}, os.Stdout); err != nil {
+		log.Fatal("加载签名私钥失败:", err)
+	}
+
+	if *list {
+		data, err := os.ReadFile(*crlPath)
+		if err != nil {
+			log.Fatal("读取吊销列表失败:", err)
+		}
+		revocations, err := server.DecodeRevocationList(string(data))
+		if err != nil {
+			log.Fatal("吊销列表无效:", err)
+		}
+		printRevocationList(revocations)
+		return
+	}
+
+	// 吊销记录绑定到签发记录中该序列号已签发的授权文件，之后为同一机器签发的授权不受影响；
+	// 序列号不在记录中时只能吊销该序列号的全部授权，旧授权可能签发于启用签发记录之前
+	var ledger *server.Ledger
+	if *ledgerPath != "" {
+		if _, err := os.Stat(*ledgerPath); err == nil {
+			if ledger, err = server.OpenLedger(*ledgerPath); err != nil {
+				log.Fatal("打开签发记录失败:", err)
+			}
+		}
+	}
+	var revoked []server.RevokedLicense
+	for _, serial := range serials {
+		var entries []server.LedgerEntry
+		if ledger != nil {
+			var err error
+			if entries, err = ledger.FindBySerial(serial); err != nil {
+				log.Fatal("查询签发记录失败:", err)
+			}
+		}
+		seen := make(map[string]bool)
+		for _, entry := range entries {
+			licenseID := entry.FileID()
+			if licenseID == "" || seen[licenseID] {
+				continue
+			}
+			seen[licenseID] = true
+			revoked = append(revoked, server.RevokedLicense{SerialNumber: serial, LicenseID: licenseID, Reason: *reason})
+		}
+		if len(seen) == 0 {
+			fmt.Printf("注意: 签发记录中没有序列号 %s 的授权文件，将吊销该序列号的全部授权，包括以后为同一机器签发的授权\n", serial)
+			revoked = append(revoked, server.RevokedLicense{SerialNumber: serial, Reason: *reason})
+			continue
+		}
+		entry := entries[len(entries)-1]
+		fmt.Printf("吊销 %s: %s", serial, entry.CustomerName)
+		if entry.CustomerOrg != "" {
+			fmt.Printf(" (%s)", entry.CustomerOrg)
+		}
+		fmt.Printf("，%s，到期 %s，%d 个授权文件\n", entry.Edition, time.Unix(entry.ExpiresAt, 0).Format("2006-01-02"), len(seen))
+	}
+
+	revocations, added, err := server.RevokeLicenses(*crlPath, revoked)
+	if err != nil {
+		log.Fatal("更新吊销列表失败:", err)
+	}
+	if added == 0 {
+		fmt.Println("指定的授权均已在吊销列表中，未修改", *crlPath)
+		return
+	}
+
+	fmt.Printf("\n✓ 已吊销 %d 个授权，吊销列表已更新: %s (序号 %d，共 %d 个)\n",
+		added, *crlPath, revocations.Sequence, len(revocations.Revoked))
+	fmt.Println("请将此文件放置到客户端授权文件所在目录，或随新版本内置发布")
+}
+
+// printRevocationList 输出吊销列表内容
+func printRevocationList(list *server.RevocationList) {
+	fmt.Printf("吊销列表序号: %d，发布时间: %s\n", list.Sequence, time.Unix(list.IssuedAt, 0).Format("2006-01-02 15:04:05"))
+	if len(list.Revoked) == 0 {
+		fmt.Println("没有被吊销的授权")
+		return
+	}
+	for _, entry := range list.Revoked {
+		licenseID := entry.LicenseID
+		if licenseID == "" {
+			licenseID = "全部授权文件"
+		}
+		fmt.Printf("  %s  %s  %s", entry.SerialNumber, licenseID, time.Unix(entry.RevokedAt, 0).Format("2006-01-02"))
+		if entry.Reason != "" {
+			fmt.Printf("  %s", entry.Reason)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("共 %d 个\n", len(list.Revoked))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lengxu/golicense/server"
+)
+
+// generateTransfer 凭原机器的停用回执为新机器签发迁移授权，并将原授权文件加入吊销列表
+func generateTransfer(inputs []string, output, receiptPath, crlPath string, maxTransfers int, opts server.LicenseOptions) {
+	if len(inputs) != 1 {
+		log.Fatal("授权迁移只能指定新机器的一个req.dat")
+	}
+	if opts.Ledger == nil {
+		log.Fatal("授权迁移需要签发记录核对原授权，请指定 -ledger")
+	}
+	receipt, err := server.ReadDeactivationReceipt(receiptPath)
+	if err != nil {
+		log.Fatal("读取停用回执失败:", err)
+	}
+	opts.Transfer = &server.TransferSpec{
+		Receipt:    receipt,
+		MaxPerYear: maxTransfers,
+	}
+
+	fmt.Printf("正在处理授权迁移: %s\n", inputs[0])
+	fmt.Printf("原授权序列号: %s\n", receipt.SerialNumber)
+	fmt.Printf("原机器: %s，停用于 %s\n", receipt.MachineInfo,
+		time.Unix(receipt.DeactivatedAt, 0).Format("2006-01-02 15:04:05"))
+
+	license, err := server.IssueSiteLicense(inputs, output, opts)
+	if err != nil {
+		fatalIssueError("生成迁移授权文件失败", err)
+	}
+
+	smartOutput := generateSmartFilename(output, inputs[0], license.Edition, license.CustomerName, "license")
+	if smartOutput != output {
+		if err := os.Rename(output, smartOutput); err != nil {
+			log.Printf("重命名文件失败: %v，使用原文件名", err)
+			smartOutput = output
+		}
+	}
+
+	fmt.Printf("\n✓ 迁移授权文件已生成: %s\n", smartOutput)
+	fmt.Printf("  %s -> %s，到期时间 %s\n", receipt.SerialNumber, license.SerialNumber,
+		time.Unix(license.ExpiresAt, 0).Format("2006-01-02"))
+	fmt.Println("请将此文件放置到新机器的goweb/bin/目录下")
+
+	// 增购授权按序列号叠加在原授权上，迁移后需要为新序列号重新签发
+	if addons := addonsOf(opts.Ledger, receipt.SerialNumber); len(addons) > 0 {
+		fmt.Printf("\n⚠️  原授权的增购授权需要用 -addon %s 为新机器重新签发: %s\n",
+			license.SerialNumber, strings.Join(addons, ", "))
+	}
+
+
+	// 原机器的停用记录可以被删除，吊销原授权文件才能保证它不能再使用
+	revoked, err := opts.Transfer.Revocation()
+	if err != nil {
+		log.Fatalf("迁移授权已生成，但吊销原授权失败: %v\n请执行 licgen revoke -serial %s -reason superseded", err, receipt.SerialNumber)
+	}
+	revocations, _, err := server.RevokeLicenses(crlPath, []server.RevokedLicense{revoked})
+	if err != nil {
+		log.Fatalf("迁移授权已生成，但更新吊销列表失败: %v\n请执行 licgen revoke -serial %s -reason superseded", err, receipt.SerialNumber)
+	}
+	fmt.Printf("\n✓ 原授权文件已加入吊销列表: %s (序号 %d)\n", crlPath, revocations.Sequence)
+	fmt.Println("请随新版本发布或分发该吊销列表，原授权文件在其他机器上也将失效")
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/lengxu/golicense/server"
+	"github.com/lengxu/golicense/shared"
+)
+
+func main() {
+	var (
+		addr         = flag.String("addr", ":8443", "监听地址")
+		entitlements = flag.String("entitlements", "entitlements.json", "授权标识文件 (JSON数组)")
+		ledgerPath   = flag.String("ledger", server.DefaultLedgerFile, "签发记录文件")
+		crlPath      = flag.String("crl", "", "吊销列表文件，续期和状态查询时检查")
+		maxAge       = flag.Duration("max-req-age", 24*time.Hour, "req.dat的最长有效期，0表示不限制")
+		tlsCert      = flag.String("tls-cert", "", "TLS证书文件，与 -tls-key 同时指定时启用HTTPS")
+		tlsKey       = flag.String("tls-key", "", "TLS私钥文件")
+		keyFile      = flag.String("key", "", "签名私钥PEM文件")
+		keyEnv       = flag.String("key-env", "", "从指定环境变量读取签名私钥PEM内容")
+		passEnv      = flag.String("key-pass-env", server.SigningKeyPasswordEnv, "保存私钥密码的环境变量")
+		reqKey       = flag.String("req-key", "", "解密req.dat的RSA私钥PEM文件，签名私钥不是RSA时必需")
+		codeSecret   = flag.String("code-secret", "", "激活码密钥文件，指定后可兑换licgen codes生成的激活码")
+		help         = flag.Bool("h", false, "显示帮助信息")
+	)
+	flag.Parse()
+
+	if *help {
+		fmt.Println("licserver - 在线授权服务器")
+		fmt.Println()
+		fmt.Println("用法:")
+		fmt.Println("  licserver -key signing_key.pem -entitlements entitlements.json [选项]")
+		fmt.Println()
+		fmt.Println("选项:")
+		flag.PrintDefaults()
+		fmt.Println()
+		fmt.Println("接口:")
+		fmt.Printf("  POST %s  {\"entitlement\":\"...\",\"request\":\"REQ:...\"}  按授权标识激活\n", shared.APIActivatePath)
+		fmt.Printf("  POST %s  {\"activation_code\":\"...\",\"request\":\"REQ:...\"}  兑换激活码\n", shared.APIActivatePath)
+		fmt.Printf("  POST %s     {\"request\":\"REQ:...\"}                     下载续期授权\n", shared.APIRenewPath)
+		fmt.Printf("  GET  %s?serial=NSE-xxxx                              查询授权状态\n", shared.APIStatusPath)
+		fmt.Println("  GET  /healthz                                                 健康检查")
+		fmt.Println()
+		fmt.Println("授权标识文件示例:")
+		fmt.Println(`  [{"id":"ENT-7Q2K9XW4RT","customer":"张三","org":"ABC公司","edition":"enterprise",`)
+		fmt.Println(`    "expires":"2027-12-31","days":365,"seats":5}]`)
+		fmt.Println("  文件修改后自动重新加载；延长 expires 后客户端可通过续期接口获得新授权")
+		return
+	}
+
+	if err := loadKeys(*keyFile, *keyEnv, os.Getenv(*passEnv), *reqKey); err != nil {
+		log.Fatal("加载签名私钥失败:", err)
+	}
+
+	var err error
+	switch {
+	case *codeSecret != "":
+		err = server.LoadActivationSecretFile(*codeSecret)
+	case os.Getenv(server.ActivationSecretEnv) != "":
+		err = server.LoadActivationSecretFromEnv(server.ActivationSecretEnv)
+	}
+	if err != nil {
+		log.Fatal("加载激活码密钥失败:", err)
+	}
+
+	store, err := server.LoadEntitlements(*entitlements)
+	if err != nil {
+		log.Fatal("加载授权标识失败:", err)
+	}
+	ledger, err := server.OpenLedger(*ledgerPath)
+	if err != nil {
+		log.Fatal("打开签发记录失败:", err)
+	}
+
+	licenseServer := server.NewLicenseServer(store, ledger)
+	licenseServer.RevocationList = *crlPath
+	licenseServer.MaxRequestAge = *maxAge
+	licenseServer.Logger = log.New(os.Stderr, "licserver ", log.LstdFlags)
+
+	httpServer := &http.Server{
+		Addr:              *addr,
+		Handler:           licenseServer.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(ctx)
+	}()
+
+	useTLS := *tlsCert != "" && *tlsKey != ""
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	fmt.Printf("授权服务器已启动: %s://%s\n", scheme, *addr)
+	if !useTLS {
+		fmt.Println("注意: 未启用TLS，仅适合本地测试或置于HTTPS反向代理之后")
+	}
+
+	if useTLS {
+		err = httpServer.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal("授权服务器异常退出:", err)
+	}
+}
+
+// loadKeys 加载签名私钥和解密req.dat的RSA私钥
+func loadKeys(file, env, password, reqKey string) error {
+	var key crypto.Signer
+	var err error
+	switch {
+	case file != "":
+		key, err = server.LoadSigningKeyFile(file, password)
+	case env != "":
+		key, err = server.LoadSigningKeyFromEnv(env, password)
+	case os.Getenv(server.SigningKeyFileEnv) != "":
+		key, err = server.LoadSigningKeyFile(os.Getenv(server.SigningKeyFileEnv), password)
+	case os.Getenv(server.SigningKeyEnv) != "":
+		key, err = server.LoadSigningKeyFromEnv(server.SigningKeyEnv, password)
+	default:
+		return server.ErrNoSigningKey
+	}
+	if err != nil {
+		return err
+	}
+	if err := server.SetSigningKey(key); err != nil {
+		return err
+	}
+
+	if reqKey != "" {
+		requestKey, err := server.LoadPrivateKeyFile(reqKey, password)
+		if err != nil {
+			return fmt.Errorf("加载请求解密私钥失败: %v", err)
+		}
+		server.SetRequestKey(requestKey)
+	}
+	if _, err := server.GetPrivateKey(); err != nil {
+		return fmt.Errorf("%v (请用 -req-key 指定解密req.dat的RSA私钥)", err)
+	}
+
+	keyID, err := server.GetKeyID()
+	if err != nil {
+		return err
+	}
+	alg, _ := shared.SignatureAlgorithmForKey(key.Public())
+	fmt.Printf("签名密钥: %s (%s)\n", keyID, alg)
+	return nil
+}
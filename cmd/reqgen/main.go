@@ -8,11 +8,13 @@ import (
 	"path/filepath"
 
 	"github.com/lengxu/golicense/client"
+	"github.com/lengxu/golicense/shared"
 )
 
 func main() {
 	var (
 		output = flag.String("o", "req.dat", "输出文件路径")
+		code   = flag.String("code", "", "购买时获得的激活码")
 		help   = flag.Bool("h", false, "显示帮助信息")
 	)
 	flag.Parse()
@@ -26,14 +28,30 @@ func main() {
 		fmt.Println("选项:")
 		fmt.Println("  -o string")
 		fmt.Println("        输出文件路径 (默认 \"req.dat\")")
+		fmt.Println("  -code string")
+		fmt.Println("        购买时获得的激活码，授权方将按激活码内容签发授权")
 		fmt.Println("  -h    显示帮助信息")
 		fmt.Println()
 		fmt.Println("示例:")
 		fmt.Println("  reqgen                    # 生成 req.dat")
 		fmt.Println("  reqgen -o request.dat     # 生成 request.dat")
+		fmt.Println("  reqgen -code XXXXX-XXXXX-...  # 生成带激活码的 req.dat")
 		return
 	}
 
+	// 提前检查激活码，避免输入错误的激活码被发送给授权方
+	if *code != "" {
+		activation, err := client.DecodeActivationCode(*code)
+		if err != nil {
+			log.Fatal("激活码无效，请检查是否输入正确: ", err)
+		}
+		fmt.Printf("激活码: %s版，%d 天", activation.Edition, activation.Days)
+		if activation.Seats > 0 {
+			fmt.Printf("，最多 %d 台机器", activation.Seats)
+		}
+		fmt.Println()
+	}
+
 	// 确保输出目录存在
 	outputDir := filepath.Dir(*output)
 	if outputDir != "." {
@@ -48,10 +66,11 @@ func main() {
 	fmt.Printf("机器信息: %s\n", client.GetMachineInfo())
 	
 	fmt.Println("正在生成授权请求文件...")
-	if err := client.GenerateRequest(*output); err != nil {
+	if err := client.GenerateRequestWithCode(*output, *code); err != nil {
 		log.Fatal("生成请求文件失败:", err)
 	}
 
 	fmt.Printf("\n✓ 授权请求文件已生成: %s\n", *output)
 	fmt.Println("请将此文件发送给授权服务端以获取license.dat")
+	fmt.Printf("请保留同目录下的 %s，license.dat需放在该目录中才能解密\n", shared.InstallationKeyFile)
 }
\ No newline at end of file
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lengxu/golicense/shared"
+)
+
+// 激活码密钥的默认位置
+const (
+	ActivationSecretEnv         = "GOLICENSE_ACTIVATION_SECRET" // 激活码密钥(hex)
+	DefaultActivationSecretFile = "activation_secret.key"       // 激活码密钥文件
+)
+
+// activationSecretSize 新生成的激活码密钥字节数
+const activationSecretSize = 32
+
+// ErrNoActivationSecret 未加载激活码密钥
+var ErrNoActivationSecret = errors.New("no activation code secret configured")
+
+// ErrActivationCodeExhausted 激活码已在允许的最大机器数上激活
+var ErrActivationCodeExhausted = errors.New("activation code has already been redeemed on the maximum number of machines")
+
+// ErrActivationCodeExpired 本机首次兑换激活码获得的授权已到期，不能再次兑换
+var ErrActivationCodeExpired = errors.New("the license redeemed with this activation code on this machine has expired")
+
+// InvalidActivationCodeError 激活码无效（输入错误或伪造）
+type InvalidActivationCodeError struct {
+	Reason string
+}
+
+// Error 实现error接口
+func (e *InvalidActivationCodeError) Error() string {
+	return "invalid activation code: " + e.Reason
+}
+
+var (
+	activationSecretMu sync.RWMutex
+	activationSecret   []byte
+)
+
+// SetActivationSecret 设置生成和验证激活码的HMAC密钥
+func SetActivationSecret(secret []byte) error {
+	if len(secret) < 16 {
+		return errors.New("activation code secret must be at least 16 bytes")
+	}
+	activationSecretMu.Lock()
+	defer activationSecretMu.Unlock()
+	activationSecret = append([]byte(nil), secret...)
+	return nil
+}
+
+// getActivationSecret 获取激活码密钥
+func getActivationSecret() ([]byte, error) {
+	activationSecretMu.RLock()
+	defer activationSecretMu.RUnlock()
+	if activationSecret == nil {
+		return nil, ErrNoActivationSecret
+	}
+	return activationSecret, nil
+}
+
+// LoadActivationSecretFile 从文件加载hex编码的激活码密钥
+func LoadActivationSecretFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read activation code secret: %v", err)
+	}
+	return loadActivationSecretHex(string(data))
+}
+
+// LoadActivationSecretFromEnv 从环境变量加载hex编码的激活码密钥
+func LoadActivationSecretFromEnv(envName string) error {
+	value := os.Getenv(envName)
+	if value == "" {
+		return fmt.Errorf("environment variable %s is not set", envName)
+	}
+	return loadActivationSecretHex(value)
+}
+
+// loadActivationSecretHex 解析hex编码的激活码密钥
+func loadActivationSecretHex(value string) error {
+	secret, err := hex.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("invalid activation code secret: %v", err)
+	}
+	return SetActivationSecret(secret)
+}
+
+// CreateActivationSecretFile 生成新的激活码密钥并保存到文件，文件已存在时返回错误
+func CreateActivationSecretFile(path string) error {
+	secret := make([]byte, activationSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return fmt.Errorf("failed to generate activation code secret: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create activation code secret: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(hex.EncodeToString(secret) + "\n"); err != nil {
+		return fmt.Errorf("failed to write activation code secret: %v", err)
+	}
+	return SetActivationSecret(secret)
+}
+
+// GenerateActivationCode 生成激活码，并把随机生成的激活码标识写入code.ID
+func GenerateActivationCode(code *ActivationCode) (string, error) {
+	secret, err := getActivationSecret()
+	if err != nil {
+		return "", err
+	}
+
+	id := make([]byte, shared.ActivationIDSize)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate activation code id: %v", err)
+	}
+	payload, err := shared.MarshalActivationPayload(code, id)
+	if err != nil {
+		return "", err
+	}
+
+	sealed := shared.SealActivationCode(payload, activationMAC(secret, payload))
+	code.ID = hex.EncodeToString(id)
+	return shared.FormatActivationCode(Base58Encode(sealed)), nil
+}
+
+// ParseActivationCode 解析并验证激活码，确认由持有激活码密钥的一方生成
+func ParseActivationCode(code string) (*ActivationCode, error) {
+	secret, err := getActivationSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := Base58Decode(shared.NormalizeActivationCode(code))
+	if err != nil {
+		return nil, &InvalidActivationCodeError{Reason: "contains invalid characters"}
+	}
+	payload, mac, err := shared.OpenActivationCode(sealed)
+	if err != nil {
+		return nil, &InvalidActivationCodeError{Reason: err.Error()}
+	}
+	if !hmac.Equal(mac, activationMAC(secret, payload)[:len(mac)]) {
+		return nil, &InvalidActivationCodeError{Reason: "not issued with this activation code secret"}
+	}
+
+	parsed, err := shared.ParseActivationPayload(payload)
+	if err != nil {
+		return nil, &InvalidActivationCodeError{Reason: err.Error()}
+	}
+	return parsed, nil
+}
+
+// activationMAC 计算激活码载荷的HMAC
+func activationMAC(secret, payload []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(shared.ActivationMACInput(payload))
+	return mac.Sum(nil)
+}
+
+// applyActivationCode 按激活码设置签发选项，并检查激活码的可激活机器数
+// 未指定激活码时使用请求中客户输入的激活码；都没有时不做任何修改
+func applyActivationCode(opts *LicenseOptions, requests []*LicenseRequest) error {
+	codeText := opts.ActivationCode
+	if codeText == "" {
+		for _, request := range requests {
+			if request.ActivationCode == "" {
+				continue
+			}
+			if codeText != "" && codeText != request.ActivationCode {
+				return errors.New("requests contain different activation codes")
+			}
+			codeText = request.ActivationCode
+		}
+	}
+	if codeText == "" {
+		return nil
+	}
+
+	if opts.Addon != nil {
+		return errors.New("activation codes cannot be redeemed for add-on licenses")
+	}
+	if len(requests) != 1 {
+		return errors.New("an activation code is redeemed by one machine at a time")
+	}
+	if opts.Ledger == nil {
+		return errors.New("redeeming activation codes requires a ledger")
+	}
+
+	code, err := ParseActivationCode(codeText)
+	if err != nil {
+		return err
+	}
+
+	entries, err := opts.Ledger.FindByActivationCode(code.ID)
+	if err != nil {
+		return err
+	}
+	hardwareID := requests[0].HardwareID
+	activated := make(map[string]bool)
+	var first *LedgerEntry
+	for i, entry := range entries {
+		for _, id := range entry.HardwareIDs {
+			activated[id] = true
+			if id == hardwareID && first == nil {
+				first = &entries[i]
+			}
+		}
+	}
+	if first == nil && code.Seats > 0 && len(activated) >= code.Seats {
+		return ErrActivationCodeExhausted
+	}
+
+	opts.Days = code.Days
+	// 同一台机器重新兑换同一个激活码（如重装）视为重新签发，有效期不超过首次兑换的授权
+	if first != nil {
+		days := int((first.ExpiresAt - time.Now().Unix() + 86399) / 86400)
+		if days < 1 {
+			return ErrActivationCodeExpired
+		}
+		opts.Reissue = true
+		opts.Days = days
+	}
+	opts.Customer.Edition = code.Edition
+	opts.Modules = code.Modules
+	opts.MaxSeats = 0
+	opts.activationID = code.ID
+	return nil
+}
@@ -1,14 +1,21 @@
 package server
 
 import (
+	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"math/big"
+
+	"github.com/lengxu/golicense/shared"
 )
 
 // RSAEncrypt RSA加密
@@ -29,13 +36,84 @@ func RSASign(data interface{}, privateKey *rsa.PrivateKey) ([]byte, error) {
 		return nil, err
 	}
 	
+	return RSASignBytes(jsonData, privateKey)
+}
+
+// RSASignBytes 对原始字节进行RSA签名
+func RSASignBytes(data []byte, privateKey *rsa.PrivateKey) ([]byte, error) {
 	// 计算hash
-	hashed := sha256.Sum256(jsonData)
+	hashed := sha256.Sum256(data)
 	
 	// 签名
 	return rsa.SignPKCS1v15(rand.Reader, privateKey, 0, hashed[:])
 }
 
+// SignBytes 按私钥类型对原始字节签名，返回签名和签名算法标识
+func SignBytes(data []byte, key crypto.Signer) ([]byte, string, error) {
+	alg, err := shared.SignatureAlgorithmForKey(key.Public())
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		signature, err := RSASignBytes(data, k)
+		return signature, alg, err
+	case ed25519.PrivateKey:
+		return ed25519.Sign(k, data), alg, nil
+	case *ecdsa.PrivateKey:
+		// ES256使用定长的r||s编码，比ASN.1编码更短且长度固定
+		hashed := sha256.Sum256(data)
+		r, s, err := ecdsa.Sign(rand.Reader, k, hashed[:])
+		if err != nil {
+			return nil, "", err
+		}
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signature, alg, nil
+	default:
+		// 其他实现了crypto.Signer的密钥（如HSM）
+		switch alg {
+		case shared.SignatureEdDSA:
+			signature, err := key.Sign(rand.Reader, data, crypto.Hash(0))
+			return signature, alg, err
+		case shared.SignatureRS256:
+			hashed := sha256.Sum256(data)
+			signature, err := key.Sign(rand.Reader, hashed[:], crypto.SHA256)
+			return signature, alg, err
+		default:
+			return nil, "", fmt.Errorf("%s signing requires an in-memory private key", alg)
+		}
+	}
+}
+
+// VerifySignature 按签名算法验证原始字节的签名，用于检查服务端自己签发的文件
+func VerifySignature(algorithm string, data []byte, signature []byte, publicKey crypto.PublicKey) bool {
+	keyAlgorithm, err := shared.SignatureAlgorithmForKey(publicKey)
+	if err != nil || keyAlgorithm != shared.NormalizeSignatureAlgorithm(algorithm) {
+		return false
+	}
+
+	hashed := sha256.Sum256(data)
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		// 与RSASignBytes一致，签名时未附加DigestInfo
+		return rsa.VerifyPKCS1v15(key, 0, hashed[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	case *ecdsa.PublicKey:
+		if len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(key, hashed[:], r, s)
+	default:
+		return false
+	}
+}
+
 // GenerateAESKey 生成AES密钥
 func GenerateAESKey() []byte {
 	key := make([]byte, 32) // AES-256
@@ -53,6 +131,11 @@ func AESEncrypt(data interface{}, key []byte) ([]byte, error) {
 		return nil, err
 	}
 	
+	return AESEncryptBytes(jsonData, key)
+}
+
+// AESEncryptBytes AES加密原始字节
+func AESEncryptBytes(plaintext []byte, key []byte) ([]byte, error) {
 	// 创建AES cipher
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -72,40 +155,67 @@ func AESEncrypt(data interface{}, key []byte) ([]byte, error) {
 	}
 	
 	// 加密
-	ciphertext := gcm.Seal(nonce, nonce, jsonData, nil)
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
 	return ciphertext, nil
 }
 
+// AESEncryptBytesWithAAD AES-GCM加密，附加数据参与认证但不加密
+func AESEncryptBytesWithAAD(plaintext []byte, key []byte, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
 // AESDecrypt AES解密
 func AESDecrypt(ciphertext []byte, key []byte, result interface{}) error {
+	plaintext, err := AESDecryptBytes(ciphertext, key)
+	if err != nil {
+		return err
+	}
+	
+	// 反序列化
+	return json.Unmarshal(plaintext, result)
+}
+
+// AESDecryptBytes AES解密为原始字节
+func AESDecryptBytes(ciphertext []byte, key []byte) ([]byte, error) {
+	return AESDecryptBytesWithAAD(ciphertext, key, nil)
+}
+
+// AESDecryptBytesWithAAD AES-GCM解密，附加数据必须与加密时一致
+func AESDecryptBytesWithAAD(ciphertext []byte, key []byte, additionalData []byte) ([]byte, error) {
 	// 创建AES cipher
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	
 	// 创建GCM模式
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	
 	nonceSize := gcm.NonceSize()
 	if len(ciphertext) < nonceSize {
-		return errors.New("ciphertext too short")
+		return nil, errors.New("ciphertext too short")
 	}
 	
 	// 提取nonce和密文
 	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
 	
 	// 解密
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return err
-	}
-	
-	// 反序列化
-	return json.Unmarshal(plaintext, result)
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
 }
 
 // SHA256Hash 计算SHA256哈希
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lengxu/golicense/shared"
+)
+
+// defaultEntitlementDays 授权标识未指定天数时每次签发的授权有效期
+const defaultEntitlementDays = 365
+
+// Entitlement 预先开通的授权，客户凭授权标识在线激活，无需人工运行licgen
+type Entitlement struct {
+	ID       string                 `json:"id"`                 // 授权标识，发给客户用于激活，应足够长且随机
+	Customer string                 `json:"customer"`           // 客户名称
+	Org      string                 `json:"org,omitempty"`      // 客户组织
+	Edition  shared.LicenseEdition  `json:"edition"`            // 授权版本
+	Expires  string                 `json:"expires"`            // 授权截止日期 (YYYY-MM-DD)，延长后客户端可在线续期
+	Days     int                    `json:"days,omitempty"`     // 每次签发的授权最长天数，默认365
+	Seats    int                    `json:"seats,omitempty"`    // 可激活的机器数，0表示不限制
+	Claims   map[string]interface{} `json:"claims,omitempty"`   // 自定义声明
+	Disabled bool                   `json:"disabled,omitempty"` // 是否停用，停用后不能激活和续期
+}
+
+// ExpiresAt 授权截止时间，截止日期当天结束时过期
+func (e *Entitlement) ExpiresAt() (time.Time, error) {
+	date, err := time.ParseInLocation("2006-01-02", e.Expires, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("entitlement %s has an invalid expiry date %q", e.ID, e.Expires)
+	}
+	return date.AddDate(0, 0, 1), nil
+}
+
+// LicenseOptions 按当前时间计算签发选项，授权有效期不超过截止日期
+func (e *Entitlement) LicenseOptions(now time.Time) (LicenseOptions, error) {
+	expiresAt, err := e.ExpiresAt()
+	if err != nil {
+		return LicenseOptions{}, err
+	}
+	if !now.Before(expiresAt) {
+		return LicenseOptions{}, fmt.Errorf("entitlement %s expired on %s", e.ID, e.Expires)
+	}
+
+	days := e.Days
+	if days <= 0 {
+		days = defaultEntitlementDays
+	}
+	if remaining := int(expiresAt.Sub(now).Hours() / 24); remaining < days {
+		days = remaining
+	}
+	if days < 1 {
+		days = 1
+	}
+
+	return LicenseOptions{
+		Days: days,
+		Customer: CustomerInfo{
+			Name:    e.Customer,
+			Org:     e.Org,
+			Edition: e.Edition,
+		},
+		Claims:      e.Claims,
+		Entitlement: e.ID,
+	}, nil
+}
+
+// validate 检查授权标识配置
+func (e *Entitlement) validate() error {
+	if e.ID == "" {
+		return fmt.Errorf("entitlement has no id")
+	}
+	switch e.Edition {
+	case shared.EditionBasic, shared.EditionEnterprise:
+	default:
+		return fmt.Errorf("entitlement %s has an invalid edition %q", e.ID, e.Edition)
+	}
+	if e.Seats < 0 || e.Days < 0 {
+		return fmt.Errorf("entitlement %s has a negative seat count or duration", e.ID)
+	}
+	_, err := e.ExpiresAt()
+	return err
+}
+
+// EntitlementStore 从JSON文件加载的授权标识，文件修改后自动重新加载
+type EntitlementStore struct {
+	path    string
+	mu      sync.Mutex
+	modTime time.Time
+	byID    map[string]*Entitlement
+}
+
+// LoadEntitlements 加载授权标识文件，文件内容为Entitlement数组
+func LoadEntitlements(path string) (*EntitlementStore, error) {
+	store := &EntitlementStore{path: path}
+	if err := store.reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Get 获取授权标识，文件有修改时先重新加载；重新加载失败时继续使用已加载的内容
+func (s *EntitlementStore) Get(id string) (*Entitlement, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if info, err := os.Stat(s.path); err == nil && !info.ModTime().Equal(s.modTime) {
+		s.reloadLocked()
+	}
+	entitlement, ok := s.byID[id]
+	if !ok {
+		return nil, false
+	}
+	copied := *entitlement
+	return &copied, true
+}
+
+// reload 加载授权标识文件
+func (s *EntitlementStore) reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reloadLocked()
+}
+
+// reloadLocked 加载授权标识文件，调用方需持有锁
+func (s *EntitlementStore) reloadLocked() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read entitlements: %v", err)
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read entitlements: %v", err)
+	}
+
+	var entitlements []Entitlement
+	if err := json.Unmarshal(data, &entitlements); err != nil {
+		return fmt.Errorf("failed to parse entitlements: %v", err)
+	}
+	byID := make(map[string]*Entitlement, len(entitlements))
+	for i := range entitlements {
+		entitlement := &entitlements[i]
+		if err := entitlement.validate(); err != nil {
+			return err
+		}
+		if _, ok := byID[entitlement.ID]; ok {
+			return fmt.Errorf("duplicate entitlement id %s", entitlement.ID)
+		}
+		byID[entitlement.ID] = entitlement
+	}
+
+	s.byID = byID
+	s.modTime = info.ModTime()
+	return nil
+}
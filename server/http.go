@@ -0,0 +1,428 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lengxu/golicense/shared"
+)
+
+// maxAPIRequestSize 接口请求体的最大字节数
+const maxAPIRequestSize = 1 << 20
+
+// LicenseServer 授权服务器，通过HTTP接口按预先开通的授权标识在线签发授权
+// 签名私钥需在创建前通过SetSigningKey等函数加载
+type LicenseServer struct {
+	Entitlements   *EntitlementStore // 授权标识
+	Ledger         *Ledger           // 签发记录，用于统计已激活的机器和下载续期授权
+	RevocationList string            // 吊销列表文件路径，为空时不检查吊销
+	MaxRequestAge  time.Duration     // req.dat的最长有效期，0表示不限制
+	Issuer         string            // 写入签发记录的签发人
+	Logger         *log.Logger       // 访问日志，为空时不输出
+
+	mu sync.Mutex // 串行化签发，保证机器数统计与签发记录一致
+}
+
+// NewLicenseServer 创建授权服务器
+func NewLicenseServer(entitlements *EntitlementStore, ledger *Ledger) *LicenseServer {
+	return &LicenseServer{
+		Entitlements: entitlements,
+		Ledger:       ledger,
+		Issuer:       "licserver",
+	}
+}
+
+// Handler 返回授权服务器的HTTP处理器
+func (s *LicenseServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(shared.APIActivatePath, s.handleActivate)
+	mux.HandleFunc(shared.APIRenewPath, s.handleRenew)
+	mux.HandleFunc(shared.APIStatusPath, s.handleStatus)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	return mux
+}
+
+// handleActivate 按授权标识为请求中的机器签发授权
+// 同一机器再次激活时重新签发（例如重装后安装密钥变化），不占用新的机器数
+func (s *LicenseServer) handleActivate(w http.ResponseWriter, r *http.Request) {
+	body, request, ok := s.readActivation(w, r)
+	if !ok {
+		return
+	}
+	if body.Entitlement == "" && (body.ActivationCode != "" || request.ActivationCode != "") {
+		s.redeemActivationCode(w, r, body, request)
+		return
+	}
+
+	entitlement, found := s.Entitlements.Get(body.Entitlement)
+	if !found {
+		s.writeError(w, r, http.StatusNotFound, shared.APIErrorUnknownEntitlement, "unknown entitlement")
+		return
+	}
+	if entitlement.Disabled {
+		s.writeError(w, r, http.StatusForbidden, shared.APIErrorEntitlementDisabled, "entitlement is disabled")
+		return
+	}
+	opts, err := entitlement.LicenseOptions(time.Now())
+	if err != nil {
+		s.writeError(w, r, http.StatusForbidden, shared.APIErrorEntitlementDisabled, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.Ledger.FindByEntitlement(entitlement.ID)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	// 已吊销的授权不占用机器数，但该机器不能用同一授权标识再次激活
+	revocations := s.loadRevocationList()
+	if revoked, ok := findRevokedActivation(revocations, entries, request.HardwareID); ok {
+		s.writeError(w, r, http.StatusForbidden, shared.APIErrorRevoked,
+			fmt.Sprintf("license %s has been revoked (%s)", revoked.SerialNumber, revoked.Reason))
+		return
+	}
+	activated := make(map[string]bool)
+	for _, entry := range entries {
+		if _, ok := revocations.Find(entry.SerialNumber, entry.FileID()); ok {
+			continue
+		}
+		for _, hardwareID := range entry.HardwareIDs {
+			activated[hardwareID] = true
+		}
+	}
+	if !activated[request.HardwareID] && entitlement.Seats > 0 && len(activated) >= entitlement.Seats {
+		s.writeError(w, r, http.StatusForbidden, shared.APIErrorSeatsExhausted,
+			fmt.Sprintf("all %d seats of this entitlement are in use", entitlement.Seats))
+		return
+	}
+
+	opts.Ledger = s.Ledger
+	opts.Reissue = activated[request.HardwareID]
+	opts.Issuer = s.Issuer
+	license, encoded, err := IssueLicenseForRequests([]*LicenseRequest{request}, opts)
+	var duplicate *DuplicateLicenseError
+	if errors.As(err, &duplicate) {
+		s.writeError(w, r, http.StatusConflict, shared.APIErrorAlreadyLicensed,
+			fmt.Sprintf("this machine already holds license %s", duplicate.Previous[len(duplicate.Previous)-1].SerialNumber))
+		return
+	}
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+
+	s.logf(r, "activated %s for entitlement %s (hardware %s)", license.SerialNumber, entitlement.ID, shortID(request.HardwareID))
+	s.writeJSON(w, http.StatusOK, shared.ActivationResponse{
+		License:      encoded,
+		SerialNumber: license.SerialNumber,
+		ExpiresAt:    license.ExpiresAt,
+	})
+}
+
+// redeemActivationCode 兑换激活码，请求体中的激活码优先于req.dat中客户输入的激活码
+func (s *LicenseServer) redeemActivationCode(w http.ResponseWriter, r *http.Request, body *shared.ActivationRequest, request *LicenseRequest) {
+	codeText := body.ActivationCode
+	if codeText == "" {
+		codeText = request.ActivationCode
+	}
+	code, err := ParseActivationCode(codeText)
+	var invalid *InvalidActivationCodeError
+	if errors.As(err, &invalid) {
+		s.writeError(w, r, http.StatusBadRequest, shared.APIErrorInvalidCode, invalid.Error())
+		return
+	}
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 该机器用同一激活码签发的授权已吊销时不能再次兑换
+	entries, err := s.Ledger.FindByHardware(request.HardwareID)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	redeemed := make([]LedgerEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.ActivationCode == code.ID {
+			redeemed = append(redeemed, entry)
+		}
+	}
+	if revoked, ok := findRevokedActivation(s.loadRevocationList(), redeemed, request.HardwareID); ok {
+		s.writeError(w, r, http.StatusForbidden, shared.APIErrorRevoked,
+			fmt.Sprintf("license %s has been revoked (%s)", revoked.SerialNumber, revoked.Reason))
+		return
+	}
+
+	opts := LicenseOptions{
+		ActivationCode: codeText,
+		Ledger:         s.Ledger,
+		Issuer:         s.Issuer,
+	}
+	license, encoded, err := IssueLicenseForRequests([]*LicenseRequest{request}, opts)
+	var duplicate *DuplicateLicenseError
+	switch {
+	case errors.Is(err, ErrActivationCodeExhausted):
+		s.writeError(w, r, http.StatusForbidden, shared.APIErrorSeatsExhausted, err.Error())
+		return
+	case errors.Is(err, ErrActivationCodeExpired):
+		s.writeError(w, r, http.StatusForbidden, shared.APIErrorInvalidCode, err.Error())
+		return
+	case errors.As(err, &duplicate):
+		s.writeError(w, r, http.StatusConflict, shared.APIErrorAlreadyLicensed,
+			fmt.Sprintf("this machine already holds license %s", duplicate.Previous[len(duplicate.Previous)-1].SerialNumber))
+		return
+	case err != nil:
+		s.internalError(w, r, err)
+		return
+	}
+
+	s.logf(r, "activated %s with activation code %s (hardware %s)", license.SerialNumber, code.ID, shortID(request.HardwareID))
+	s.writeJSON(w, http.StatusOK, shared.ActivationResponse{
+		License:      encoded,
+		SerialNumber: license.SerialNumber,
+		ExpiresAt:    license.ExpiresAt,
+	})
+}
+
+// handleRenew 下载续期授权：授权标识的截止日期延长后签发新的授权，否则返回当前授权
+func (s *LicenseServer) handleRenew(w http.ResponseWriter, r *http.Request) {
+	_, request, ok := s.readActivation(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.Ledger.FindByHardware(request.HardwareID)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	var current *LedgerEntry
+	for i := len(entries) - 1; i >= 0; i-- {
+		// 升级后原序列号的结束记录，升级后的授权记录在它之前
+		if entries[i].SupersededBy != "" {
+			continue
+		}
+		if entries[i].Entitlement != "" && entries[i].LicenseType != string(LicenseTypeAddon) {
+			current = &entries[i]
+			break
+		}
+	}
+	if current == nil {
+		s.writeError(w, r, http.StatusNotFound, shared.APIErrorNotFound, "this machine has not been activated online")
+		return
+	}
+	if current.TransferredTo != "" {
+		s.writeError(w, r, http.StatusForbidden, shared.APIErrorRevoked,
+			fmt.Sprintf("license %s has been transferred to %s", current.SerialNumber, current.TransferredTo))
+		return
+	}
+	// 只有已激活的安装能续期：硬件指纹可能被他人得知，不能把授权内容加密给请求中其他的安装公钥
+	installKey := current.InstallKeys[request.HardwareID]
+	if installKey != "" && request.PublicKey != installKey {
+		s.writeError(w, r, http.StatusForbidden, shared.APIErrorInstallMismatch,
+			"request was not created by the activated installation")
+		return
+	}
+	if revoked, ok := s.loadRevocationList().Find(current.SerialNumber, current.FileID()); ok {
+		s.writeError(w, r, http.StatusForbidden, shared.APIErrorRevoked,
+			fmt.Sprintf("license %s has been revoked (%s)", revoked.SerialNumber, revoked.Reason))
+		return
+	}
+
+	entitlement, found := s.Entitlements.Get(current.Entitlement)
+	if !found || entitlement.Disabled {
+		s.writeError(w, r, http.StatusForbidden, shared.APIErrorEntitlementDisabled, "entitlement is no longer available")
+		return
+	}
+	opts, err := entitlement.LicenseOptions(time.Now())
+	if err != nil {
+		s.writeError(w, r, http.StatusForbidden, shared.APIErrorEntitlementDisabled, err.Error())
+		return
+	}
+
+	// 新授权至少延长一天才重新签发，避免每次检查都产生新的授权
+	newExpiry := time.Now().AddDate(0, 0, opts.Days).Unix()
+	if newExpiry < current.ExpiresAt+86400 {
+		s.writeJSON(w, http.StatusOK, shared.ActivationResponse{
+			License:      current.Encoded,
+			SerialNumber: current.SerialNumber,
+			ExpiresAt:    current.ExpiresAt,
+		})
+		return
+	}
+
+	// 续期授权加密给已记录的安装公钥，忽略req.dat中的激活码
+	renewal := *request
+	renewal.PublicKey = installKey
+	renewal.ActivationCode = ""
+	opts.Ledger = s.Ledger
+	opts.Reissue = true
+	opts.Issuer = s.Issuer
+	license, encoded, err := IssueLicenseForRequests([]*LicenseRequest{&renewal}, opts)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+
+	s.logf(r, "renewed %s until %s", license.SerialNumber, time.Unix(license.ExpiresAt, 0).Format("2006-01-02"))
+	s.writeJSON(w, http.StatusOK, shared.ActivationResponse{
+		License:      encoded,
+		SerialNumber: license.SerialNumber,
+		ExpiresAt:    license.ExpiresAt,
+		Renewed:      true,
+	})
+}
+
+// handleStatus 查询授权状态，只返回状态和有效期，不包含客户信息
+func (s *LicenseServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, r, http.StatusMethodNotAllowed, shared.APIErrorInvalidRequest, "method not allowed")
+		return
+	}
+	serial := r.URL.Query().Get("serial")
+	if serial == "" {
+		s.writeError(w, r, http.StatusBadRequest, shared.APIErrorInvalidRequest, "missing serial")
+		return
+	}
+
+	entries, err := s.Ledger.FindBySerial(serial)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	if len(entries) == 0 {
+		s.writeError(w, r, http.StatusNotFound, shared.APIErrorNotFound, "unknown serial number")
+		return
+	}
+	entry := entries[len(entries)-1]
+
+	status := shared.LicenseStatusResponse{
+		SerialNumber: entry.SerialNumber,
+		Status:       shared.LicenseStatusActive,
+		Edition:      entry.Edition,
+		ExpiresAt:    entry.ExpiresAt,
+	}
+	if entry.Expired(time.Now()) {
+		status.Status = shared.LicenseStatusExpired
+	}
+	if revoked, ok := s.loadRevocationList().Find(entry.SerialNumber, entry.FileID()); ok {
+		status.Status = shared.LicenseStatusRevoked
+		status.RevokedAt = revoked.RevokedAt
+		status.Reason = revoked.Reason
+	}
+	s.writeJSON(w, http.StatusOK, status)
+}
+
+// readActivation 解析激活请求体并解密其中的req.dat
+func (s *LicenseServer) readActivation(w http.ResponseWriter, r *http.Request) (*shared.ActivationRequest, *LicenseRequest, bool) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, r, http.StatusMethodNotAllowed, shared.APIErrorInvalidRequest, "method not allowed")
+		return nil, nil, false
+	}
+
+	var body shared.ActivationRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIRequestSize)).Decode(&body); err != nil {
+		s.writeError(w, r, http.StatusBadRequest, shared.APIErrorInvalidRequest, "invalid JSON body")
+		return nil, nil, false
+	}
+	if body.Request == "" {
+		s.writeError(w, r, http.StatusBadRequest, shared.APIErrorInvalidRequest, "missing request")
+		return nil, nil, false
+	}
+
+	request, err := ParseRequest(body.Request, s.MaxRequestAge)
+	var rejected *RequestRejectedError
+	if errors.As(err, &rejected) {
+		s.writeError(w, r, http.StatusBadRequest, shared.APIErrorRequestRejected, rejected.Error())
+		return nil, nil, false
+	}
+	if err != nil {
+		s.internalError(w, r, err)
+		return nil, nil, false
+	}
+	return &body, request, true
+}
+
+// findRevokedActivation 查找机器在这些签发记录中最近一次签发的授权的吊销记录
+// 吊销只针对具体的授权文件，同一机器以其他授权标识或激活码激活不受影响
+func findRevokedActivation(revocations *RevocationList, entries []LedgerEntry, hardwareID string) (*RevokedLicense, bool) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		for _, id := range entries[i].HardwareIDs {
+			if id == hardwareID {
+				return revocations.Find(entries[i].SerialNumber, entries[i].FileID())
+			}
+		}
+	}
+	return nil, false
+}
+
+// loadRevocationList 读取吊销列表，未配置或无法读取时返回空列表
+func (s *LicenseServer) loadRevocationList() *RevocationList {
+	if s.RevocationList == "" {
+		return &RevocationList{}
+	}
+	data, err := os.ReadFile(s.RevocationList)
+	if err != nil {
+		return &RevocationList{}
+	}
+	list, err := DecodeRevocationList(string(data))
+	if err != nil {
+		if s.Logger != nil {
+			s.Logger.Printf("ignoring invalid revocation list %s: %v", s.RevocationList, err)
+		}
+		return &RevocationList{}
+	}
+	return list
+}
+
+// writeJSON 输出JSON响应
+func (s *LicenseServer) writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError 输出错误响应
+func (s *LicenseServer) writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	s.logf(r, "%d %s: %s", status, code, message)
+	s.writeJSON(w, status, shared.APIError{Code: code, Message: message})
+}
+
+// internalError 记录内部错误，响应中不暴露细节
+func (s *LicenseServer) internalError(w http.ResponseWriter, r *http.Request, err error) {
+	s.logf(r, "internal error: %v", err)
+	s.writeJSON(w, http.StatusInternalServerError, shared.APIError{Code: shared.APIErrorInternal, Message: "internal server error"})
+}
+
+// logf 输出访问日志
+func (s *LicenseServer) logf(r *http.Request, format string, args ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Printf("%s %s %s: %s", r.RemoteAddr, r.Method, r.URL.Path, fmt.Sprintf(format, args...))
+	}
+}
+
+// shortID 截短硬件指纹用于日志
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lengxu/golicense/shared"
+)
+
+// 授权内容的解密方式
+const (
+	DecryptedByEscrow   = "escrow"   // 签发记录中托管的授权内容
+	DecryptedByHardware = "hardware" // 硬件指纹派生的密钥
+)
+
+// LicenseInspection 签发方查看license.dat的结果，不需要在授权绑定的机器上
+type LicenseInspection struct {
+	File        *LicenseFile  // 授权文件
+	License     *License      // 解密出的授权内容，无法解密时为空
+	DecryptedBy string        // 解密方式
+	Verified    bool          // 授权内容与信封签名一致
+	Entries     []LedgerEntry // 签发记录中同一序列号的全部记录
+	Problem     string        // 无法解密或签名核对失败的原因
+}
+
+// InspectLicense 用签发方的密钥材料解密并核对任意license.dat，包括信封签名之前的2.0和3.0格式
+// 签发记录中有该授权文件原文时使用托管内容，否则依次尝试hardwareIDs和签发记录中全部机器的硬件指纹；
+// 签名不一致时仍返回解密出的内容，Verified为false
+func InspectLicense(encoded string, ledger *Ledger, hardwareIDs []string) (*LicenseInspection, error) {
+	encoded = strings.TrimSpace(encoded)
+	var file LicenseFile
+	if err := DecodeFromString(encoded, &file); err != nil {
+		return nil, fmt.Errorf("failed to decode license file: %v", err)
+	}
+	inspection := &LicenseInspection{File: &file}
+
+	var entries []LedgerEntry
+	if ledger != nil {
+		var err error
+		if entries, err = ledger.Entries(); err != nil {
+			return nil, err
+		}
+	}
+
+	// 1. 解密授权内容：优先使用托管内容，其次硬件指纹
+	var payload []byte
+	for i := len(entries) - 1; i >= 0 && payload == nil; i-- {
+		if entries[i].Encoded == encoded && entries[i].Escrow != "" {
+			if opened, err := openEscrow(entries[i].Escrow); err == nil {
+				payload = opened
+				inspection.DecryptedBy = DecryptedByEscrow
+			}
+		}
+	}
+	if payload == nil {
+		candidates := append([]string(nil), hardwareIDs...)
+		seen := make(map[string]bool)
+		for _, entry := range entries {
+			if entry.Encoded != encoded && len(hardwareIDs) > 0 {
+				continue
+			}
+			for _, hardwareID := range entry.HardwareIDs {
+				if !seen[hardwareID] {
+					seen[hardwareID] = true
+					candidates = append(candidates, hardwareID)
+				}
+			}
+		}
+		opened, err := decryptIssuedPayload(&file, candidates)
+		if err != nil {
+			inspection.Problem = err.Error()
+			return inspection, nil
+		}
+		payload = opened
+		inspection.DecryptedBy = DecryptedByHardware
+	}
+
+	// 2. 核对签名，不一致时仍显示授权内容便于排查
+	var license License
+	if err := shared.UnmarshalLicense(payload, &license); err != nil {
+		inspection.Problem = fmt.Sprintf("failed to parse license payload: %v", err)
+		return inspection, nil
+	}
+	inspection.License = &license
+	if _, err := verifyIssuedPayload(&file, payload); err != nil {
+		inspection.Problem = err.Error()
+	} else {
+		inspection.Verified = true
+	}
+
+	// 3. 同一序列号的签发记录，包括续期、续订、迁移和升级
+	for _, entry := range entries {
+		if strings.EqualFold(entry.SerialNumber, license.SerialNumber) {
+			inspection.Entries = append(inspection.Entries, entry)
+		}
+	}
+	return inspection, nil
+}
+
+// RequestInspection 签发方查看req.dat的结果
+type RequestInspection struct {
+	File    *RequestFile    // 请求文件头
+	Request *LicenseRequest // 解密出的请求内容
+	Entries []LedgerEntry   // 该机器已签发的授权，同一客户的每个序列号只取最后一条记录
+}
+
+// InspectRequest 解密任意req.dat，不检查请求时间，并在签发记录中查找该机器已签发的授权
+func InspectRequest(encoded string, ledger *Ledger) (*RequestInspection, error) {
+	var file RequestFile
+	if err := DecodeFromString(strings.TrimSpace(encoded), &file); err != nil {
+		return nil, fmt.Errorf("failed to decode request file: %v", err)
+	}
+	if file.Version != shared.RequestFormatLegacy && file.Version != shared.RequestFormatAEAD {
+		return nil, fmt.Errorf("unsupported request format %s", file.Version)
+	}
+	plaintext, err := openRequestFile(&file)
+	if err != nil {
+		return nil, err
+	}
+	var request LicenseRequest
+	if err := json.Unmarshal(plaintext, &request); err != nil {
+		return nil, fmt.Errorf("failed to parse request data: %v", err)
+	}
+
+	inspection := &RequestInspection{File: &file, Request: &request}
+	if ledger != nil {
+		entries, err := ledger.FindByHardware(request.HardwareID)
+		if err != nil {
+			return nil, err
+		}
+		inspection.Entries = Latest(entries)
+	}
+	return inspection, nil
+}
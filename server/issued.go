@@ -0,0 +1,338 @@
+package server
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lengxu/golicense/shared"
+)
+
+// IssuedLicense 签发方读取的已签发授权
+type IssuedLicense struct {
+	License   *License          // 经签名核对的授权内容
+	File      *LicenseFile      // 授权文件
+	Entry     *LedgerEntry      // 签发记录，授权不在签发记录中时为空
+	ExpiresAt int64             // 当前到期时间，包含签发记录中的离线续期
+	Keys      map[string]string // 硬件指纹对应的安装公钥
+}
+
+// FindIssuedLicense 按序列号在签发记录中查找授权
+// 授权已迁移或升级时返回错误，续订应针对替代它的新授权
+func FindIssuedLicense(ledger *Ledger, serial string) (*IssuedLicense, error) {
+	entries, err := ledger.FindBySerial(serial)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("license %s is not recorded in the ledger", serial)
+	}
+	if err := checkSuperseded(&entries[len(entries)-1]); err != nil {
+		return nil, err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Encoded != "" {
+			return issuedFromEntry(entries[i], entries)
+		}
+	}
+	return nil, fmt.Errorf("ledger does not contain the license file of %s", serial)
+}
+
+// LoadIssuedLicense 按签发记录读取授权，记录中的到期时间和安装公钥以签发记录文件为准
+func LoadIssuedLicense(ledger *Ledger, entry LedgerEntry) (*IssuedLicense, error) {
+	if entry.Encoded == "" {
+		return nil, fmt.Errorf("ledger entry of %s does not contain the license file", entry.SerialNumber)
+	}
+	entries := []LedgerEntry{entry}
+	if ledger != nil {
+		recorded, err := ledger.FindBySerial(entry.SerialNumber)
+		if err != nil {
+			return nil, err
+		}
+		if len(recorded) > 0 {
+			if err := checkSuperseded(&recorded[len(recorded)-1]); err != nil {
+				return nil, err
+			}
+			entries = recorded
+		}
+	}
+	return issuedFromEntry(entry, entries)
+}
+
+// ReadIssuedLicense 读取license.dat原文：在签发记录中有原文时按记录读取，
+// 否则用hardwareIDs派生的密钥解密，只能解密未加密给安装公钥的授权
+func ReadIssuedLicense(ledger *Ledger, encoded string, hardwareIDs []string) (*IssuedLicense, error) {
+	encoded = strings.TrimSpace(encoded)
+	if ledger != nil {
+		entries, err := ledger.Entries()
+		if err != nil {
+			return nil, err
+		}
+		for i := len(entries) - 1; i >= 0; i-- {
+			if entries[i].Encoded == encoded {
+				return LoadIssuedLicense(ledger, entries[i])
+			}
+		}
+	}
+
+	license, file, err := DecodeIssuedLicense(encoded, hardwareIDs, "")
+	if err != nil {
+		return nil, err
+	}
+	return &IssuedLicense{License: license, File: file, ExpiresAt: license.ExpiresAt}, nil
+}
+
+// issuedFromEntry 解密签发记录中的授权，entries为同一序列号的全部记录
+func issuedFromEntry(entry LedgerEntry, entries []LedgerEntry) (*IssuedLicense, error) {
+	license, file, err := DecodeIssuedLicense(entry.Encoded, entry.HardwareIDs, entry.Escrow)
+	if err != nil {
+		return nil, err
+	}
+	issued := &IssuedLicense{
+		License:   license,
+		File:      file,
+		Entry:     &entry,
+		ExpiresAt: license.ExpiresAt,
+		Keys:      entry.InstallKeys,
+	}
+	for _, recorded := range entries {
+		if recorded.Renewal && recorded.Encoded == entry.Encoded && recorded.ExpiresAt > issued.ExpiresAt {
+			issued.ExpiresAt = recorded.ExpiresAt
+		}
+	}
+	return issued, nil
+}
+
+// checkSuperseded 检查序列号最近的签发记录是否表示授权已迁移或升级
+func checkSuperseded(latest *LedgerEntry) error {
+	if latest.TransferredTo != "" {
+		return fmt.Errorf("license %s has been transferred to %s", latest.SerialNumber, latest.TransferredTo)
+	}
+	if latest.SupersededBy != "" {
+		return fmt.Errorf("license %s has been superseded by %s", latest.SerialNumber, latest.SupersededBy)
+	}
+	return nil
+}
+
+// DecodeIssuedLicense 用签发方的密钥材料解密并核对license.dat
+// 有托管内容时用RSA私钥解密托管内容，否则用硬件指纹派生的密钥解密；两种方式都核对信封签名
+func DecodeIssuedLicense(encoded string, hardwareIDs []string, escrow string) (*License, *LicenseFile, error) {
+	var file LicenseFile
+	if err := DecodeFromString(strings.TrimSpace(encoded), &file); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode license file: %v", err)
+	}
+	if !shared.IsEnvelopeFormat(file.Version) {
+		return nil, nil, fmt.Errorf("license format %s is not supported, only envelope licenses (%s) can be decoded", file.Version, shared.LicenseFormatEnvelope)
+	}
+
+	var payload []byte
+	var err error
+	if escrow != "" {
+		payload, err = openEscrow(escrow)
+	} else {
+		payload, err = decryptIssuedPayload(&file, hardwareIDs)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	license, err := verifyIssuedPayload(&file, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	return license, &file, nil
+}
+
+// decryptIssuedPayload 用硬件指纹派生的密钥解密授权载荷，试用授权使用固定的试用密钥材料
+// 支持HKDF和旧的固定salt两种密钥派生方式
+func decryptIssuedPayload(file *LicenseFile, hardwareIDs []string) ([]byte, error) {
+	var derive func(material []byte) ([]byte, string)
+	switch file.KDF {
+	case shared.KDFHKDFSHA256:
+		salt, err := base64.StdEncoding.DecodeString(file.Salt)
+		if err != nil || len(salt) == 0 {
+			return nil, errors.New("invalid license key salt")
+		}
+		derive = func(material []byte) ([]byte, string) {
+			return shared.DeriveLicenseKey(material, salt)
+		}
+	case shared.KDFLegacy:
+		derive = legacyLicenseKey
+	default:
+		return nil, fmt.Errorf("unsupported license key derivation %q", file.KDF)
+	}
+	data, err := base64.StdEncoding.DecodeString(file.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode license data: %v", err)
+	}
+
+	candidates := [][]byte{deriveTrialKey()}
+	for _, hardwareID := range hardwareIDs {
+		material := []byte(hardwareID)
+		if file.KDF == shared.KDFLegacy {
+			material = deriveLegacyHardwareKey(hardwareID)
+		}
+		candidates = append(candidates, material)
+	}
+	for _, material := range candidates {
+		key, keyCheck := derive(material)
+		if len(file.Recipients) == 0 {
+			if hmac.Equal([]byte(file.Key), []byte(keyCheck)) {
+				return AESDecryptBytes(data, key)
+			}
+			continue
+		}
+		for _, recipient := range file.Recipients {
+			if recipient.Type != shared.RecipientTypeHardware || recipient.ID != keyCheck {
+				continue
+			}
+			wrappedKey, err := base64.StdEncoding.DecodeString(recipient.Key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode content key: %v", err)
+			}
+			var contentKey []byte
+			if err := AESDecrypt(wrappedKey, key, &contentKey); err != nil {
+				return nil, fmt.Errorf("failed to decrypt content key: %v", err)
+			}
+			return AESDecryptBytes(data, contentKey)
+		}
+	}
+
+	if len(hardwareIDs) == 0 {
+		return nil, errors.New("cannot decrypt license: hardware fingerprint is unknown")
+	}
+	return nil, errors.New("cannot decrypt license: it is encrypted to an installation key or a different hardware fingerprint")
+}
+
+// deriveLegacyHardwareKey 旧授权的硬件密钥：sha256(硬件指纹 + 固定salt)
+func deriveLegacyHardwareKey(hardwareID string) []byte {
+	hash := sha256.Sum256([]byte(hardwareID + "_license_key_salt_2024"))
+	return hash[:]
+}
+
+// legacyLicenseKey 旧授权直接使用密钥材料作为AES密钥，校验值为密钥的SHA256
+func legacyLicenseKey(key []byte) ([]byte, string) {
+	keyHash := sha256.Sum256(key)
+	return key, hex.EncodeToString(keyHash[:])
+}
+
+// verifyIssuedPayload 核对载荷与授权文件的签名一致，返回授权内容
+// 4.0格式的签名覆盖信封头和载荷，3.0格式覆盖载荷字节，2.0格式覆盖重新序列化的License结构体
+func verifyIssuedPayload(file *LicenseFile, payload []byte) (*License, error) {
+	var license License
+	if err := shared.UnmarshalLicense(payload, &license); err != nil {
+		return nil, fmt.Errorf("failed to parse license payload: %v", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(file.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode license signature: %v", err)
+	}
+
+	signingInput := payload
+	switch {
+	case shared.IsEnvelopeFormat(file.Version):
+		if signingInput, err = shared.LicenseSigningInput(shared.BuildLicenseHeader(file, shared.LicenseBinding(&license), payload)); err != nil {
+			return nil, fmt.Errorf("failed to build license header: %v", err)
+		}
+	case shared.IsCanonicalFormat(file.Version):
+	default:
+		// 旧格式只有RSA签名
+		if signingInput, err = json.Marshal(license); err != nil {
+			return nil, fmt.Errorf("failed to encode license: %v", err)
+		}
+	}
+
+	publicKeys, err := issuedPublicKeys(file.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	for _, publicKey := range publicKeys {
+		if VerifySignature(file.Algorithm, signingInput, signature, publicKey) {
+			return &license, nil
+		}
+	}
+	return nil, errors.New("license payload does not match the license signature")
+}
+
+// issuedPublicKeys 按密钥标识查找签发授权时使用的公钥，包括已轮换的历史私钥；
+// 轮换前签发的旧授权没有密钥标识，返回全部已加载的公钥
+func issuedPublicKeys(keyID string) ([]crypto.PublicKey, error) {
+	current, err := GetPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	var publicKeys []crypto.PublicKey
+	if id, err := shared.KeyID(current); keyID == "" || (err == nil && id == keyID) {
+		publicKeys = append(publicKeys, current)
+	}
+
+	signingKeyMu.RLock()
+	defer signingKeyMu.RUnlock()
+	for _, key := range retiredKeys {
+		if id, err := shared.KeyID(&key.PublicKey); keyID == "" || (err == nil && id == keyID) {
+			publicKeys = append(publicKeys, &key.PublicKey)
+		}
+	}
+	if len(publicKeys) == 0 {
+		return nil, fmt.Errorf("license was signed by key %s which is not loaded (use -retired-key)", keyID)
+	}
+	return publicKeys, nil
+}
+
+// sealEscrow 用解密req.dat的RSA公钥加密授权载荷，写入签发记录供续订和查看时使用
+func sealEscrow(payload []byte) (string, error) {
+	requestKey, err := GetPrivateKey()
+	if err != nil {
+		return "", err
+	}
+	keyID, err := shared.KeyID(&requestKey.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute key ID: %v", err)
+	}
+
+	payloadHash := sha256.Sum256(payload)
+	escrowFile := RequestFile{
+		Hash:      hex.EncodeToString(payloadHash[:]),
+		Timestamp: time.Now().Unix(),
+		KeyID:     keyID,
+		Version:   shared.LicenseEscrowFormat,
+	}
+	additionalData, err := shared.RequestAdditionalData(&escrowFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode escrow header: %v", err)
+	}
+	aesKey := GenerateAESKey()
+	encryptedData, err := AESEncryptBytesWithAAD(payload, aesKey, additionalData)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt escrow: %v", err)
+	}
+	encryptedKey, err := RSAEncrypt(aesKey, &requestKey.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt escrow key: %v", err)
+	}
+	escrowFile.Data = base64.StdEncoding.EncodeToString(encryptedData)
+	escrowFile.Key = base64.StdEncoding.EncodeToString(encryptedKey)
+	return EncodeToString(escrowFile)
+}
+
+// openEscrow 解密签发记录中托管的授权载荷
+func openEscrow(escrow string) ([]byte, error) {
+	var escrowFile RequestFile
+	if err := DecodeFromString(escrow, &escrowFile); err != nil {
+		return nil, fmt.Errorf("failed to decode license escrow: %v", err)
+	}
+	if escrowFile.Version != shared.LicenseEscrowFormat {
+		return nil, fmt.Errorf("unsupported license escrow format %s", escrowFile.Version)
+	}
+	payload, err := openRequestFile(&escrowFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open license escrow: %v", err)
+	}
+	return payload, nil
+}
@@ -0,0 +1,403 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lengxu/golicense/shared"
+)
+
+// DefaultLedgerFile 默认的签发记录文件
+const DefaultLedgerFile = "license_ledger.jsonl"
+
+// LedgerEntry 一次签发的记录
+type LedgerEntry struct {
+	SerialNumber    string                 `json:"serial_number"`              // 授权序列号
+	RequestIDs      []string               `json:"request_ids,omitempty"`      // 请求唯一标识，试用授权没有请求
+	HardwareIDs     []string               `json:"hardware_ids,omitempty"`     // 绑定的硬件指纹
+	LicenseType     string                 `json:"license_type"`               // 授权类型
+	BaseSerial      string                 `json:"base_serial,omitempty"`      // 增购授权对应的基础授权序列号
+	CustomerID      string                 `json:"customer_id,omitempty"`      // 客户ID
+	CustomerName    string                 `json:"customer_name"`              // 客户名称
+	CustomerOrg     string                 `json:"customer_org,omitempty"`     // 客户组织
+	Edition         string                 `json:"edition,omitempty"`          // 授权版本
+	Modules         []shared.LicenseModule `json:"modules,omitempty"`          // 授权模块
+	Features        []string               `json:"features,omitempty"`         // 功能特性
+	MaxSeats        int                    `json:"max_seats,omitempty"`        // 多机授权最大机器数
+	TrialDays       int                    `json:"trial_days,omitempty"`       // 试用天数
+	IssuedAt        int64                  `json:"issued_at"`                  // 签发时间
+	ExpiresAt       int64                  `json:"expires_at"`                 // 过期时间
+	Issuer          string                 `json:"issuer,omitempty"`           // 签发人
+	Entitlement     string                 `json:"entitlement,omitempty"`      // 在线激活使用的授权标识
+	ActivationCode  string                 `json:"activation_code,omitempty"`  // 兑换的激活码标识
+	KeyID           string                 `json:"key_id,omitempty"`           // 签名密钥ID
+	Reissued        bool                   `json:"reissued,omitempty"`         // 是否为明确允许的重复签发
+	Renewal         bool                   `json:"renewal,omitempty"`          // 是否为离线续期码，授权文件不变，到期时间为续期后的时间
+	TransferredFrom string                 `json:"transferred_from,omitempty"` // 迁移授权的原序列号
+	TransferredTo   string                 `json:"transferred_to,omitempty"`   // 原授权已停用，迁移到的新序列号
+	TransferReceipt string                 `json:"transfer_receipt,omitempty"` // 停用回执中授权文件的标识，防止同一回执重复使用
+	PreviousSerial  string                 `json:"previous_serial,omitempty"`  // 续订或升级前的序列号，续订时与序列号相同
+	SupersededBy    string                 `json:"superseded_by,omitempty"`    // 原授权已升级，替代它的新序列号
+	InstallKeys     map[string]string      `json:"install_keys,omitempty"`     // 硬件指纹对应的安装公钥，续订时加密给同一安装
+	LicenseID       string                 `json:"license_id,omitempty"`       // 授权文件标识，与吊销列表中的授权文件标识对应
+	Escrow          string                 `json:"escrow,omitempty"`           // 用签发方RSA公钥加密托管的授权内容
+	RecordedAt      int64                  `json:"recorded_at"`                // 写入记录的时间
+	Encoded         string                 `json:"license,omitempty"`          // 签发的license.dat原文，可直接重新发给客户
+}
+
+// matchCustomer 客户名称或组织包含查询内容(不区分大小写)，或客户ID完全相同；查询为空时总是匹配
+func (e *LedgerEntry) matchCustomer(customer string) bool {
+	query := strings.ToLower(strings.TrimSpace(customer))
+	return query == "" ||
+		e.CustomerID == customer ||
+		strings.Contains(strings.ToLower(e.CustomerName), query) ||
+		strings.Contains(strings.ToLower(e.CustomerOrg), query)
+}
+
+// Expired 授权在指定时间是否已过期
+func (e *LedgerEntry) Expired(now time.Time) bool {
+	return e.ExpiresAt <= now.Unix()
+}
+
+// DaysRemaining 距离过期的天数，已过期时为负数
+func (e *LedgerEntry) DaysRemaining(now time.Time) int {
+	return int(math.Floor(float64(e.ExpiresAt-now.Unix()) / 86400))
+}
+
+// FileID 记录中授权文件的标识，与吊销列表中的授权文件标识对应
+// 新记录保存签发时的license_id；旧记录的授权没有license_id，由保存的授权文件签名计算，没有保存授权文件时返回空字符串
+func (e *LedgerEntry) FileID() string {
+	if e.LicenseID != "" {
+		return e.LicenseID
+	}
+	if e.Encoded == "" {
+		return ""
+	}
+	var file LicenseFile
+	if err := DecodeFromString(e.Encoded, &file); err != nil {
+		return ""
+	}
+	return shared.LicenseFileID(nil, &file)
+}
+
+// Ledger 基于JSON Lines文件的签发记录，每行一条记录，只追加不修改
+type Ledger struct {
+	path string
+	mu   sync.Mutex
+}
+
+// DuplicateLicenseError 请求或机器已经签发过授权
+type DuplicateLicenseError struct {
+	Previous []LedgerEntry // 之前的签发记录
+}
+
+// Error 实现error接口
+func (e *DuplicateLicenseError) Error() string {
+	serials := make([]string, 0, len(e.Previous))
+	for _, entry := range e.Previous {
+		serials = append(serials, entry.SerialNumber)
+	}
+	return fmt.Sprintf("a license has already been issued for this request or machine: %s", strings.Join(serials, ", "))
+}
+
+// OpenLedger 打开签发记录文件，不存在时创建
+func OpenLedger(path string) (*Ledger, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create ledger directory: %v", err)
+		}
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger: %v", err)
+	}
+	file.Close()
+	return &Ledger{path: path}, nil
+}
+
+// Path 签发记录文件路径
+func (l *Ledger) Path() string {
+	return l.path
+}
+
+// Entries 读取全部签发记录
+func (l *Ledger) Entries() ([]LedgerEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.readEntries()
+}
+
+// readEntries 逐行解析签发记录
+func (l *Ledger) readEntries() ([]LedgerEntry, error) {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger: %v", err)
+	}
+	defer file.Close()
+
+	var entries []LedgerEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var entry LedgerEntry
+		if err := json.Unmarshal([]byte(text), &entry); err != nil {
+			return nil, fmt.Errorf("ledger %s line %d is corrupted: %v", l.path, line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ledger: %v", err)
+	}
+	return entries, nil
+}
+
+// Append 追加一条签发记录
+func (l *Ledger) Append(entry LedgerEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode ledger entry: %v", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open ledger: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write ledger: %v", err)
+	}
+	return file.Sync()
+}
+
+// FindDuplicates 查找与请求重复的签发记录
+// 同一RequestID已签发过授权视为重放；同一硬件指纹已有未过期的完整授权视为重复签发。
+// 增购授权按设计与基础授权共用请求和硬件，不参与比较
+func (l *Ledger) FindDuplicates(requests []*LicenseRequest) ([]LedgerEntry, error) {
+	entries, err := l.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	var duplicates []LedgerEntry
+	for _, entry := range entries {
+		if entry.LicenseType == string(LicenseTypeAddon) {
+			continue
+		}
+		for _, request := range requests {
+			if containsString(entry.RequestIDs, request.RequestID) ||
+				(containsString(entry.HardwareIDs, request.HardwareID) && entry.ExpiresAt > now) {
+				duplicates = append(duplicates, entry)
+				break
+			}
+		}
+	}
+	return duplicates, nil
+}
+
+// FindBySerial 按序列号查找签发记录，重新签发的同一授权会有多条记录，按签发顺序返回
+func (l *Ledger) FindBySerial(serial string) ([]LedgerEntry, error) {
+	return l.filter(func(entry *LedgerEntry) bool {
+		return strings.EqualFold(entry.SerialNumber, serial)
+	})
+}
+
+// FindByCustomer 按客户名称、组织或客户ID查找签发记录，名称和组织按不区分大小写的子串匹配
+func (l *Ledger) FindByCustomer(customer string) ([]LedgerEntry, error) {
+	return l.filter(func(entry *LedgerEntry) bool {
+		return entry.matchCustomer(customer)
+	})
+}
+
+// isSiteLicense 是否为多机授权：绑定多台机器或设置了最大机器数的完整授权
+func (e *LedgerEntry) isSiteLicense() bool {
+	return e.LicenseType == string(shared.LicenseTypeStandard) && (len(e.HardwareIDs) > 1 || e.MaxSeats > 0)
+}
+
+// FindByHardware 查找绑定了指定硬件指纹的签发记录
+func (l *Ledger) FindByHardware(hardwareID string) ([]LedgerEntry, error) {
+	return l.filter(func(entry *LedgerEntry) bool {
+		return containsString(entry.HardwareIDs, hardwareID)
+	})
+}
+
+// LedgerQuery 签发记录查询条件，零值字段不参与过滤
+type LedgerQuery struct {
+	Customer       string                // 客户名称、组织或客户ID，名称和组织按子串匹配
+	Edition        shared.LicenseEdition // 授权版本
+	Module         shared.LicenseModule  // 包含的模块
+	LicenseType    shared.LicenseType    // 授权类型
+	SiteLicense    bool                  // 只返回多机授权
+	ExpiringWithin time.Duration         // 只返回在此期限内过期且尚未过期的授权
+	IncludeExpired bool                  // 是否包含已过期的授权，设置了ExpiringWithin时忽略
+	Now            time.Time             // 判断过期的基准时间，零值表示当前时间
+}
+
+// Query 按条件查询签发记录，同一客户的同一序列号只返回最后一条记录，按过期时间升序排列
+func (l *Ledger) Query(query LedgerQuery) ([]LedgerEntry, error) {
+	entries, err := l.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	now := query.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	var matched []LedgerEntry
+	for _, entry := range Latest(entries) {
+		if !entry.matchCustomer(query.Customer) {
+			continue
+		}
+		if query.Edition != "" && entry.Edition != string(query.Edition) {
+			continue
+		}
+		if query.Module != "" && !containsModule(entry.Modules, query.Module) {
+			continue
+		}
+		if query.LicenseType != "" && entry.LicenseType != string(query.LicenseType) {
+			continue
+		}
+		if query.SiteLicense && !entry.isSiteLicense() {
+			continue
+		}
+		if query.ExpiringWithin > 0 {
+			if entry.Expired(now) || entry.ExpiresAt > now.Add(query.ExpiringWithin).Unix() {
+				continue
+			}
+		} else if !query.IncludeExpired && entry.Expired(now) {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].ExpiresAt < matched[j].ExpiresAt
+	})
+	return matched, nil
+}
+
+// FindByEntitlement 查找通过指定授权标识激活的签发记录
+func (l *Ledger) FindByEntitlement(id string) ([]LedgerEntry, error) {
+	return l.filter(func(entry *LedgerEntry) bool {
+		return entry.Entitlement == id
+	})
+}
+
+// FindByActivationCode 查找兑换了指定激活码的签发记录
+func (l *Ledger) FindByActivationCode(id string) ([]LedgerEntry, error) {
+	return l.filter(func(entry *LedgerEntry) bool {
+		return entry.ActivationCode == id
+	})
+}
+
+// Latest 同一客户的每个序列号只保留最后一条记录，按签发顺序返回
+// 序列号由硬件指纹派生，同一台机器重新签发给其他客户时序列号相同，两个客户的记录都会保留
+func Latest(entries []LedgerEntry) []LedgerEntry {
+	index := make(map[string]int)
+	var latest []LedgerEntry
+	for _, entry := range entries {
+		key := entry.licenseKey()
+		if i, ok := index[key]; ok {
+			latest[i] = entry
+			continue
+		}
+		index[key] = len(latest)
+		latest = append(latest, entry)
+	}
+	return latest
+}
+
+// licenseKey 区分签发记录所属的授权：序列号加客户名称和组织，客户ID同样由硬件指纹派生，不能区分客户
+// 续期、续订记录和迁移、升级时原授权的关闭记录沿用原记录的客户，与原记录属于同一授权
+func (e *LedgerEntry) licenseKey() string {
+	return e.SerialNumber + "\x00" + e.CustomerName + "\x00" + e.CustomerOrg
+}
+
+// filter 返回满足条件的签发记录
+func (l *Ledger) filter(match func(entry *LedgerEntry) bool) ([]LedgerEntry, error) {
+	entries, err := l.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var matched []LedgerEntry
+	for i := range entries {
+		if match(&entries[i]) {
+			matched = append(matched, entries[i])
+		}
+	}
+	return matched, nil
+}
+
+// newLedgerEntry 根据签发的授权生成记录
+func newLedgerEntry(requests []*LicenseRequest, license *License, reissued bool) LedgerEntry {
+	entry := LedgerEntry{
+		SerialNumber: license.SerialNumber,
+		LicenseType:  string(license.LicenseType),
+		BaseSerial:   license.BaseSerial,
+		CustomerID:   license.CustomerID,
+		CustomerName: license.CustomerName,
+		CustomerOrg:  license.CustomerOrg,
+		Edition:      string(license.Edition),
+		Modules:      license.Modules,
+		Features:     license.Features,
+		MaxSeats:     license.MaxSeats,
+		TrialDays:    license.TrialDays,
+		IssuedAt:     license.IssuedAt,
+		ExpiresAt:    license.ExpiresAt,
+		LicenseID:    license.LicenseID,
+		Reissued:     reissued,
+		RecordedAt:   time.Now().Unix(),
+	}
+	for _, request := range requests {
+		entry.RequestIDs = append(entry.RequestIDs, request.RequestID)
+		if request.PublicKey != "" {
+			if entry.InstallKeys == nil {
+				entry.InstallKeys = make(map[string]string)
+			}
+			entry.InstallKeys[request.HardwareID] = request.PublicKey
+		}
+	}
+	if license.IsSiteLicense() {
+		entry.HardwareIDs = append(entry.HardwareIDs, license.HardwareIDs...)
+	} else if license.HardwareID != "" {
+		entry.HardwareIDs = []string{license.HardwareID}
+	}
+	return entry
+}
+
+// containsModule 检查模块列表中是否包含指定模块
+func containsModule(modules []shared.LicenseModule, module shared.LicenseModule) bool {
+	for _, m := range modules {
+		if m == module {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString 检查字符串列表中是否包含指定值
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
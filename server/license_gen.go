@@ -1,11 +1,17 @@
 package server
 
 import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/lengxu/golicense/shared"
@@ -18,6 +24,39 @@ type CustomerInfo struct {
 	Edition shared.LicenseEdition
 }
 
+// AddonSpec 增购授权内容
+type AddonSpec struct {
+	BaseSerial string          // 基础授权序列号
+	Modules    []LicenseModule // 增购的模块
+	Features   []string        // 增购的功能特性
+	MaxScans   int             // 追加的扫描次数
+	MaxAssets  int             // 追加的资产数量
+	MaxUsers   int             // 追加的用户数量
+}
+
+// LicenseOptions 授权签发选项
+type LicenseOptions struct {
+	Days           int                    // 授权有效期天数
+	Customer       CustomerInfo           // 客户信息
+	Addon          *AddonSpec             // 增购授权内容，为空时签发完整授权
+	MaxSeats       int                    // 多机授权的最大机器数，0表示不限制
+	TrialDays      int                    // 试用天数，仅用于试用授权
+	Claims         map[string]interface{} // 自定义声明，随授权一起签名
+	MaxRequestAge  time.Duration          // req.dat的最长有效期，0表示不限制
+	Ledger         *Ledger                // 签发记录，为空时不检查重复也不记录
+	Reissue        bool                   // 明确允许对已签发过的请求或机器重新签发
+	Issuer         string                 // 签发人，写入签发记录
+	Entitlement    string                 // 在线激活使用的授权标识，写入签发记录
+	Modules        []LicenseModule        // 完整授权在版本之外额外包含的模块
+	ActivationCode string                 // 激活码，为空时使用请求中客户输入的激活码
+	Floating       int                    // 签发浮动授权，指定租约服务器可同时借出的租约数
+	Transfer       *TransferSpec          // 授权迁移，凭停用回执沿用原授权的内容和剩余期限
+	Deliver        func(string) error     // 写入签发记录前交付license.dat内容（如保存到文件），失败时不写入签发记录
+
+	activationID string         // 已兑换激活码的标识，写入签发记录
+	previous     *IssuedLicense // 续订或升级的原授权，写入签发记录
+}
+
 // GenerateLicense 根据req.dat生成license.dat（兼容旧版本）
 func GenerateLicense(reqFilePath, licenseFilePath string, days int, customer CustomerInfo) error {
 	// 默认使用旗舰版
@@ -29,68 +68,319 @@ func GenerateLicense(reqFilePath, licenseFilePath string, days int, customer Cus
 
 // GenerateLicenseWithEdition 根据req.dat生成指定版本的license.dat
 func GenerateLicenseWithEdition(reqFilePath, licenseFilePath string, days int, customer CustomerInfo) error {
-	// 1. 读取req.dat
-	reqData, err := os.ReadFile(reqFilePath)
+	_, err := IssueLicense(reqFilePath, licenseFilePath, LicenseOptions{
+		Days:     days,
+		Customer: customer,
+	})
+	return err
+}
+
+// GenerateAddonLicense 根据req.dat生成叠加在基础授权上的增购授权
+func GenerateAddonLicense(reqFilePath, licenseFilePath string, days int, customer CustomerInfo, addon AddonSpec) error {
+	_, err := IssueLicense(reqFilePath, licenseFilePath, LicenseOptions{
+		Days:     days,
+		Customer: customer,
+		Addon:    &addon,
+	})
+	return err
+}
+
+// IssueLicense 根据req.dat和签发选项生成license.dat，返回签发的授权数据
+func IssueLicense(reqFilePath, licenseFilePath string, opts LicenseOptions) (*License, error) {
+	return IssueSiteLicense([]string{reqFilePath}, licenseFilePath, opts)
+}
+
+// IssueSiteLicense 根据多个req.dat生成一个多机授权
+// 只有一个请求且未设置机器数上限时生成普通的单机授权
+func IssueSiteLicense(reqFilePaths []string, licenseFilePath string, opts LicenseOptions) (*License, error) {
+	if len(reqFilePaths) == 0 {
+		return nil, fmt.Errorf("no request file specified")
+	}
+
+	// 1. 读取并解密全部req.dat
+	var requests []*LicenseRequest
+	for _, reqFilePath := range reqFilePaths {
+		request, err := readRequestFile(reqFilePath, opts.MaxRequestAge)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+
+	// 2. 签发并保存license.dat，保存成功后才写入签发记录
+	opts.Deliver = func(encoded string) error {
+		return writeLicenseFile(licenseFilePath, encoded)
+	}
+	license, _, err := IssueLicenseForRequests(requests, opts)
 	if err != nil {
-		return fmt.Errorf("failed to read request file: %v", err)
+		return nil, err
 	}
 
-	var reqFile RequestFile
-	if err := DecodeFromString(string(reqData), &reqFile); err != nil {
-		return fmt.Errorf("failed to decode request file: %v", err)
+	printLicenseSummary(requests, *license)
+	return license, nil
+}
+
+// IssueLicenseForRequests 为已解密的请求签发授权，返回授权数据和license.dat内容，不写文件
+// 设置了签发记录时检查重复签发，并在opts.Deliver交付成功后记录本次签发
+func IssueLicenseForRequests(requests []*LicenseRequest, opts LicenseOptions) (*License, string, error) {
+	if len(requests) == 0 {
+		return nil, "", fmt.Errorf("no license request specified")
+	}
+	if opts.Customer.Edition == "" && opts.Addon == nil {
+		opts.Customer.Edition = shared.EditionEnterprise
+	}
+	if opts.Transfer != nil {
+		if err := verifyTransfer(&opts, requests); err != nil {
+			return nil, "", err
+		}
+	} else if err := applyActivationCode(&opts, requests); err != nil {
+		return nil, "", err
 	}
 
-	// 2. 解密请求数据
-	privateKey := GetPrivateKey()
+	// 同一请求重放或同一机器重复签发时，除非明确要求重新签发，否则拒绝
+	if opts.Ledger != nil && opts.Addon == nil && !opts.Reissue {
+		previous, err := opts.Ledger.FindDuplicates(requests)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(previous) > 0 {
+			return nil, "", &DuplicateLicenseError{Previous: previous}
+		}
+	}
 
-	// 解码RSA加密的AES密钥
-	encryptedKey, err := base64.StdEncoding.DecodeString(reqFile.Key)
+	// 1. 生成授权数据
+	var license License
+	var err error
+	if opts.Transfer != nil {
+		license = buildTransferLicense(requests[0], opts.Transfer)
+	} else if opts.Addon != nil {
+		license, err = buildAddonLicense(requests[0], opts)
+	} else {
+		license = buildLicense(requests[0], opts)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to decode encrypted key: %v", err)
+		return nil, "", err
+	}
+	if err := applyClaims(&license, opts.Claims); err != nil {
+		return nil, "", err
 	}
 
-	// 解密AES密钥
-	aesKey, err := RSADecrypt(encryptedKey, privateKey)
-	if err != nil {
-		return fmt.Errorf("failed to decrypt AES key: %v", err)
+	if opts.Floating > 0 {
+		if err := bindFloatingLicense(&license, requests, opts.Floating); err != nil {
+			return nil, "", err
+		}
+	} else if len(requests) > 1 || opts.MaxSeats > 0 {
+		if err := bindSiteLicense(&license, requests, opts.MaxSeats); err != nil {
+			return nil, "", err
+		}
 	}
 
-	// 解码请求数据
-	encryptedData, err := base64.StdEncoding.DecodeString(reqFile.Data)
+	// 2. 签名并加密，提供了安装公钥的机器只有该安装能解密授权内容
+	installationKeys := make(map[string]string)
+	for _, request := range requests {
+		if request.PublicKey != "" {
+			installationKeys[request.HardwareID] = request.PublicKey
+		}
+	}
+	encodedString, err := encodeLicenseFile(&license, installationKeys)
 	if err != nil {
-		return fmt.Errorf("failed to decode encrypted data: %v", err)
+		return nil, "", err
+	}
+	if err := recordLicense(opts, requests, license, encodedString); err != nil {
+		return nil, "", err
 	}
 
-	// 解密请求数据
-	var request LicenseRequest
-	if err := AESDecrypt(encryptedData, aesKey, &request); err != nil {
-		return fmt.Errorf("failed to decrypt request data: %v", err)
+	return &license, encodedString, nil
+}
+
+// IssueTrialLicense 生成不绑定硬件的试用授权，无需req.dat
+// opts.Days 为试用授权可被激活的期限，opts.TrialDays 为首次运行后的试用天数
+func IssueTrialLicense(licenseFilePath string, opts LicenseOptions) (*License, error) {
+	if opts.TrialDays <= 0 || opts.TrialDays > shared.MaxTrialDays {
+		return nil, fmt.Errorf("trial duration must be between 1 and %d days", shared.MaxTrialDays)
+	}
+	if opts.Days < opts.TrialDays {
+		return nil, fmt.Errorf("trial license validity (%d days) is shorter than the trial duration (%d days)", opts.Days, opts.TrialDays)
+	}
+	if opts.Customer.Edition == "" {
+		opts.Customer.Edition = shared.EditionEnterprise
 	}
 
-	// 3. 验证请求数据完整性 (暂时跳过，等待修复hash验证)
-	expectedHash, err := SHA256Hash(request)
+	now := time.Now()
+	edition := opts.Customer.Edition
+	serialNumber := generateTrialSerialNumber(now)
+
+	license := License{
+		IssuedAt:     now.Unix(),
+		ExpiresAt:    now.AddDate(0, 0, opts.Days).Unix(),
+		Edition:      edition,
+		Modules:      shared.GetModulesForEdition(edition),
+		ModulePerms:  shared.GetDefaultModulePermissions(edition),
+		CustomerID:   generateCustomerID("trial_" + serialNumber),
+		CustomerName: opts.Customer.Name,
+		CustomerOrg:  opts.Customer.Org,
+		MaxScans:     getMaxScansForEdition(edition),
+		MaxAssets:    getMaxAssetsForEdition(edition),
+		MaxUsers:     getMaxUsersForEdition(edition),
+		Features:     getFeaturesForEdition(edition),
+		LicenseKey:   generateLicenseKey("trial_"+serialNumber, edition),
+		SerialNumber: serialNumber,
+		LicenseType:  shared.LicenseTypeTrial,
+		TrialDays:    opts.TrialDays,
+	}
+	if err := applyClaims(&license, opts.Claims); err != nil {
+		return nil, err
+	}
+
+	encodedString, err := encodeLicenseFile(&license, nil)
 	if err != nil {
-		return fmt.Errorf("failed to calculate request hash: %v", err)
+		return nil, err
+	}
+	opts.Deliver = func(encoded string) error {
+		return writeLicenseFile(licenseFilePath, encoded)
+	}
+	if err := recordLicense(opts, nil, license, encodedString); err != nil {
+		return nil, err
 	}
 
-	fmt.Printf("Hash verification (debug): expected=%s, got=%s\n",
-		hex.EncodeToString(expectedHash), reqFile.Hash)
+	printLicenseSummary(nil, license)
+	return &license, nil
+}
 
-	// 4. 根据版本生成授权数据
-	now := time.Now()
-	modules := shared.GetModulesForEdition(customer.Edition)
-	modulePerms := shared.GetDefaultModulePermissions(customer.Edition)
+// recordLicense 交付签发的授权后追加到签发记录，交付失败时不写入记录，避免记录从未发出的授权
+func recordLicense(opts LicenseOptions, requests []*LicenseRequest, license License, encodedString string) error {
+	if opts.Deliver != nil {
+		if err := opts.Deliver(encodedString); err != nil {
+			return err
+		}
+	}
+	if opts.Ledger == nil {
+		return nil
+	}
+	entry := newLedgerEntry(requests, &license, opts.Reissue)
+	entry.Issuer = opts.Issuer
+	entry.Entitlement = opts.Entitlement
+	entry.ActivationCode = opts.activationID
+	entry.Encoded = encodedString
+	if opts.Transfer != nil {
+		entry.TransferredFrom = opts.Transfer.Receipt.SerialNumber
+		entry.TransferReceipt = opts.Transfer.receiptID
+	}
+	if opts.previous != nil {
+		recordLineage(&entry, opts.previous)
+	}
+	if keyID, err := GetKeyID(); err == nil {
+		entry.KeyID = keyID
+	}
+	// 托管授权内容，加密给安装公钥的授权也能续订和查看；没有RSA私钥时不托管
+	if payload, err := shared.CanonicalJSON(license); err == nil {
+		if escrow, err := sealEscrow(payload); err == nil {
+			entry.Escrow = escrow
+		}
+	}
+	if err := opts.Ledger.Append(entry); err != nil {
+		if opts.Deliver != nil {
+			return fmt.Errorf("license delivered but not recorded in ledger: %v", err)
+		}
+		return fmt.Errorf("failed to record license in ledger: %v", err)
+	}
+	switch {
+	case opts.Transfer != nil:
+		return recordTransfer(opts, &license)
+	case opts.previous != nil && opts.previous.License.SerialNumber != license.SerialNumber:
+		return recordSuperseded(opts, &license)
+	}
+	return nil
+}
 
-	// 生成序列号
-	serialNumber := generateSerialNumber(request.HardwareID, customer.Edition)
+// applyClaims 检查并写入自定义声明
+func applyClaims(license *License, claims map[string]interface{}) error {
+	if len(claims) == 0 {
+		return nil
+	}
+
+	license.Claims = make(map[string]interface{}, len(claims))
+	for key, value := range claims {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("claim name must not be empty")
+		}
+		if _, err := json.Marshal(value); err != nil {
+			return fmt.Errorf("invalid value for claim %s: %v", key, err)
+		}
+		license.Claims[key] = value
+	}
+	return nil
+}
+
+// bindFloatingLicense 将授权签发为浮动授权：绑定租约服务器所在的机器，
+// 由租约服务器用请求中的租约公钥签发租约，最多同时借出maxLeases个
+func bindFloatingLicense(license *License, requests []*LicenseRequest, maxLeases int) error {
+	if license.IsAddon() {
+		return errors.New("add-on licenses cannot be floating")
+	}
+	if len(requests) != 1 {
+		return errors.New("a floating license is bound to a single lease server")
+	}
+	request := requests[0]
+	if request.LeaseKey == "" {
+		return errors.New("request was not generated by a lease server (no lease key)")
+	}
+	leaseKey, err := base64.StdEncoding.DecodeString(request.LeaseKey)
+	if err != nil || len(leaseKey) != ed25519.PublicKeySize {
+		return errors.New("request contains an invalid lease key")
+	}
+
+	license.LicenseType = shared.LicenseTypeFloating
+	license.MaxSeats = maxLeases
+	license.LeaseKey = request.LeaseKey
+	license.SerialNumber = generateSerialNumber("floating:"+request.HardwareID, license.Edition)
+	return nil
+}
+
+// bindSiteLicense 将授权绑定到多台机器
+func bindSiteLicense(license *License, requests []*LicenseRequest, maxSeats int) error {
+	var hardwareIDs []string
+	for _, request := range requests {
+		duplicate := false
+		for _, id := range hardwareIDs {
+			if id == request.HardwareID {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			hardwareIDs = append(hardwareIDs, request.HardwareID)
+		}
+	}
+
+	if maxSeats > 0 && len(hardwareIDs) > maxSeats {
+		return fmt.Errorf("%d machines requested but the seat cap is %d", len(hardwareIDs), maxSeats)
+	}
+
+	siteID := strings.Join(hardwareIDs, ",")
+	license.HardwareID = ""
+	license.HardwareIDs = hardwareIDs
+	license.MaxSeats = maxSeats
+	license.CustomerID = generateCustomerID(siteID)
+	license.LicenseKey = generateLicenseKey(siteID, license.Edition)
+	if !license.IsAddon() {
+		license.SerialNumber = generateSerialNumber(siteID, license.Edition)
+	}
+	return nil
+}
+
+// buildLicense 根据版本生成完整授权数据
+func buildLicense(request *LicenseRequest, opts LicenseOptions) License {
+	now := time.Now()
+	customer := opts.Customer
 
 	license := License{
 		HardwareID:   request.HardwareID,
 		IssuedAt:     now.Unix(),
-		ExpiresAt:    now.AddDate(0, 0, days).Unix(),
+		ExpiresAt:    now.AddDate(0, 0, opts.Days).Unix(),
 		Edition:      customer.Edition,
-		Modules:      modules,
-		ModulePerms:  modulePerms,
+		Modules:      shared.GetModulesForEdition(customer.Edition),
+		ModulePerms:  shared.GetDefaultModulePermissions(customer.Edition),
 		CustomerID:   generateCustomerID(request.HardwareID),
 		CustomerName: customer.Name,
 		CustomerOrg:  customer.Org,
@@ -100,57 +390,275 @@ func GenerateLicenseWithEdition(reqFilePath, licenseFilePath string, days int, c
 		Features:     getFeaturesForEdition(customer.Edition),
 		RequestID:    request.RequestID,
 		LicenseKey:   generateLicenseKey(request.HardwareID, customer.Edition),
-		SerialNumber: serialNumber,
+		SerialNumber: generateSerialNumber(request.HardwareID, customer.Edition),
+		LicenseType:  shared.LicenseTypeStandard,
 	}
 
-	// 5. 签名授权数据
-	signature, err := RSASign(license, privateKey)
+	// 版本之外额外购买的模块
+	for _, module := range opts.Modules {
+		if containsModule(license.Modules, module) {
+			continue
+		}
+		license.Modules = append(license.Modules, module)
+		if perm, ok := shared.GetDefaultModulePermission(module); ok {
+			license.ModulePerms = append(license.ModulePerms, perm)
+		}
+	}
+	return license
+}
+
+// buildAddonLicense 生成增购授权数据
+// 增购授权只包含新增的模块、功能和配额，由客户端合并到基础授权
+func buildAddonLicense(request *LicenseRequest, opts LicenseOptions) (License, error) {
+	addon := opts.Addon
+	if addon.BaseSerial == "" {
+		return License{}, fmt.Errorf("add-on license requires a base serial number")
+	}
+	if len(addon.Modules) == 0 && len(addon.Features) == 0 &&
+		addon.MaxScans == 0 && addon.MaxAssets == 0 && addon.MaxUsers == 0 {
+		return License{}, fmt.Errorf("add-on license grants nothing: specify modules, features or quotas")
+	}
+
+	var modulePerms []ModulePermissions
+	for _, module := range addon.Modules {
+		perm, ok := shared.GetDefaultModulePermission(module)
+		if !ok {
+			return License{}, fmt.Errorf("unknown module: %s", module)
+		}
+		modulePerms = append(modulePerms, perm)
+	}
+
+	now := time.Now()
+	customer := opts.Customer
+
+	return License{
+		HardwareID:   request.HardwareID,
+		IssuedAt:     now.Unix(),
+		ExpiresAt:    now.AddDate(0, 0, opts.Days).Unix(),
+		Edition:      customer.Edition,
+		Modules:      addon.Modules,
+		ModulePerms:  modulePerms,
+		CustomerID:   generateCustomerID(request.HardwareID),
+		CustomerName: customer.Name,
+		CustomerOrg:  customer.Org,
+		MaxScans:     addon.MaxScans,
+		MaxAssets:    addon.MaxAssets,
+		MaxUsers:     addon.MaxUsers,
+		Features:     addon.Features,
+		RequestID:    request.RequestID,
+		LicenseKey:   generateLicenseKey(request.HardwareID, customer.Edition),
+		SerialNumber: generateAddonSerialNumber(request.HardwareID, addon.BaseSerial, now),
+		LicenseType:  shared.LicenseTypeAddon,
+		BaseSerial:   addon.BaseSerial,
+	}, nil
+}
+
+// writeLicenseFile 保存license.dat内容
+func writeLicenseFile(licenseFilePath string, encodedString string) error {
+	if err := os.WriteFile(licenseFilePath, []byte(encodedString), 0644); err != nil {
+		return fmt.Errorf("failed to write license file: %v", err)
+	}
+	return nil
+}
+
+// encodeLicenseFile 为授权生成新的license_id后签名并加密授权数据，返回license.dat内容
+// installationKeys 为硬件指纹到安装公钥的映射，有安装公钥的机器用X25519接收内容密钥
+func encodeLicenseFile(license *License, installationKeys map[string]string) (string, error) {
+	signingKey, err := GetSigningKey()
 	if err != nil {
-		return fmt.Errorf("failed to sign license: %v", err)
+		return "", err
 	}
+	licenseID := make([]byte, 16)
+	if _, err := rand.Read(licenseID); err != nil {
+		return "", fmt.Errorf("failed to generate license ID: %v", err)
+	}
+	license.LicenseID = hex.EncodeToString(licenseID)
 
-	// 6. 用硬件指纹派生的密钥加密授权数据
-	licenseKey := deriveKeyFromHardware(request.HardwareID)
-	encryptedLicense, err := AESEncrypt(license, licenseKey)
+	// 1. 生成规范化载荷，客户端验证的就是这份字节
+	payload, err := shared.CanonicalJSON(license)
 	if err != nil {
-		return fmt.Errorf("failed to encrypt license: %v", err)
+		return "", fmt.Errorf("failed to encode license payload: %v", err)
+	}
+
+	algorithm, err := shared.SignatureAlgorithmForKey(signingKey.Public())
+	if err != nil {
+		return "", err
+	}
+	keyID, err := shared.KeyID(signingKey.Public())
+	if err != nil {
+		return "", fmt.Errorf("failed to compute key ID: %v", err)
 	}
 
-	// 7. 生成license文件
-	keyHashArray := sha256.Sum256(licenseKey)
 	licenseFile := LicenseFile{
-		Data:      base64.StdEncoding.EncodeToString(encryptedLicense),
-		Key:       hex.EncodeToString(keyHashArray[:]),
-		Signature: base64.StdEncoding.EncodeToString(signature),
-		Version:   "2.0", // 升级版本号以支持新格式
+		Version:   shared.LicenseFormatEnvelope,
+		KeyID:     keyID,
+		Algorithm: algorithm,
+		Binding:   shared.LicenseBinding(license),
+	}
+
+	// 2. 加密授权数据，密钥由HKDF从硬件指纹和每份授权随机生成的salt派生
+	salt := make([]byte, shared.LicenseSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %v", err)
+	}
+	licenseFile.KDF = shared.KDFHKDFSHA256
+	licenseFile.Salt = base64.StdEncoding.EncodeToString(salt)
+
+	hardwareIDs := []string{license.HardwareID}
+	if license.IsSiteLicense() {
+		hardwareIDs = license.HardwareIDs
 	}
 
-	// 8. 编码为字符串并保存license.dat
+	switch {
+	case license.IsTrial():
+		// 试用授权不绑定硬件，使用固定的试用密钥材料
+		licenseKey, keyCheck := shared.DeriveLicenseKey(deriveTrialKey(), salt)
+		encryptedLicense, err := AESEncryptBytes(payload, licenseKey)
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt license: %v", err)
+		}
+		licenseFile.Data = base64.StdEncoding.EncodeToString(encryptedLicense)
+		licenseFile.Key = keyCheck
+	case license.IsSiteLicense() || len(installationKeys) > 0:
+		// 用随机内容密钥加密，再为每台机器分别加密内容密钥：
+		// 有安装公钥的用X25519，否则用硬件指纹派生的密钥
+		contentKey := GenerateAESKey()
+		encryptedLicense, err := AESEncryptBytes(payload, contentKey)
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt license: %v", err)
+		}
+		licenseFile.Data = base64.StdEncoding.EncodeToString(encryptedLicense)
+
+		for _, hardwareID := range hardwareIDs {
+			var recipient LicenseRecipient
+			if publicKey, ok := installationKeys[hardwareID]; ok {
+				recipient, err = wrapForInstallation(contentKey, publicKey)
+			} else {
+				recipient, err = wrapForHardware(contentKey, hardwareID, salt)
+			}
+			if err != nil {
+				return "", err
+			}
+			licenseFile.Recipients = append(licenseFile.Recipients, recipient)
+		}
+	default:
+		// 单机授权：用硬件指纹派生的密钥加密授权数据
+		licenseKey, keyCheck := shared.DeriveLicenseKey([]byte(license.HardwareID), salt)
+		encryptedLicense, err := AESEncryptBytes(payload, licenseKey)
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt license: %v", err)
+		}
+		licenseFile.Data = base64.StdEncoding.EncodeToString(encryptedLicense)
+		licenseFile.Key = keyCheck
+	}
+
+	// 3. 对信封头签名，覆盖格式版本、算法、密钥标识、硬件绑定、加密数据和载荷
+	header := shared.BuildLicenseHeader(&licenseFile, licenseFile.Binding, payload)
+	signingInput, err := shared.LicenseSigningInput(header)
+	if err != nil {
+		return "", fmt.Errorf("failed to build license header: %v", err)
+	}
+	signature, _, err := SignBytes(signingInput, signingKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign license: %v", err)
+	}
+	licenseFile.Signature = base64.StdEncoding.EncodeToString(signature)
+
+	// 4. 编码为字符串
 	encodedString, err := EncodeLicenseToString(licenseFile)
 	if err != nil {
-		return fmt.Errorf("failed to encode license file: %v", err)
+		return "", fmt.Errorf("failed to encode license file: %v", err)
 	}
 
-	if err := os.WriteFile(licenseFilePath, []byte(encodedString), 0644); err != nil {
-		return fmt.Errorf("failed to write license file: %v", err)
+	return encodedString, nil
+}
+
+// wrapForHardware 用硬件指纹派生的密钥加密内容密钥
+func wrapForHardware(contentKey []byte, hardwareID string, salt []byte) (LicenseRecipient, error) {
+	recipientKey, recipientID := shared.DeriveLicenseKey([]byte(hardwareID), salt)
+	wrappedKey, err := AESEncrypt(contentKey, recipientKey)
+	if err != nil {
+		return LicenseRecipient{}, fmt.Errorf("failed to wrap content key: %v", err)
+	}
+	return LicenseRecipient{
+		ID:  recipientID,
+		Key: base64.StdEncoding.EncodeToString(wrappedKey),
+	}, nil
+}
+
+// wrapForInstallation 用安装公钥加密内容密钥：临时X25519密钥协商后经HKDF派生包装密钥
+func wrapForInstallation(contentKey []byte, publicKey string) (LicenseRecipient, error) {
+	recipientBytes, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return LicenseRecipient{}, fmt.Errorf("invalid installation public key: %v", err)
+	}
+	recipientKey, err := ecdh.X25519().NewPublicKey(recipientBytes)
+	if err != nil {
+		return LicenseRecipient{}, fmt.Errorf("invalid installation public key: %v", err)
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return LicenseRecipient{}, fmt.Errorf("failed to generate ephemeral key: %v", err)
+	}
+	sharedSecret, err := ephemeral.ECDH(recipientKey)
+	if err != nil {
+		return LicenseRecipient{}, fmt.Errorf("failed to agree on wrap key: %v", err)
 	}
 
+	ephemeralBytes := ephemeral.PublicKey().Bytes()
+	wrapKey := shared.DeriveX25519WrapKey(sharedSecret, ephemeralBytes, recipientBytes)
+	wrappedKey, err := AESEncryptBytes(contentKey, wrapKey)
+	if err != nil {
+		return LicenseRecipient{}, fmt.Errorf("failed to wrap content key: %v", err)
+	}
+
+	return LicenseRecipient{
+		ID:        shared.InstallationKeyID(recipientBytes),
+		Key:       base64.StdEncoding.EncodeToString(wrappedKey),
+		Type:      shared.RecipientTypeX25519,
+		Ephemeral: base64.StdEncoding.EncodeToString(ephemeralBytes),
+	}, nil
+}
+
+// printLicenseSummary 打印签发结果
+func printLicenseSummary(requests []*LicenseRequest, license License) {
 	fmt.Printf("License generated successfully:\n")
-	fmt.Printf("  Request ID: %s\n", request.RequestID)
-	fmt.Printf("  Hardware ID: %s\n", request.HardwareID)
+	for _, request := range requests {
+		fmt.Printf("  Request ID: %s\n", request.RequestID)
+		fmt.Printf("  Hardware ID: %s\n", request.HardwareID)
+	}
+	if license.IsTrial() {
+		fmt.Printf("  Type: trial (%d days from first run)\n", license.TrialDays)
+	}
+	if license.IsFloating() {
+		fmt.Printf("  Type: floating (%d concurrent leases)\n", license.MaxSeats)
+	}
+	if license.IsSiteLicense() {
+		fmt.Printf("  Machines: %d", len(license.HardwareIDs))
+		if license.MaxSeats > 0 {
+			fmt.Printf(" (seat cap %d)", license.MaxSeats)
+		}
+		fmt.Println()
+	}
 	fmt.Printf("  Customer: %s", license.CustomerName)
 	if license.CustomerOrg != "" {
 		fmt.Printf(" (%s)", license.CustomerOrg)
 	}
 	fmt.Println()
 	fmt.Printf("  Customer ID: %s\n", license.CustomerID)
-	fmt.Printf("  Edition: %s\n", license.Edition)
+	if license.IsAddon() {
+		fmt.Printf("  Type: add-on (base serial %s)\n", license.BaseSerial)
+	} else {
+		fmt.Printf("  Edition: %s\n", license.Edition)
+	}
 	fmt.Printf("  Serial Number: %s\n", license.SerialNumber)
 	fmt.Printf("  Issued At: %s\n", time.Unix(license.IssuedAt, 0).Format("2006-01-02 15:04:05"))
 	fmt.Printf("  Expires At: %s\n", time.Unix(license.ExpiresAt, 0).Format("2006-01-02 15:04:05"))
 	fmt.Printf("  Modules: %v\n", license.Modules)
-
-	return nil
+	if len(license.Claims) > 0 {
+		fmt.Printf("  Claims: %d custom claim(s)\n", len(license.Claims))
+	}
 }
 
 // generateCustomerID 生成客户ID
@@ -175,17 +683,28 @@ func generateSerialNumber(hardwareID string, edition shared.LicenseEdition) stri
 	return fmt.Sprintf("%s-%s", prefix, hex.EncodeToString(hash[:6]))
 }
 
+// generateAddonSerialNumber 生成增购授权序列号
+func generateAddonSerialNumber(hardwareID, baseSerial string, issuedAt time.Time) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("addon_%s_%s_%d", hardwareID, baseSerial, issuedAt.UnixNano())))
+	return fmt.Sprintf("NSA-%s", hex.EncodeToString(hash[:6])) // NScan Add-on
+}
+
+// generateTrialSerialNumber 生成试用授权序列号
+func generateTrialSerialNumber(issuedAt time.Time) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("trial_%d", issuedAt.UnixNano())))
+	return fmt.Sprintf("NST-%s", hex.EncodeToString(hash[:6])) // NScan Trial
+}
+
 // generateLicenseKey 生成授权密钥
 func generateLicenseKey(hardwareID string, edition shared.LicenseEdition) string {
 	hash := sha256.Sum256([]byte("license_key_" + hardwareID + string(edition)))
 	return hex.EncodeToString(hash[:16])
 }
 
-// deriveKeyFromHardware 从硬件指纹派生AES密钥
-func deriveKeyFromHardware(hardwareID string) []byte {
-	// 使用硬件指纹和固定salt生成密钥
-	data := hardwareID + "_license_key_salt_2024"
-	hash := sha256.Sum256([]byte(data))
+// deriveTrialKey 派生试用授权的AES密钥
+// 试用授权不绑定硬件，加密只用于保持文件格式一致，授权内容由签名保护
+func deriveTrialKey() []byte {
+	hash := sha256.Sum256([]byte("golicense_trial_license_key_2024"))
 	return hash[:]
 }
 
@@ -235,4 +754,4 @@ func getFeaturesForEdition(edition shared.LicenseEdition) []string {
 	default:
 		return []string{"basic"}
 	}
-}
\ No newline at end of file
+}
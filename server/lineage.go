@@ -0,0 +1,172 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lengxu/golicense/shared"
+)
+
+// LicenseChange 续订或升级对原授权的修改，零值字段保持原授权不变
+type LicenseChange struct {
+	ExpiresAt int64                 // 新的到期时间
+	Edition   shared.LicenseEdition // 升级后的版本
+	Modules   []LicenseModule       // 追加的模块
+}
+
+// ReissueLicense 在原授权基础上签发续订或升级后的授权，不需要客户重新提交req.dat
+// 新授权沿用原授权的硬件绑定、安装公钥、客户、配额和自定义声明；版本不变时序列号也不变，
+// 签发记录中新授权记录原序列号，版本升级导致序列号变化时原授权在签发记录中结束
+func ReissueLicense(previous *IssuedLicense, change LicenseChange, opts LicenseOptions) (*License, string, error) {
+	old := previous.License
+	if old.IsTrial() {
+		return nil, "", errors.New("trial licenses cannot be renewed or upgraded, issue a full license instead")
+	}
+
+	license := *old
+	license.Modules = append([]LicenseModule(nil), old.Modules...)
+	license.ModulePerms = append([]ModulePermissions(nil), old.ModulePerms...)
+	license.Features = append([]string(nil), old.Features...)
+	license.IssuedAt = time.Now().Unix()
+	license.ExpiresAt = previous.ExpiresAt
+	if change.ExpiresAt != 0 {
+		license.ExpiresAt = change.ExpiresAt
+	}
+	if license.ExpiresAt <= license.IssuedAt {
+		return nil, "", fmt.Errorf("license would already be expired on %s", time.Unix(license.ExpiresAt, 0).Format("2006-01-02"))
+	}
+
+	if change.Edition != "" && change.Edition != old.Edition {
+		if err := upgradeEdition(&license, change.Edition); err != nil {
+			return nil, "", err
+		}
+	}
+	for _, module := range change.Modules {
+		if containsModule(license.Modules, module) {
+			continue
+		}
+		license.Modules = append(license.Modules, module)
+		if perm, ok := shared.GetDefaultModulePermission(module); ok {
+			license.ModulePerms = append(license.ModulePerms, perm)
+		}
+	}
+
+	encodedString, err := encodeLicenseFile(&license, previous.Keys)
+	if err != nil {
+		return nil, "", err
+	}
+	opts.previous = previous
+	if err := recordLicense(opts, nil, license, encodedString); err != nil {
+		return nil, "", err
+	}
+	return &license, encodedString, nil
+}
+
+// editionRank 版本等级，只允许升级到更高等级
+var editionRank = map[shared.LicenseEdition]int{
+	shared.EditionBasic:      1,
+	shared.EditionEnterprise: 2,
+}
+
+// upgradeEdition 将授权升级到更高版本：模块、功能和配额换成新版本的默认值，
+// 保留原授权在版本之外额外购买的模块和功能；序列号和授权密钥按新版本重新生成
+func upgradeEdition(license *License, edition shared.LicenseEdition) error {
+	if license.IsAddon() {
+		return errors.New("add-on licenses have no edition to upgrade, upgrade the base license instead")
+	}
+	from, to := editionRank[license.Edition], editionRank[edition]
+	if from == 0 || to == 0 {
+		return fmt.Errorf("cannot upgrade from edition %s to %s", license.Edition, edition)
+	}
+	if to < from {
+		return fmt.Errorf("downgrading from %s to %s is not supported, issue a new license instead", license.Edition, edition)
+	}
+
+	editionModules := shared.GetModulesForEdition(license.Edition)
+	modules := shared.GetModulesForEdition(edition)
+	perms := shared.GetDefaultModulePermissions(edition)
+	for _, perm := range license.ModulePerms {
+		if !containsModule(editionModules, perm.Module) && !containsModule(modules, perm.Module) {
+			modules = append(modules, perm.Module)
+			perms = append(perms, perm)
+		}
+	}
+	for _, module := range license.Modules {
+		if !containsModule(modules, module) {
+			modules = append(modules, module)
+		}
+	}
+	features := getFeaturesForEdition(edition)
+	for _, feature := range license.Features {
+		if !containsString(features, feature) {
+			features = append(features, feature)
+		}
+	}
+
+	bindingID := license.HardwareID
+	switch {
+	case license.IsSiteLicense():
+		bindingID = strings.Join(license.HardwareIDs, ",")
+	case license.IsFloating():
+		bindingID = "floating:" + license.HardwareID
+	}
+
+	license.Edition = edition
+	license.Modules = modules
+	license.ModulePerms = perms
+	license.Features = features
+	license.MaxScans = getMaxScansForEdition(edition)
+	license.MaxAssets = getMaxAssetsForEdition(edition)
+	license.MaxUsers = getMaxUsersForEdition(edition)
+	license.SerialNumber = generateSerialNumber(bindingID, edition)
+	if license.IsSiteLicense() {
+		license.LicenseKey = generateLicenseKey(bindingID, edition)
+	} else {
+		license.LicenseKey = generateLicenseKey(license.HardwareID, edition)
+	}
+	return nil
+}
+
+// recordLineage 在新授权的签发记录中沿用原授权的请求标识和安装公钥，并记录原序列号
+func recordLineage(entry *LedgerEntry, previous *IssuedLicense) {
+	entry.PreviousSerial = previous.License.SerialNumber
+	entry.InstallKeys = previous.Keys
+	if previous.Entry != nil {
+		entry.RequestIDs = previous.Entry.RequestIDs
+		entry.Entitlement = previous.Entry.Entitlement
+	}
+}
+
+// recordSuperseded 升级后序列号变化时，在签发记录中结束原授权
+func recordSuperseded(opts LicenseOptions, license *License) error {
+	return closeSerial(opts, opts.previous.License.SerialNumber, func(entry *LedgerEntry) {
+		entry.SupersededBy = license.SerialNumber
+	})
+}
+
+// closeSerial 在签发记录中结束一个序列号：追加一条到期时间为当前时间的记录，由mark标记去向
+// 结束记录不是新的签发，不沿用原记录的迁移来源，否则迁移次数统计会多算一次
+func closeSerial(opts LicenseOptions, serial string, mark func(entry *LedgerEntry)) error {
+	entries, err := opts.Ledger.FindBySerial(serial)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	entry := entries[len(entries)-1]
+	entry.ExpiresAt = time.Now().Unix()
+	entry.Issuer = opts.Issuer
+	entry.Renewal = false
+	entry.Reissued = false
+	entry.TransferredFrom = ""
+	entry.TransferReceipt = ""
+	entry.RecordedAt = time.Now().Unix()
+	mark(&entry)
+	if err := opts.Ledger.Append(entry); err != nil {
+		return fmt.Errorf("license recorded but %s was not closed in ledger: %v", serial, err)
+	}
+	return nil
+}
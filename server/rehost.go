@@ -0,0 +1,227 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lengxu/golicense/shared"
+)
+
+// DefaultMaxTransfersPerYear licgen默认允许的每年迁移次数
+const DefaultMaxTransfersPerYear = 1
+
+// TransferSpec 授权迁移：凭原机器的停用回执为新机器签发授权，沿用原授权的剩余期限、模块和配额
+type TransferSpec struct {
+	Receipt    *DeactivationReceipt // 原机器生成的停用回执
+	MaxPerYear int                  // 同一授权过去一年内允许的迁移次数，0表示不限制
+
+	previous  *License // 回执中经过签名核对的原授权
+	expiresAt int64    // 原授权的到期时间，包含离线续期
+	receiptID string   // 回执中授权文件的标识
+}
+
+// TransferLimitError 授权过去一年内的迁移次数已达到上限
+type TransferLimitError struct {
+	Limit    int           // 每年允许的迁移次数
+	Previous []LedgerEntry // 过去一年内的迁移记录
+}
+
+// Error 实现error接口
+func (e *TransferLimitError) Error() string {
+	return fmt.Sprintf("license has already been transferred %d time(s) in the past year (limit %d)", len(e.Previous), e.Limit)
+}
+
+// ErrReceiptAlreadyUsed 停用回执已经换取过迁移授权
+var ErrReceiptAlreadyUsed = errors.New("deactivation receipt has already been used for a transfer")
+
+// ReadDeactivationReceipt 读取并解密停用回执文件
+func ReadDeactivationReceipt(path string) (*DeactivationReceipt, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deactivation receipt: %v", err)
+	}
+	return ParseDeactivationReceipt(string(data))
+}
+
+// ParseDeactivationReceipt 解密停用回执，回执中的授权需经verifyTransfer核对后才可信
+func ParseDeactivationReceipt(encoded string) (*DeactivationReceipt, error) {
+	encoded = strings.TrimSpace(encoded)
+	if !strings.HasPrefix(encoded, shared.DeactivationReceiptPrefix) {
+		return nil, errors.New("not a deactivation receipt")
+	}
+	var file RequestFile
+	if err := DecodeFromString(encoded, &file); err != nil {
+		return nil, fmt.Errorf("failed to decode deactivation receipt: %v", err)
+	}
+	if file.Version != shared.DeactivationReceiptFormat {
+		return nil, fmt.Errorf("unsupported deactivation receipt format %s", file.Version)
+	}
+	plaintext, err := openRequestFile(&file)
+	if err != nil {
+		return nil, err
+	}
+
+	var receipt DeactivationReceipt
+	if err := json.Unmarshal(plaintext, &receipt); err != nil {
+		return nil, fmt.Errorf("failed to parse deactivation receipt: %v", err)
+	}
+	if receipt.SerialNumber == "" || receipt.License == "" || receipt.Payload == "" {
+		return nil, errors.New("deactivation receipt is incomplete")
+	}
+	if file.Timestamp != receipt.DeactivatedAt {
+		return nil, errors.New("deactivation receipt timestamp has been modified")
+	}
+	return &receipt, nil
+}
+
+// verifyTransfer 核对停用回执并检查迁移次数，通过后将原授权保存在opts.Transfer中
+// 回执中的license.dat必须与签发记录中的原文一致，载荷必须与信封签名一致
+func verifyTransfer(opts *LicenseOptions, requests []*LicenseRequest) error {
+	transfer := opts.Transfer
+	if opts.Ledger == nil {
+		return errors.New("transferring a license requires a ledger")
+	}
+	if opts.Addon != nil || opts.Floating > 0 || opts.MaxSeats > 0 || len(requests) != 1 {
+		return errors.New("a license is transferred to a single machine")
+	}
+	receipt := transfer.Receipt
+
+	// 1. 回执中的授权必须是签发记录中的原文
+	entries, err := opts.Ledger.FindBySerial(receipt.SerialNumber)
+	if err != nil {
+		return err
+	}
+	recorded := false
+	for _, entry := range entries {
+		if entry.Encoded == receipt.License {
+			recorded = true
+		}
+	}
+	if !recorded {
+		return fmt.Errorf("license %s in the deactivation receipt is not recorded in the ledger", receipt.SerialNumber)
+	}
+	if err := checkSuperseded(&entries[len(entries)-1]); err != nil {
+		return err
+	}
+
+	// 2. 回执中的载荷与签发时的信封签名一致，从中取得原授权的全部内容
+	previous, err := openIssuedLicense(receipt)
+	if err != nil {
+		return err
+	}
+	if previous.SerialNumber != receipt.SerialNumber || previous.HardwareID != receipt.HardwareID {
+		return errors.New("deactivation receipt does not match its license")
+	}
+	if previous.LicenseType != "" && previous.LicenseType != shared.LicenseTypeStandard || previous.IsSiteLicense() {
+		return fmt.Errorf("%s license %s cannot be transferred", previous.LicenseType, previous.SerialNumber)
+	}
+	if requests[0].HardwareID == previous.HardwareID {
+		return errors.New("the new machine is the machine the license was deactivated on")
+	}
+
+	// 3. 剩余期限以签发记录为准，包含离线续期；回执中的到期时间由客户端填写，只作参考
+	expiresAt := previous.ExpiresAt
+	for _, entry := range entries {
+		if entry.Renewal && entry.ExpiresAt > expiresAt {
+			expiresAt = entry.ExpiresAt
+		}
+	}
+	if expiresAt <= time.Now().Unix() {
+		return fmt.Errorf("license %s expired on %s, nothing left to transfer", previous.SerialNumber,
+			time.Unix(expiresAt, 0).Format("2006-01-02"))
+	}
+
+	// 4. 同一回执只能使用一次，同一授权（按客户ID）过去一年内的迁移次数不超过上限
+	receiptHash := sha256.Sum256([]byte(receipt.License))
+	receiptID := hex.EncodeToString(receiptHash[:16])
+	all, err := opts.Ledger.Entries()
+	if err != nil {
+		return err
+	}
+	yearAgo := time.Now().AddDate(-1, 0, 0).Unix()
+	var recent []LedgerEntry
+	for _, entry := range all {
+		// 只统计迁移签发的记录；旧版本写入的结束记录可能沿用了迁移来源，不计入
+		if entry.Renewal || entry.TransferredFrom == "" || entry.TransferredTo != "" || entry.SupersededBy != "" {
+			continue
+		}
+		if entry.TransferReceipt == receiptID {
+			return ErrReceiptAlreadyUsed
+		}
+		if entry.CustomerID == previous.CustomerID && entry.RecordedAt >= yearAgo {
+			recent = append(recent, entry)
+		}
+	}
+	if transfer.MaxPerYear > 0 && len(recent) >= transfer.MaxPerYear {
+		return &TransferLimitError{Limit: transfer.MaxPerYear, Previous: recent}
+	}
+
+	transfer.previous = previous
+	transfer.expiresAt = expiresAt
+	transfer.receiptID = receiptID
+	return nil
+}
+
+// openIssuedLicense 用签发时的公钥核对回执中的载荷与license.dat的信封签名一致
+func openIssuedLicense(receipt *DeactivationReceipt) (*License, error) {
+	var file LicenseFile
+	if err := DecodeFromString(receipt.License, &file); err != nil {
+		return nil, fmt.Errorf("failed to decode license in deactivation receipt: %v", err)
+	}
+	if !shared.IsEnvelopeFormat(file.Version) {
+		return nil, fmt.Errorf("license format %s cannot be transferred", file.Version)
+	}
+	payload, err := base64.StdEncoding.DecodeString(receipt.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode license payload: %v", err)
+	}
+	license, err := verifyIssuedPayload(&file, payload)
+	if err != nil {
+		return nil, fmt.Errorf("deactivation receipt: %v", err)
+	}
+	return license, nil
+}
+
+// buildTransferLicense 为新机器生成迁移授权：沿用原授权的客户、版本、模块、配额和自定义声明，
+// 到期时间不变，序列号和授权密钥按新机器重新生成
+func buildTransferLicense(request *LicenseRequest, transfer *TransferSpec) License {
+	license := *transfer.previous
+	license.HardwareID = request.HardwareID
+	license.IssuedAt = time.Now().Unix()
+	license.ExpiresAt = transfer.expiresAt
+	license.RequestID = request.RequestID
+	license.LicenseKey = generateLicenseKey(request.HardwareID, license.Edition)
+	license.SerialNumber = generateSerialNumber(request.HardwareID, license.Edition)
+	return license
+}
+
+// recordTransfer 在签发记录中结束原授权：追加一条到期时间为迁移时间、指向新序列号的记录
+func recordTransfer(opts LicenseOptions, license *License) error {
+	return closeSerial(opts, opts.Transfer.Receipt.SerialNumber, func(entry *LedgerEntry) {
+		entry.TransferredTo = license.SerialNumber
+	})
+}
+
+// Revocation 迁移签发成功后吊销原授权文件的记录，停用记录保存在原机器上可以被删除，
+// 吊销列表保证原授权文件在任何机器上都不能再使用
+func (t *TransferSpec) Revocation() (RevokedLicense, error) {
+	if t.previous == nil {
+		return RevokedLicense{}, errors.New("transfer has not been verified")
+	}
+	var file LicenseFile
+	if err := DecodeFromString(t.Receipt.License, &file); err != nil {
+		return RevokedLicense{}, fmt.Errorf("failed to decode transferred license: %v", err)
+	}
+	return RevokedLicense{
+		SerialNumber: t.Receipt.SerialNumber,
+		LicenseID:    shared.LicenseFileID(t.previous, &file),
+		Reason:       shared.RevocationReasonSuperseded,
+	}, nil
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lengxu/golicense/shared"
+)
+
+// ParseRenewalChallenge 解析客户提供的续期申请码
+func ParseRenewalChallenge(code string) (*RenewalChallenge, error) {
+	sealed, err := Base58Decode(shared.NormalizeActivationCode(code))
+	if err != nil {
+		return nil, errors.New("invalid renewal request code: contains invalid characters")
+	}
+	payload, err := shared.OpenRenewalCode(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid renewal request code: %v", err)
+	}
+	challenge, err := shared.ParseRenewalChallenge(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid renewal request code: %v", err)
+	}
+	return challenge, nil
+}
+
+// ErrRenewalKeyUnsupported 签名私钥不能签发离线续期码
+var ErrRenewalKeyUnsupported = errors.New("offline renewal requires an Ed25519 or ECDSA P-256 signing key: RSA signatures make renewal codes too long")
+
+// CheckRenewalKey 检查当前签名私钥能否签发离线续期码
+func CheckRenewalKey() error {
+	signingKey, err := GetSigningKey()
+	if err != nil {
+		return err
+	}
+	alg, err := shared.SignatureAlgorithmForKey(signingKey.Public())
+	if err != nil {
+		return err
+	}
+	if !shared.IsRenewalAlgorithm(alg) {
+		return ErrRenewalKeyUnsupported
+	}
+	return nil
+}
+
+// GenerateRenewalToken 用签名私钥为续期申请签发续期码，客户端应用后授权到期时间变为expiresAt
+// 续期码只对申请码中的序列号和授权文件有效，不改变授权的其他内容；签名私钥须为Ed25519或ECDSA
+func GenerateRenewalToken(challenge *RenewalChallenge, expiresAt time.Time) (string, error) {
+	if expiresAt.Unix() <= challenge.ExpiresAt {
+		return "", fmt.Errorf("renewal must extend the license beyond %s",
+			time.Unix(challenge.ExpiresAt, 0).Format("2006-01-02"))
+	}
+	if err := CheckRenewalKey(); err != nil {
+		return "", err
+	}
+	signingKey, err := GetSigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := shared.MarshalRenewalChallenge(challenge)
+	if err != nil {
+		return "", err
+	}
+	head, err := shared.MarshalRenewalTokenHead(expiresAt.Unix())
+	if err != nil {
+		return "", err
+	}
+	signature, _, err := SignBytes(shared.RenewalSigningInput(payload, head), signingKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign renewal code: %v", err)
+	}
+
+	token := append(append([]byte(nil), head...), signature...)
+	return shared.FormatActivationCode(Base58Encode(shared.SealRenewalCode(token))), nil
+}
+
+// RecordRenewal 在签发记录中追加续期记录，沿用该序列号最近一次记录的客户和授权内容
+// 签发记录中没有该序列号时返回nil
+func RecordRenewal(ledger *Ledger, challenge *RenewalChallenge, expiresAt time.Time, issuer string) (*LedgerEntry, error) {
+	entries, err := ledger.FindBySerial(challenge.SerialNumber)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	entry := entries[len(entries)-1]
+	entry.ExpiresAt = expiresAt.Unix()
+	entry.Issuer = issuer
+	entry.Renewal = true
+	entry.Reissued = false
+	entry.RecordedAt = time.Now().Unix()
+	if keyID, err := GetKeyID(); err == nil {
+		entry.KeyID = keyID
+	}
+	if err := ledger.Append(entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
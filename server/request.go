@@ -0,0 +1,165 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lengxu/golicense/shared"
+)
+
+// RejectReason 请求被拒绝的原因
+type RejectReason string
+
+// 请求拒绝原因
+const (
+	RejectUnreadable        RejectReason = "unreadable"         // 无法读取请求文件
+	RejectMalformed         RejectReason = "malformed"          // 请求文件格式错误
+	RejectUnsupported       RejectReason = "unsupported"        // 不支持的请求格式版本
+	RejectUnknownKey        RejectReason = "unknown_key"        // 请求加密所用的服务端密钥未加载
+	RejectDecryptFailed     RejectReason = "decrypt_failed"     // 解密失败，请求文件被修改或损坏
+	RejectHashMismatch      RejectReason = "hash_mismatch"      // 请求数据与hash不一致
+	RejectTimestampMismatch RejectReason = "timestamp_mismatch" // 文件时间戳与请求数据不一致
+	RejectStale             RejectReason = "stale"              // 请求已超过最长有效期
+	RejectFutureTimestamp   RejectReason = "future_timestamp"   // 请求时间晚于当前时间
+)
+
+// requestClockSkew 允许请求时间超前的时钟误差
+const requestClockSkew = 5 * time.Minute
+
+// RequestRejectedError 请求文件未通过校验
+type RequestRejectedError struct {
+	Path   string       // 请求文件路径
+	Reason RejectReason // 拒绝原因
+	Detail string       // 详细信息
+}
+
+// Error 实现error接口
+func (e *RequestRejectedError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("request rejected (%s): %s", e.Reason, e.Detail)
+	}
+	return fmt.Sprintf("%s: request rejected (%s): %s", e.Path, e.Reason, e.Detail)
+}
+
+// readRequestFile 读取、解密并校验req.dat
+// maxAge大于0时拒绝生成时间早于maxAge的请求
+func readRequestFile(reqFilePath string, maxAge time.Duration) (*LicenseRequest, error) {
+	reqData, err := os.ReadFile(reqFilePath)
+	if err != nil {
+		return nil, &RequestRejectedError{Path: reqFilePath, Reason: RejectUnreadable, Detail: fmt.Sprintf("failed to read request file: %v", err)}
+	}
+
+	request, err := ParseRequest(string(reqData), maxAge)
+	if rejected, ok := err.(*RequestRejectedError); ok {
+		rejected.Path = reqFilePath
+	}
+	return request, err
+}
+
+// ParseRequest 解密并校验req.dat内容，用于在线激活等不经过文件的场景
+// maxAge大于0时拒绝生成时间早于maxAge的请求
+func ParseRequest(encoded string, maxAge time.Duration) (*LicenseRequest, error) {
+	reject := func(reason RejectReason, format string, args ...interface{}) error {
+		return &RequestRejectedError{Reason: reason, Detail: fmt.Sprintf(format, args...)}
+	}
+
+	var reqFile RequestFile
+	if err := DecodeFromString(strings.TrimSpace(encoded), &reqFile); err != nil {
+		return nil, reject(RejectMalformed, "failed to decode request file: %v", err)
+	}
+	if reqFile.Version != shared.RequestFormatLegacy && reqFile.Version != shared.RequestFormatAEAD {
+		return nil, reject(RejectUnsupported, "unsupported request format %s", reqFile.Version)
+	}
+
+	plaintext, err := openRequestFile(&reqFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var request LicenseRequest
+	if err := json.Unmarshal(plaintext, &request); err != nil {
+		return nil, reject(RejectMalformed, "failed to parse request data: %v", err)
+	}
+	if request.HardwareID == "" {
+		return nil, reject(RejectMalformed, "request has no hardware ID")
+	}
+
+	// 验证请求时间
+	if reqFile.Version == shared.RequestFormatAEAD && reqFile.Timestamp != request.Timestamp {
+		return nil, reject(RejectTimestampMismatch, "file timestamp %d does not match request timestamp %d", reqFile.Timestamp, request.Timestamp)
+	}
+	requestTime := time.Unix(request.Timestamp, 0)
+	now := time.Now()
+	if requestTime.After(now.Add(requestClockSkew)) {
+		return nil, reject(RejectFutureTimestamp, "request was generated at %s, which is in the future", requestTime.Format("2006-01-02 15:04:05"))
+	}
+	if maxAge > 0 && now.Sub(requestTime) > maxAge {
+		return nil, reject(RejectStale, "request was generated at %s, older than the maximum age of %s", requestTime.Format("2006-01-02 15:04:05"), maxAge)
+	}
+
+	return &request, nil
+}
+
+// openRequestFile 解密req.dat容器并校验数据hash，返回加密前的JSON明文
+// 停用回执使用同样的容器，只是格式版本不同
+func openRequestFile(reqFile *RequestFile) ([]byte, error) {
+	reject := func(reason RejectReason, format string, args ...interface{}) error {
+		return &RequestRejectedError{Reason: reason, Detail: fmt.Sprintf(format, args...)}
+	}
+
+	privateKeys, err := requestKeys(reqFile.KeyID)
+	if err == ErrNoSigningKey || err == ErrNoRequestKey {
+		return nil, err
+	}
+	if err != nil {
+		return nil, reject(RejectUnknownKey, "%v", err)
+	}
+
+	// 解码RSA加密的AES密钥
+	encryptedKey, err := base64.StdEncoding.DecodeString(reqFile.Key)
+	if err != nil {
+		return nil, reject(RejectMalformed, "failed to decode encrypted key: %v", err)
+	}
+
+	// 解密AES密钥，旧请求未记录密钥标识时依次尝试当前和历史私钥
+	var aesKey []byte
+	for _, privateKey := range privateKeys {
+		if aesKey, err = RSADecrypt(encryptedKey, privateKey); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, reject(RejectDecryptFailed, "failed to decrypt AES key: %v", err)
+	}
+
+	// 解码请求数据
+	encryptedData, err := base64.StdEncoding.DecodeString(reqFile.Data)
+	if err != nil {
+		return nil, reject(RejectMalformed, "failed to decode encrypted data: %v", err)
+	}
+
+	// 解密请求数据，新格式的hash、时间戳和密钥标识作为附加数据参与认证
+	var additionalData []byte
+	if reqFile.Version != shared.RequestFormatLegacy {
+		if additionalData, err = shared.RequestAdditionalData(reqFile); err != nil {
+			return nil, reject(RejectMalformed, "failed to encode request header: %v", err)
+		}
+	}
+	plaintext, err := AESDecryptBytesWithAAD(encryptedData, aesKey, additionalData)
+	if err != nil {
+		return nil, reject(RejectDecryptFailed, "request data or header has been modified")
+	}
+
+	// 验证请求数据完整性：hash是加密前JSON明文的SHA256
+	actualHash := sha256.Sum256(plaintext)
+	if hex.EncodeToString(actualHash[:]) != reqFile.Hash {
+		return nil, reject(RejectHashMismatch, "expected %s, got %s", hex.EncodeToString(actualHash[:]), reqFile.Hash)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lengxu/golicense/shared"
+)
+
+// EncodeRevocationList 用当前签名私钥签名吊销列表，返回revoked.dat内容
+func EncodeRevocationList(list *RevocationList) (string, error) {
+	signingKey, err := GetSigningKey()
+	if err != nil {
+		return "", err
+	}
+	keyID, err := GetKeyID()
+	if err != nil {
+		return "", fmt.Errorf("failed to compute key ID: %v", err)
+	}
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode revocation list: %v", err)
+	}
+
+	alg, err := shared.SignatureAlgorithmForKey(signingKey.Public())
+	if err != nil {
+		return "", err
+	}
+	file := SignedRevocationList{
+		Version:   shared.RevocationFormat,
+		Algorithm: alg,
+		KeyID:     keyID,
+		Data:      base64.StdEncoding.EncodeToString(data),
+	}
+	signingInput, err := shared.RevocationSigningInput(&file)
+	if err != nil {
+		return "", fmt.Errorf("failed to build revocation list header: %v", err)
+	}
+	signature, _, err := SignBytes(signingInput, signingKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign revocation list: %v", err)
+	}
+	file.Signature = base64.StdEncoding.EncodeToString(signature)
+
+	return encodeWithPrefix(file, shared.RevocationListPrefix)
+}
+
+// DecodeRevocationList 解码吊销列表并用当前签名公钥验证签名
+func DecodeRevocationList(encoded string) (*RevocationList, error) {
+	var file SignedRevocationList
+	if err := DecodeFromString(string(bytes.TrimSpace([]byte(encoded))), &file); err != nil {
+		return nil, fmt.Errorf("failed to decode revocation list: %v", err)
+	}
+	if file.Version != shared.RevocationFormat {
+		return nil, fmt.Errorf("unsupported revocation list format: %s", file.Version)
+	}
+
+	keyID, err := GetKeyID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute key ID: %v", err)
+	}
+	if file.KeyID != keyID {
+		return nil, fmt.Errorf("revocation list was signed by key %s, not the current signing key %s", file.KeyID, keyID)
+	}
+	publicKey, err := GetPublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(file.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode revocation list signature: %v", err)
+	}
+	signingInput, err := shared.RevocationSigningInput(&file)
+	if err != nil {
+		return nil, err
+	}
+	if !VerifySignature(file.Algorithm, signingInput, signature, publicKey) {
+		return nil, fmt.Errorf("revocation list signature verification failed")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(file.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode revocation list data: %v", err)
+	}
+	var list RevocationList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse revocation list: %v", err)
+	}
+	return &list, nil
+}
+
+// RevokeLicenses 将授权加入吊销列表文件，文件不存在时创建
+// 已吊销的授权文件保留原有记录；返回更新后的列表和新增的数量，没有新增时不改写文件
+func RevokeLicenses(path string, revoked []RevokedLicense) (*RevocationList, int, error) {
+	list := &RevocationList{}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		list, err = DecodeRevocationList(string(data))
+		if err != nil {
+			return nil, 0, err
+		}
+	case !os.IsNotExist(err):
+		return nil, 0, fmt.Errorf("failed to read revocation list: %v", err)
+	}
+
+	now := time.Now().Unix()
+	added := 0
+	for _, entry := range revoked {
+		if entry.SerialNumber == "" {
+			return nil, 0, fmt.Errorf("revoked license has no serial number")
+		}
+		if _, ok := list.Find(entry.SerialNumber, entry.LicenseID); ok {
+			continue
+		}
+		if entry.RevokedAt == 0 {
+			entry.RevokedAt = now
+		}
+		list.Revoked = append(list.Revoked, entry)
+		added++
+	}
+	if added == 0 {
+		return list, 0, nil
+	}
+
+	list.Sequence++
+	list.IssuedAt = now
+	encoded, err := EncodeRevocationList(list)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := os.WriteFile(path, []byte(encoded), 0644); err != nil {
+		return nil, 0, fmt.Errorf("failed to write revocation list: %v", err)
+	}
+	return list, added, nil
+}
@@ -0,0 +1,180 @@
+package shared
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 激活码二进制布局：
+//
+//	[0]      格式版本
+//	[1]      授权版本 (0 基础版, 1 旗舰版)
+//	[2]      额外模块位图，按 activationModules 的顺序
+//	[3:5]    授权天数
+//	[5:7]    可激活的机器数，0表示不限制
+//	[7:13]   随机标识
+//	[13:21]  HMAC-SHA256(密钥, 前缀 + [0:13]) 的前8字节，防止伪造
+//	[21:23]  SHA256([0:21]) 的前2字节，用于发现输入错误
+//
+// 整体Base58编码后每5个字符用 - 分组
+const (
+	activationCodeVersion  = 1
+	activationPayloadSize  = 13
+	ActivationIDSize       = 6
+	activationMACSize      = 8
+	activationChecksumSize = 2
+	activationCodeSize     = activationPayloadSize + activationMACSize + activationChecksumSize
+	activationGroupSize    = 5
+)
+
+// activationMACPrefix 激活码HMAC输入的域分隔前缀
+const activationMACPrefix = "GOLICENSE-CODE-V1\n"
+
+// activationModules 激活码模块位图中各位对应的模块，只能在末尾追加
+var activationModules = []LicenseModule{
+	ModuleAdmission,
+	ModuleVulnerabilityScan,
+	ModulePasswordAudit,
+	ModuleCameraScan,
+}
+
+// ErrActivationChecksum 激活码校验位错误，通常是输入错误
+var ErrActivationChecksum = errors.New("activation code checksum mismatch, please check for typos")
+
+// ActivationCode 激活码所代表的授权内容
+type ActivationCode struct {
+	ID      string          // 激活码标识(hex)，用于统计激活次数，不能用来激活
+	Edition LicenseEdition  // 授权版本
+	Modules []LicenseModule // 版本之外额外包含的模块
+	Days    int             // 授权天数，从激活时开始计算
+	Seats   int             // 可激活的机器数，0表示不限制
+}
+
+// MarshalActivationPayload 将激活码内容编码为二进制载荷，id为ActivationIDSize字节的随机标识
+func MarshalActivationPayload(code *ActivationCode, id []byte) ([]byte, error) {
+	if len(id) != ActivationIDSize {
+		return nil, fmt.Errorf("activation code id must be %d bytes", ActivationIDSize)
+	}
+	if code.Days <= 0 || code.Days > 0xFFFF {
+		return nil, fmt.Errorf("activation code duration must be between 1 and %d days", 0xFFFF)
+	}
+	if code.Seats < 0 || code.Seats > 0xFFFF {
+		return nil, fmt.Errorf("activation code seat count must be between 0 and %d", 0xFFFF)
+	}
+
+	payload := make([]byte, activationPayloadSize)
+	payload[0] = activationCodeVersion
+	switch code.Edition {
+	case EditionBasic:
+		payload[1] = 0
+	case EditionEnterprise:
+		payload[1] = 1
+	default:
+		return nil, fmt.Errorf("invalid edition: %s", code.Edition)
+	}
+	for _, module := range code.Modules {
+		bit := -1
+		for i, m := range activationModules {
+			if m == module {
+				bit = i
+			}
+		}
+		if bit < 0 {
+			return nil, fmt.Errorf("module %s cannot be encoded in an activation code", module)
+		}
+		payload[2] |= 1 << bit
+	}
+	binary.BigEndian.PutUint16(payload[3:5], uint16(code.Days))
+	binary.BigEndian.PutUint16(payload[5:7], uint16(code.Seats))
+	copy(payload[7:], id)
+	return payload, nil
+}
+
+// SealActivationCode 在载荷后附加HMAC和校验位，返回完整的激活码字节
+func SealActivationCode(payload []byte, mac []byte) []byte {
+	sealed := make([]byte, 0, activationCodeSize)
+	sealed = append(sealed, payload...)
+	sealed = append(sealed, mac[:activationMACSize]...)
+	checksum := sha256.Sum256(sealed)
+	return append(sealed, checksum[:activationChecksumSize]...)
+}
+
+// ActivationMACInput 生成激活码HMAC的输入
+func ActivationMACInput(payload []byte) []byte {
+	return append([]byte(activationMACPrefix), payload...)
+}
+
+// OpenActivationCode 检查激活码字节的长度和校验位，返回载荷和HMAC
+// 校验位只用于发现输入错误，激活码是否由授权方生成需由持有密钥的一方验证HMAC
+func OpenActivationCode(sealed []byte) (payload []byte, mac []byte, err error) {
+	if len(sealed) != activationCodeSize {
+		return nil, nil, errors.New("activation code has an invalid length")
+	}
+	body := sealed[:activationCodeSize-activationChecksumSize]
+	checksum := sha256.Sum256(body)
+	if string(checksum[:activationChecksumSize]) != string(sealed[len(body):]) {
+		return nil, nil, ErrActivationChecksum
+	}
+	return body[:activationPayloadSize], body[activationPayloadSize:], nil
+}
+
+// ParseActivationPayload 解析激活码载荷
+func ParseActivationPayload(payload []byte) (*ActivationCode, error) {
+	if len(payload) != activationPayloadSize {
+		return nil, errors.New("activation code has an invalid length")
+	}
+	if payload[0] != activationCodeVersion {
+		return nil, fmt.Errorf("unsupported activation code version %d", payload[0])
+	}
+
+	code := &ActivationCode{
+		ID:    hex.EncodeToString(payload[7:]),
+		Days:  int(binary.BigEndian.Uint16(payload[3:5])),
+		Seats: int(binary.BigEndian.Uint16(payload[5:7])),
+	}
+	switch payload[1] {
+	case 0:
+		code.Edition = EditionBasic
+	case 1:
+		code.Edition = EditionEnterprise
+	default:
+		return nil, fmt.Errorf("activation code has an invalid edition %d", payload[1])
+	}
+	for i, module := range activationModules {
+		if payload[2]&(1<<i) != 0 {
+			code.Modules = append(code.Modules, module)
+		}
+	}
+	if payload[2]>>len(activationModules) != 0 {
+		return nil, errors.New("activation code contains unknown modules")
+	}
+	if code.Days == 0 {
+		return nil, errors.New("activation code has no duration")
+	}
+	return code, nil
+}
+
+// NormalizeActivationCode 去除激活码中的分隔符和空白，便于用户粘贴带格式的激活码
+func NormalizeActivationCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', ' ', '\t', '\r', '\n':
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// FormatActivationCode 将Base58编码的激活码每5个字符用 - 分组
+func FormatActivationCode(encoded string) string {
+	var groups []string
+	for len(encoded) > activationGroupSize {
+		groups = append(groups, encoded[:activationGroupSize])
+		encoded = encoded[activationGroupSize:]
+	}
+	return strings.Join(append(groups, encoded), "-")
+}
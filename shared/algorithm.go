@@ -0,0 +1,42 @@
+package shared
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"fmt"
+)
+
+// 签名算法标识，与JOSE算法名一致
+const (
+	SignatureRS256 = "RS256" // RSA PKCS#1 v1.5 + SHA256，未记录算法的旧授权均为此算法
+	SignatureEdDSA = "EdDSA" // Ed25519
+	SignatureES256 = "ES256" // ECDSA P-256 + SHA256，签名为r||s各32字节
+)
+
+// SignatureAlgorithmForKey 根据公钥类型确定签名算法
+func SignatureAlgorithmForKey(publicKey crypto.PublicKey) (string, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return SignatureRS256, nil
+	case ed25519.PublicKey:
+		return SignatureEdDSA, nil
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return "", fmt.Errorf("unsupported ECDSA curve: %s", key.Curve.Params().Name)
+		}
+		return SignatureES256, nil
+	default:
+		return "", fmt.Errorf("unsupported public key type: %T", publicKey)
+	}
+}
+
+// NormalizeSignatureAlgorithm 规范化签名算法标识，空值视为RS256
+func NormalizeSignatureAlgorithm(alg string) string {
+	if alg == "" {
+		return SignatureRS256
+	}
+	return alg
+}
@@ -0,0 +1,66 @@
+package shared
+
+// 授权服务器HTTP接口路径
+const (
+	APIActivatePath = "/api/v1/activate" // 提交请求并获取授权
+	APIRenewPath    = "/api/v1/renew"    // 下载续期后的授权
+	APIStatusPath   = "/api/v1/status"   // 查询授权状态
+)
+
+// 授权服务器错误代码
+const (
+	APIErrorInvalidRequest      = "invalid_request"         // 请求格式错误
+	APIErrorRequestRejected     = "request_rejected"        // req.dat未通过校验
+	APIErrorUnknownEntitlement  = "unknown_entitlement"     // 授权标识不存在
+	APIErrorInvalidCode         = "invalid_activation_code" // 激活码无效
+	APIErrorEntitlementDisabled = "entitlement_disabled"    // 授权标识已停用或已过期
+	APIErrorSeatsExhausted      = "seats_exhausted"         // 可激活的机器数已用完
+	APIErrorAlreadyLicensed     = "already_licensed"        // 该机器已通过其他途径获得授权
+	APIErrorNotFound            = "not_found"               // 没有对应的授权
+	APIErrorRevoked             = "revoked"                 // 授权已被吊销
+	APIErrorInstallMismatch     = "installation_mismatch"   // 请求的安装公钥与已激活的安装不一致
+	APIErrorInternal            = "internal_error"          // 服务器内部错误
+)
+
+// 授权状态
+const (
+	LicenseStatusActive  = "active"  // 有效
+	LicenseStatusExpired = "expired" // 已过期
+	LicenseStatusRevoked = "revoked" // 已吊销
+)
+
+// ActivationRequest 在线激活和续期的请求体
+type ActivationRequest struct {
+	Entitlement    string `json:"entitlement,omitempty"`     // 授权标识，续期时不需要
+	ActivationCode string `json:"activation_code,omitempty"` // 激活码，未指定授权标识时使用
+	Request        string `json:"request"`                   // req.dat内容
+}
+
+// ActivationResponse 在线激活和续期的响应
+type ActivationResponse struct {
+	License      string `json:"license"`           // license.dat内容
+	SerialNumber string `json:"serial_number"`     // 授权序列号
+	ExpiresAt    int64  `json:"expires_at"`        // 过期时间
+	Renewed      bool   `json:"renewed,omitempty"` // 续期时是否签发了新的授权
+}
+
+// LicenseStatusResponse 授权状态查询的响应
+type LicenseStatusResponse struct {
+	SerialNumber string `json:"serial_number"`        // 授权序列号
+	Status       string `json:"status"`               // 授权状态
+	Edition      string `json:"edition,omitempty"`    // 授权版本
+	ExpiresAt    int64  `json:"expires_at"`           // 过期时间
+	RevokedAt    int64  `json:"revoked_at,omitempty"` // 吊销时间
+	Reason       string `json:"reason,omitempty"`     // 吊销原因
+}
+
+// APIError 授权服务器返回的错误
+type APIError struct {
+	Code    string `json:"code"`    // 错误代码
+	Message string `json:"message"` // 错误说明
+}
+
+// Error 实现error接口
+func (e *APIError) Error() string {
+	return e.Code + ": " + e.Message
+}
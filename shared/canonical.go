@@ -0,0 +1,72 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// 授权文件格式版本
+const (
+	LicenseFormatLegacy    = "2.0" // 签名覆盖重新序列化的License结构体
+	LicenseFormatCanonical = "3.0" // 签名覆盖签发时的规范化载荷字节
+)
+
+// CanonicalJSON 生成确定性的JSON编码
+// 对象键按字典序排列，数字保持原始文本，不转义HTML字符，结尾没有换行
+// 签名始终基于签发时生成的这份字节，验证时不再重新序列化结构体
+func CanonicalJSON(data interface{}) ([]byte, error) {
+	raw, err := marshalNoEscape(data)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	return marshalNoEscape(generic)
+}
+
+// marshalNoEscape JSON序列化，不转义HTML字符
+func marshalNoEscape(data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(data); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// CompareFormatVersion 比较两个点分格式版本号，返回-1、0或1
+// 空版本视为最早的旧版本
+func CompareFormatVersion(a, b string) int {
+	partsA := strings.Split(a, ".")
+	partsB := strings.Split(b, ".")
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var numA, numB int
+		if i < len(partsA) {
+			numA, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			numB, _ = strconv.Atoi(partsB[i])
+		}
+		if numA != numB {
+			if numA < numB {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// IsCanonicalFormat 授权文件是否使用规范化载荷签名
+func IsCanonicalFormat(version string) bool {
+	return CompareFormatVersion(version, LicenseFormatCanonical) >= 0
+}
@@ -0,0 +1,137 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Claim 获取自定义声明的原始值
+func (l *License) Claim(key string) (interface{}, bool) {
+	if l.Claims == nil {
+		return nil, false
+	}
+	value, ok := l.Claims[key]
+	return value, ok
+}
+
+// ClaimString 获取字符串类型的自定义声明
+func (l *License) ClaimString(key string) (string, bool) {
+	value, ok := l.Claim(key)
+	if !ok {
+		return "", false
+	}
+	str, ok := value.(string)
+	return str, ok
+}
+
+// ClaimInt 获取整数类型的自定义声明
+func (l *License) ClaimInt(key string) (int64, bool) {
+	value, ok := l.Claim(key)
+	if !ok {
+		return 0, false
+	}
+
+	switch v := value.(type) {
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, false
+		}
+		return int64(v), true
+	case json.Number:
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		return n, err == nil
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+// ClaimFloat 获取数值类型的自定义声明
+func (l *License) ClaimFloat(key string) (float64, bool) {
+	value, ok := l.Claim(key)
+	if !ok {
+		return 0, false
+	}
+
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// ClaimBool 获取布尔类型的自定义声明
+func (l *License) ClaimBool(key string) (bool, bool) {
+	value, ok := l.Claim(key)
+	if !ok {
+		return false, false
+	}
+	b, ok := value.(bool)
+	return b, ok
+}
+
+// ClaimStrings 获取字符串列表类型的自定义声明
+func (l *License) ClaimStrings(key string) ([]string, bool) {
+	value, ok := l.Claim(key)
+	if !ok {
+		return nil, false
+	}
+
+	switch v := value.(type) {
+	case []string:
+		return v, true
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			str, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			result = append(result, str)
+		}
+		return result, true
+	default:
+		return nil, false
+	}
+}
+
+// ParseClaimValue 解析 -claim-json 指定的声明值，必须是合法的JSON值（数字、布尔、数组、对象、带引号的字符串）；
+// 数字保留原始文本，避免大整数转为float64后丢失精度
+func ParseClaimValue(raw string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("invalid JSON claim value %q: %v", raw, err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("invalid JSON claim value %q: trailing data", raw)
+	}
+	if value == nil {
+		return nil, fmt.Errorf("invalid JSON claim value %q: null is not allowed", raw)
+	}
+	return value, nil
+}
+
+// UnmarshalLicense 解析授权载荷，自定义声明中的数字保留为json.Number，
+// 避免大整数编号转为float64后丢失精度
+func UnmarshalLicense(payload []byte, license *License) error {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	return decoder.Decode(license)
+}
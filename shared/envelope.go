@@ -0,0 +1,90 @@
+package shared
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// LicenseFormatEnvelope 签名覆盖信封头和载荷的授权文件格式版本
+const LicenseFormatEnvelope = "4.0"
+
+// LicenseEscrowFormat 签发记录中托管授权内容的格式版本，与req.dat使用同样的加密容器，
+// 用签发方的RSA公钥加密，版本不同保证托管内容不能被当作req.dat使用
+const LicenseEscrowFormat = "escrow-1.0"
+
+// envelopeSignaturePrefix 信封签名输入的域分隔前缀，防止签名被挪用到其他用途
+const envelopeSignaturePrefix = "GOLICENSE-V4\n"
+
+// 授权文件的绑定方式
+const (
+	BindingHardware = "hardware" // 单机授权，绑定一台机器
+	BindingSite     = "site"     // 多机授权，每台机器各有一份内容密钥
+	BindingTrial    = "trial"    // 试用授权，不绑定硬件
+)
+
+// LicenseHeader 授权文件信封头，由LicenseFile中除签名外的全部字段和载荷hash组成
+// 信封头不单独保存，签发和验证时都从授权文件重新构造，任何字段被修改都会导致签名失效
+type LicenseHeader struct {
+	Version     string             `json:"version"`              // 文件格式版本
+	Algorithm   string             `json:"alg"`                  // 签名算法
+	KeyID       string             `json:"key_id"`               // 签名密钥标识
+	Binding     string             `json:"binding"`              // 绑定方式
+	KDF         string             `json:"kdf,omitempty"`        // 授权密钥派生算法
+	Salt        string             `json:"salt,omitempty"`       // 授权密钥派生salt
+	Key         string             `json:"key,omitempty"`        // 单机授权的密钥校验值
+	Recipients  []LicenseRecipient `json:"recipients,omitempty"` // 多机授权的内容密钥接收方
+	DataHash    string             `json:"data_sha256"`          // 加密授权数据(base64文本)的SHA256
+	PayloadHash string             `json:"payload_sha256"`       // 解密后载荷的SHA256
+}
+
+// IsEnvelopeFormat 授权文件是否使用信封签名
+func IsEnvelopeFormat(version string) bool {
+	return CompareFormatVersion(version, LicenseFormatEnvelope) >= 0
+}
+
+// LicenseBinding 根据授权数据确定绑定方式
+func LicenseBinding(license *License) string {
+	switch {
+	case license.IsTrial():
+		return BindingTrial
+	case license.IsSiteLicense():
+		return BindingSite
+	default:
+		return BindingHardware
+	}
+}
+
+// BuildLicenseHeader 从授权文件和载荷构造信封头
+// 授权文件记录了绑定方式时以文件为准，否则使用调用方根据信封内容推断的绑定方式
+func BuildLicenseHeader(file *LicenseFile, binding string, payload []byte) LicenseHeader {
+	if file.Binding != "" {
+		binding = file.Binding
+	}
+	dataHash := sha256.Sum256([]byte(file.Data))
+	payloadHash := sha256.Sum256(payload)
+	return LicenseHeader{
+		Version:     file.Version,
+		Algorithm:   NormalizeSignatureAlgorithm(file.Algorithm),
+		KeyID:       file.KeyID,
+		Binding:     binding,
+		KDF:         file.KDF,
+		Salt:        file.Salt,
+		Key:         file.Key,
+		Recipients:  file.Recipients,
+		DataHash:    hex.EncodeToString(dataHash[:]),
+		PayloadHash: hex.EncodeToString(payloadHash[:]),
+	}
+}
+
+// LicenseSigningInput 生成信封签名的输入：域分隔前缀加规范化的信封头
+func LicenseSigningInput(header LicenseHeader) ([]byte, error) {
+	if header.KeyID == "" {
+		return nil, errors.New("license header has no key ID")
+	}
+	canonical, err := CanonicalJSON(header)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(envelopeSignaturePrefix), canonical...), nil
+}
@@ -0,0 +1,31 @@
+package shared
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// InstallationKeyFile 安装密钥文件名，reqgen生成在req.dat所在目录，客户端从license.dat所在目录读取
+const InstallationKeyFile = "installation.key"
+
+// 内容密钥接收方类型
+const (
+	RecipientTypeHardware = ""       // 用硬件指纹派生的密钥加密内容密钥
+	RecipientTypeX25519   = "x25519" // 用安装密钥对的X25519公钥加密内容密钥
+)
+
+// hkdfInfoX25519Wrap X25519密钥协商后派生包装密钥的info标签
+const hkdfInfoX25519Wrap = "golicense x25519 wrap v1"
+
+// InstallationKeyID 安装公钥的标识，作为X25519接收方的ID
+func InstallationKeyID(publicKey []byte) string {
+	hash := sha256.Sum256(publicKey)
+	return hex.EncodeToString(hash[:8])
+}
+
+// DeriveX25519WrapKey 从X25519共享密钥派生包装内容密钥的AES密钥
+// 临时公钥和接收方公钥作为salt，保证每次包装的密钥互不相同
+func DeriveX25519WrapKey(sharedSecret, ephemeralPublicKey, recipientPublicKey []byte) []byte {
+	salt := append(append([]byte(nil), ephemeralPublicKey...), recipientPublicKey...)
+	return HKDFSHA256(sharedSecret, salt, []byte(hkdfInfoX25519Wrap), 32)
+}
@@ -0,0 +1,52 @@
+package shared
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// 授权密钥派生算法标识
+const (
+	KDFLegacy     = ""               // sha256(硬件指纹 + 固定salt)，仅用于读取旧授权
+	KDFHKDFSHA256 = "hkdf-sha256-v1" // HKDF-SHA256，每份授权使用随机salt
+)
+
+// LicenseSaltSize 授权密钥派生salt的字节数
+const LicenseSaltSize = 32
+
+// HKDF派生时使用的info标签，加密密钥与密钥校验值互相独立
+const (
+	hkdfInfoLicenseKey = "golicense license key v1"
+	hkdfInfoKeyCheck   = "golicense license key check v1"
+)
+
+// HKDFSHA256 RFC 5869 HKDF-SHA256密钥派生
+func HKDFSHA256(secret, salt, info []byte, length int) []byte {
+	if len(salt) == 0 {
+		salt = make([]byte, sha256.Size)
+	}
+	extractor := hmac.New(sha256.New, salt)
+	extractor.Write(secret)
+	prk := extractor.Sum(nil)
+
+	expander := hmac.New(sha256.New, prk)
+	var okm, block []byte
+	for counter := byte(1); len(okm) < length; counter++ {
+		expander.Reset()
+		expander.Write(block)
+		expander.Write(info)
+		expander.Write([]byte{counter})
+		block = expander.Sum(nil)
+		okm = append(okm, block...)
+	}
+	return okm[:length]
+}
+
+// DeriveLicenseKey 用HKDF从绑定密钥材料（硬件指纹或试用密钥）派生授权加密密钥和密钥校验值
+// 校验值写入授权文件用于判断是否为本机授权，与加密密钥使用不同的info，不能由校验值推出加密密钥
+func DeriveLicenseKey(secret, salt []byte) (key []byte, check string) {
+	key = HKDFSHA256(secret, salt, []byte(hkdfInfoLicenseKey), 32)
+	check = hex.EncodeToString(HKDFSHA256(secret, salt, []byte(hkdfInfoKeyCheck), 16))
+	return key, check
+}
@@ -0,0 +1,18 @@
+package shared
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+)
+
+// KeyID 计算公钥标识：SubjectPublicKeyInfo DER的SHA256前8字节(hex)
+func KeyID(publicKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(der)
+	return hex.EncodeToString(hash[:8]), nil
+}
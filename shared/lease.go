@@ -0,0 +1,68 @@
+package shared
+
+// LeaseKeyFile 租约服务器的租约签名密钥文件名，与浮动授权的license.dat放在同一目录
+const LeaseKeyFile = "lease.key"
+
+// 租约服务器HTTP接口路径
+const (
+	LeaseCheckoutPath  = "/lease/v1/checkout"  // 借出租约
+	LeaseHeartbeatPath = "/lease/v1/heartbeat" // 续租
+	LeaseReleasePath   = "/lease/v1/release"   // 归还租约
+	LeaseStatusPath    = "/lease/v1/status"    // 查询租约池使用情况
+)
+
+// 租约服务器错误代码，响应格式与授权服务器相同(APIError)
+const (
+	LeaseErrorPoolExhausted  = "pool_exhausted"  // 并发数已用完
+	LeaseErrorNotFound       = "lease_not_found" // 租约不存在或已过期，需要重新借出
+	LeaseErrorLicenseInvalid = "license_invalid" // 浮动授权已过期或无效
+)
+
+// leaseSignaturePrefix 租约签名输入的域分隔前缀
+const leaseSignaturePrefix = "GOLICENSE-LEASE-V1\n"
+
+// LeaseRequest 借出、续租和归还租约的请求体
+type LeaseRequest struct {
+	ClientID    string `json:"client_id"`              // 客户端硬件指纹
+	MachineInfo string `json:"machine_info,omitempty"` // 客户端机器描述，便于管理员查看
+	LeaseID     string `json:"lease_id,omitempty"`     // 续租和归还时指定的租约标识
+}
+
+// Lease 租约内容
+type Lease struct {
+	LeaseID      string `json:"lease_id"`      // 租约标识
+	SerialNumber string `json:"serial_number"` // 浮动授权序列号
+	ClientID     string `json:"client_id"`     // 持有租约的客户端硬件指纹
+	IssuedAt     int64  `json:"issued_at"`     // 借出或最近续租时间
+	ExpiresAt    int64  `json:"expires_at"`    // 租约到期时间，到期前需续租
+}
+
+// SignedLease 租约服务器返回的租约
+// 客户端用浮动授权的签发方签名验证License和Payload，再用其中的租约公钥验证租约签名
+type SignedLease struct {
+	Data      string `json:"data"`              // 租约JSON(base64)
+	Signature string `json:"signature"`         // 租约公钥对Data的Ed25519签名(base64)
+	License   string `json:"license"`           // 浮动授权license.dat内容
+	Payload   string `json:"payload"`           // 浮动授权解密后的载荷(base64)
+	Renewal   string `json:"renewal,omitempty"` // 浮动授权的离线续期码
+}
+
+// LeasePoolStatus 租约池使用情况，接口不需要认证，不包含租约标识和客户端硬件指纹
+type LeasePoolStatus struct {
+	SerialNumber string         `json:"serial_number"` // 浮动授权序列号
+	MaxSeats     int            `json:"max_seats"`     // 最大并发数
+	InUse        int            `json:"in_use"`        // 当前借出的租约数
+	ExpiresAt    int64          `json:"expires_at"`    // 浮动授权到期时间
+	Leases       []LeaseSummary `json:"leases"`        // 当前借出的租约
+}
+
+// LeaseSummary 租约池状态中列出的租约，只包含时间信息
+type LeaseSummary struct {
+	IssuedAt  int64 `json:"issued_at"`  // 借出或最近续租时间
+	ExpiresAt int64 `json:"expires_at"` // 租约到期时间
+}
+
+// LeaseSigningInput 生成租约签名的输入
+func LeaseSigningInput(data string) []byte {
+	return []byte(leaseSignaturePrefix + data)
+}
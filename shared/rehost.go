@@ -0,0 +1,23 @@
+package shared
+
+// DeactivationReceiptFile 停用回执的默认文件名
+const DeactivationReceiptFile = "deactivation.dat"
+
+// DeactivationReceiptPrefix 停用回执文件的编码前缀
+const DeactivationReceiptPrefix = "DRC:"
+
+// DeactivationReceiptFormat 停用回执的格式版本，与req.dat使用同样的加密容器，
+// 版本不同保证回执不能被当作req.dat使用
+const DeactivationReceiptFormat = "deactivation-1.0"
+
+// DeactivationReceipt 停用回执：客户端在原机器上停用授权后生成，签发方凭此为新机器签发迁移授权
+// 回执包含只有原机器能解密的授权载荷，签发方用签发时的信封签名核对载荷，确认停用的是真实授权
+type DeactivationReceipt struct {
+	SerialNumber  string `json:"serial_number"`  // 停用的授权序列号
+	HardwareID    string `json:"hardware_id"`    // 原机器的硬件指纹
+	MachineInfo   string `json:"machine_info"`   // 原机器的描述信息
+	DeactivatedAt int64  `json:"deactivated_at"` // 停用时间
+	ExpiresAt     int64  `json:"expires_at"`     // 停用时的到期时间，包含已应用的离线续期
+	License       string `json:"license"`        // 停用的license.dat原文
+	Payload       string `json:"payload"`        // 解密后的授权载荷(base64)
+}
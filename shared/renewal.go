@@ -0,0 +1,146 @@
+package shared
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// RenewalTokenFile 离线续期码在授权文件目录下的文件名
+const RenewalTokenFile = "renewal.dat"
+
+// 续期申请码二进制布局：
+//
+//	[0]      格式版本
+//	[1:8]    授权序列号，前缀 NS 之后的字母 + 6字节hex部分
+//	[8:12]   license.dat中的到期时间（Unix秒）
+//	[12:14]  SHA256([0:12]) 的前2字节，用于发现输入错误
+//
+// 续期码二进制布局：
+//
+//	[0]      格式版本
+//	[1:5]    新的到期时间（Unix秒）
+//	[5:69]   签名私钥对 前缀 + 申请码[0:12] + 续期码[0:5] 的签名
+//	[69:71]  SHA256([0:69]) 的前2字节
+//
+// 两者都Base58编码后每5个字符用 - 分组。续期码绑定序列号和license.dat中的到期时间，
+// 授权重新签发后旧续期码自动失效；续期码写入的是绝对到期时间，重复使用不会叠加。
+// 续期码需要能通过电话口述，只支持签名为64字节的Ed25519和ECDSA P-256，不支持RSA
+const (
+	renewalVersion       = 1
+	renewalChallengeSize = 12
+	renewalTokenHeadSize = 5
+	renewalSignatureSize = 64
+	renewalChecksumSize  = 2
+)
+
+// renewalSigningPrefix 续期码签名输入的域分隔前缀
+const renewalSigningPrefix = "GOLICENSE-RENEW-V1\n"
+
+// ErrRenewalChecksum 续期申请码或续期码校验位错误，通常是输入错误
+var ErrRenewalChecksum = errors.New("renewal code checksum mismatch, please check for typos")
+
+// IsRenewalAlgorithm 签名算法能否用于离线续期码，RSA签名使续期码长达约700个字符，不支持
+func IsRenewalAlgorithm(alg string) bool {
+	return alg == SignatureEdDSA || alg == SignatureES256
+}
+
+// RenewalChallenge 续期申请码的内容
+type RenewalChallenge struct {
+	SerialNumber string // 授权序列号
+	ExpiresAt    int64  // license.dat中的到期时间，不含已应用的续期
+}
+
+// MarshalRenewalChallenge 将续期申请内容编码为二进制载荷（不含校验位）
+func MarshalRenewalChallenge(challenge *RenewalChallenge) ([]byte, error) {
+	serial := challenge.SerialNumber
+	if len(serial) != 16 || !strings.HasPrefix(serial, "NS") || serial[3] != '-' {
+		return nil, fmt.Errorf("serial number %s cannot be encoded in a renewal code", serial)
+	}
+	id, err := hex.DecodeString(serial[4:])
+	if err != nil || len(id) != 6 {
+		return nil, fmt.Errorf("serial number %s cannot be encoded in a renewal code", serial)
+	}
+	if challenge.ExpiresAt <= 0 || challenge.ExpiresAt > math.MaxUint32 {
+		return nil, errors.New("license expiry cannot be encoded in a renewal code")
+	}
+
+	payload := make([]byte, renewalChallengeSize)
+	payload[0] = renewalVersion
+	payload[1] = serial[2]
+	copy(payload[2:8], id)
+	binary.BigEndian.PutUint32(payload[8:12], uint32(challenge.ExpiresAt))
+	return payload, nil
+}
+
+// ParseRenewalChallenge 解析续期申请码载荷（不含校验位）
+func ParseRenewalChallenge(payload []byte) (*RenewalChallenge, error) {
+	if len(payload) != renewalChallengeSize {
+		return nil, errors.New("renewal request code has an invalid length")
+	}
+	if payload[0] != renewalVersion {
+		return nil, fmt.Errorf("unsupported renewal request code version %d", payload[0])
+	}
+	if payload[1] < 'A' || payload[1] > 'Z' {
+		return nil, errors.New("renewal request code has an invalid serial number")
+	}
+	return &RenewalChallenge{
+		SerialNumber: fmt.Sprintf("NS%c-%s", payload[1], hex.EncodeToString(payload[2:8])),
+		ExpiresAt:    int64(binary.BigEndian.Uint32(payload[8:12])),
+	}, nil
+}
+
+// MarshalRenewalTokenHead 编码续期码中签名之前的部分
+func MarshalRenewalTokenHead(expiresAt int64) ([]byte, error) {
+	if expiresAt <= 0 || expiresAt > math.MaxUint32 {
+		return nil, errors.New("renewal expiry cannot be encoded in a renewal code")
+	}
+	head := make([]byte, renewalTokenHeadSize)
+	head[0] = renewalVersion
+	binary.BigEndian.PutUint32(head[1:], uint32(expiresAt))
+	return head, nil
+}
+
+// SplitRenewalToken 拆分续期码载荷（不含校验位），返回新的到期时间、签名前的部分和签名
+func SplitRenewalToken(payload []byte) (expiresAt int64, head []byte, signature []byte, err error) {
+	if len(payload) != renewalTokenHeadSize+renewalSignatureSize {
+		return 0, nil, nil, errors.New("renewal code has an invalid length")
+	}
+	if payload[0] != renewalVersion {
+		return 0, nil, nil, fmt.Errorf("unsupported renewal code version %d", payload[0])
+	}
+	head = payload[:renewalTokenHeadSize]
+	return int64(binary.BigEndian.Uint32(head[1:])), head, payload[renewalTokenHeadSize:], nil
+}
+
+// RenewalSigningInput 生成续期码的签名输入
+func RenewalSigningInput(challenge []byte, head []byte) []byte {
+	input := make([]byte, 0, len(renewalSigningPrefix)+len(challenge)+len(head))
+	input = append(input, renewalSigningPrefix...)
+	input = append(input, challenge...)
+	return append(input, head...)
+}
+
+// SealRenewalCode 在载荷后附加校验位
+func SealRenewalCode(payload []byte) []byte {
+	checksum := sha256.Sum256(payload)
+	sealed := append([]byte(nil), payload...)
+	return append(sealed, checksum[:renewalChecksumSize]...)
+}
+
+// OpenRenewalCode 检查校验位，返回去掉校验位的载荷
+func OpenRenewalCode(sealed []byte) ([]byte, error) {
+	if len(sealed) <= renewalChecksumSize {
+		return nil, errors.New("renewal code is too short")
+	}
+	payload := sealed[:len(sealed)-renewalChecksumSize]
+	checksum := sha256.Sum256(payload)
+	if string(checksum[:renewalChecksumSize]) != string(sealed[len(payload):]) {
+		return nil, ErrRenewalChecksum
+	}
+	return payload, nil
+}
@@ -0,0 +1,33 @@
+package shared
+
+// 请求文件格式版本
+const (
+	RequestFormatLegacy = ""    // 请求数据的hash和时间戳未受保护
+	RequestFormatAEAD   = "2.0" // hash、时间戳和密钥标识作为AES-GCM附加数据与加密请求绑定
+)
+
+// requestAADPrefix 请求附加数据的域分隔前缀
+const requestAADPrefix = "GOLICENSE-REQ-V2\n"
+
+// requestHeader 作为附加数据的请求文件字段
+type requestHeader struct {
+	Version   string `json:"version"`
+	Timestamp int64  `json:"timestamp"`
+	Hash      string `json:"hash"`
+	KeyID     string `json:"key_id"`
+}
+
+// RequestAdditionalData 生成加密请求数据时使用的附加数据
+// 修改req.dat中的hash、时间戳、版本或密钥标识都会导致解密失败
+func RequestAdditionalData(file *RequestFile) ([]byte, error) {
+	canonical, err := CanonicalJSON(requestHeader{
+		Version:   file.Version,
+		Timestamp: file.Timestamp,
+		Hash:      file.Hash,
+		KeyID:     file.KeyID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(requestAADPrefix), canonical...), nil
+}
@@ -0,0 +1,119 @@
+package shared
+
+import (
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+)
+
+// RevocationListFile 吊销列表的默认文件名，客户端从授权文件所在目录加载
+const RevocationListFile = "revoked.dat"
+
+// RevocationListPrefix 吊销列表文件的编码前缀
+const RevocationListPrefix = "CRL:"
+
+// RevocationFormat 吊销列表文件格式版本
+const RevocationFormat = "1.0"
+
+// revocationSignaturePrefix 吊销列表签名输入的域分隔前缀，防止与授权签名混用
+const revocationSignaturePrefix = "GOLICENSE-CRL-V1\n"
+
+// 常用的吊销原因，也可以使用其他说明文字
+const (
+	RevocationReasonRefunded    = "refunded"    // 已退款
+	RevocationReasonCompromised = "compromised" // 授权文件或安装被泄露
+	RevocationReasonSuperseded  = "superseded"  // 已被新授权替代
+	RevocationReasonFraud       = "fraud"       // 违规转售或欺诈
+)
+
+// RevokedLicense 被吊销的授权
+// 序列号由硬件指纹和版本计算，同一机器重新签发时不变，因此吊销记录绑定到具体的授权文件，
+// 之后为同一机器签发的授权（转售、迁回原机器、续订）不受影响
+type RevokedLicense struct {
+	SerialNumber string `json:"serial_number"`        // 授权序列号
+	LicenseID    string `json:"license_id,omitempty"` // 被吊销的授权文件标识，为空时吊销该序列号的全部授权文件
+	Reason       string `json:"reason,omitempty"`     // 吊销原因
+	RevokedAt    int64  `json:"revoked_at"`           // 吊销时间
+}
+
+// RevocationList 吊销列表，每次发布序号递增，客户端据此拒绝旧版本的列表替换新版本
+type RevocationList struct {
+	Sequence int64            `json:"sequence"`  // 发布序号
+	IssuedAt int64            `json:"issued_at"` // 发布时间
+	Revoked  []RevokedLicense `json:"revoked"`   // 被吊销的授权
+}
+
+// Find 查找授权文件对应的吊销记录，licenseID为LicenseFileID返回的授权文件标识
+// 没有授权文件标识的旧记录匹配该序列号的全部授权文件
+func (l *RevocationList) Find(serial, licenseID string) (*RevokedLicense, bool) {
+	for i := range l.Revoked {
+		entry := &l.Revoked[i]
+		if entry.SerialNumber == serial && (entry.LicenseID == "" || entry.LicenseID == licenseID) {
+			return entry, true
+		}
+	}
+	return nil, false
+}
+
+// LicenseFileID 授权文件标识，用于吊销和停用
+// 新授权使用签名覆盖的载荷中每次签发随机生成的license_id，修改签名字段的编码不会改变标识；
+// 没有license_id的旧授权由解码后的签名字节计算，ES256签名先规范化为低s值，license可以为nil
+func LicenseFileID(license *License, file *LicenseFile) string {
+	if license != nil && license.LicenseID != "" {
+		return license.LicenseID
+	}
+	signature, err := base64.StdEncoding.DecodeString(file.Signature)
+	if err != nil {
+		signature = []byte(file.Signature)
+	}
+	if NormalizeSignatureAlgorithm(file.Algorithm) == SignatureES256 && len(signature) == 64 {
+		signature = lowS(signature)
+	}
+	hash := sha256.Sum256(signature)
+	return hex.EncodeToString(hash[:16])
+}
+
+// lowS 将r||s编码的ES256签名规范化为低s值，(r, n-s)与(r, s)同样能通过验证
+func lowS(signature []byte) []byte {
+	n := elliptic.P256().Params().N
+	s := new(big.Int).SetBytes(signature[32:])
+	if s.Cmp(new(big.Int).Rsh(n, 1)) <= 0 {
+		return signature
+	}
+	normalized := append([]byte(nil), signature...)
+	new(big.Int).Sub(n, s).FillBytes(normalized[32:])
+	return normalized
+}
+
+// SignedRevocationList 签名的吊销列表文件(revoked.dat)
+type SignedRevocationList struct {
+	Version   string `json:"version"`   // 文件格式版本
+	Algorithm string `json:"alg"`       // 签名算法
+	KeyID     string `json:"key_id"`    // 签名密钥标识
+	Data      string `json:"data"`      // base64编码的吊销列表JSON
+	Signature string `json:"signature"` // 签名(base64)
+}
+
+// revocationHeader 吊销列表签名覆盖的字段
+type revocationHeader struct {
+	Version   string `json:"version"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"key_id"`
+	Data      string `json:"data"`
+}
+
+// RevocationSigningInput 生成吊销列表的签名输入，覆盖除签名外的全部字段
+func RevocationSigningInput(file *SignedRevocationList) ([]byte, error) {
+	canonical, err := CanonicalJSON(revocationHeader{
+		Version:   file.Version,
+		Algorithm: file.Algorithm,
+		KeyID:     file.KeyID,
+		Data:      file.Data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(revocationSignaturePrefix), canonical...), nil
+}
@@ -2,19 +2,24 @@ package shared
 
 // LicenseRequest 授权请求结构
 type LicenseRequest struct {
-	HardwareID  string `json:"hardware_id"`  // 硬件指纹
-	Timestamp   int64  `json:"timestamp"`    // 生成时间
-	Version     string `json:"version"`      // 程序版本
-	MachineInfo string `json:"machine_info"` // 机器描述信息
-	RequestID   string `json:"request_id"`   // 请求唯一标识
+	HardwareID     string `json:"hardware_id"`               // 硬件指纹
+	Timestamp      int64  `json:"timestamp"`                 // 生成时间
+	Version        string `json:"version"`                   // 程序版本
+	MachineInfo    string `json:"machine_info"`              // 机器描述信息
+	RequestID      string `json:"request_id"`                // 请求唯一标识
+	PublicKey      string `json:"public_key,omitempty"`      // 安装密钥对的X25519公钥(base64)，授权内容只能由该安装解密
+	ActivationCode string `json:"activation_code,omitempty"` // 客户输入的激活码，签发时按激活码内容生成授权
+	LeaseKey       string `json:"lease_key,omitempty"`       // 租约服务器的Ed25519公钥(base64)，仅用于申请浮动授权
 }
 
 // RequestFile req.dat文件格式
 type RequestFile struct {
-	Data      string `json:"data"`      // AES加密的请求数据(base64)
-	Key       string `json:"key"`       // RSA加密的AES密钥(base64)
-	Hash      string `json:"hash"`      // 请求数据hash(hex)
-	Timestamp int64  `json:"timestamp"` // 文件生成时间
+	Data      string `json:"data"`              // AES加密的请求数据(base64)
+	Key       string `json:"key"`               // RSA加密的AES密钥(base64)
+	Hash      string `json:"hash"`              // 请求数据hash(hex)
+	Timestamp int64  `json:"timestamp"`         // 文件生成时间
+	KeyID     string `json:"key_id,omitempty"`  // 加密AES密钥所用的服务端公钥标识
+	Version   string `json:"version,omitempty"` // 请求文件格式版本，为空表示旧格式
 }
 
 // LicenseEdition 授权版本类型
@@ -25,6 +30,22 @@ const (
 	EditionEnterprise LicenseEdition = "enterprise" // 旗舰版
 )
 
+// LicenseType 授权类型
+type LicenseType string
+
+const (
+	LicenseTypeStandard LicenseType = "standard" // 完整授权（旧版本授权该字段为空）
+	LicenseTypeAddon    LicenseType = "addon"    // 增购授权，叠加在基础授权之上
+	LicenseTypeTrial    LicenseType = "trial"    // 试用授权，不绑定硬件，首次运行时开始计时
+	LicenseTypeFloating LicenseType = "floating" // 浮动授权，绑定租约服务器，客户端通过租约并发使用
+)
+
+// MaxTrialDays 试用授权的最长试用天数
+const MaxTrialDays = 30
+
+// AddonFilePattern 增购授权文件名匹配规则（与license.dat放在同一目录）
+const AddonFilePattern = "addon*.dat"
+
 // LicenseModule 功能模块定义
 type LicenseModule string
 
@@ -66,6 +87,47 @@ type License struct {
 	RequestID       string              `json:"request_id"`       // 对应的请求ID
 	LicenseKey      string              `json:"license_key"`      // 授权密钥
 	SerialNumber    string              `json:"serial_number"`    // 序列号
+	LicenseType     LicenseType         `json:"license_type,omitempty"` // 授权类型，为空表示完整授权
+	BaseSerial      string              `json:"base_serial,omitempty"`  // 增购授权对应的基础授权序列号
+	HardwareIDs     []string            `json:"hardware_ids,omitempty"` // 多机授权绑定的硬件指纹列表
+	MaxSeats        int                 `json:"max_seats,omitempty"`    // 多机授权的最大机器数或浮动授权的最大并发数，0表示不限制
+	TrialDays       int                 `json:"trial_days,omitempty"`   // 试用天数，从首次运行开始计算
+	Claims          map[string]interface{} `json:"claims,omitempty"`    // 自定义声明，随授权一起签名
+	LeaseKey        string              `json:"lease_key,omitempty"`    // 浮动授权的租约签名公钥(Ed25519, base64)
+	LicenseID       string              `json:"license_id,omitempty"`   // 每次签发随机生成的授权文件标识，用于吊销和停用
+}
+
+// IsTrial 是否为试用授权
+func (l *License) IsTrial() bool {
+	return l.LicenseType == LicenseTypeTrial
+}
+
+// IsSiteLicense 是否为多机授权
+func (l *License) IsSiteLicense() bool {
+	return len(l.HardwareIDs) > 0
+}
+
+// IsBoundTo 检查授权是否绑定了指定的硬件指纹
+func (l *License) IsBoundTo(hardwareID string) bool {
+	if l.HardwareID != "" && l.HardwareID == hardwareID {
+		return true
+	}
+	for _, id := range l.HardwareIDs {
+		if id == hardwareID {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFloating 是否为浮动授权
+func (l *License) IsFloating() bool {
+	return l.LicenseType == LicenseTypeFloating
+}
+
+// IsAddon 是否为增购授权
+func (l *License) IsAddon() bool {
+	return l.LicenseType == LicenseTypeAddon
 }
 
 // GetDefaultModulePermissions 获取版本对应的默认模块权限
@@ -134,10 +196,49 @@ func GetModulesForEdition(edition LicenseEdition) []LicenseModule {
 	}
 }
 
+// GetAllModules 获取全部已定义的模块
+func GetAllModules() []LicenseModule {
+	return GetModulesForEdition(EditionEnterprise)
+}
+
+// ParseLicenseModule 解析模块名称
+func ParseLicenseModule(name string) (LicenseModule, bool) {
+	for _, module := range GetAllModules() {
+		if string(module) == name {
+			return module, true
+		}
+	}
+	return "", false
+}
+
+// GetDefaultModulePermission 获取单个模块的默认权限
+func GetDefaultModulePermission(module LicenseModule) (ModulePermissions, bool) {
+	for _, perm := range GetDefaultModulePermissions(EditionEnterprise) {
+		if perm.Module == module {
+			return perm, true
+		}
+	}
+	return ModulePermissions{}, false
+}
+
+// LicenseRecipient 授权内容密钥的接收方，多机授权中每台机器对应一项
+type LicenseRecipient struct {
+	ID        string `json:"id"`             // 接收方标识：硬件派生密钥的校验值或安装公钥标识
+	Key       string `json:"key"`            // 用接收方密钥加密的内容密钥(base64)
+	Type      string `json:"type,omitempty"` // 接收方类型，为空表示硬件派生密钥
+	Ephemeral string `json:"epk,omitempty"`  // X25519接收方的临时公钥(base64)
+}
+
 // LicenseFile license.dat文件格式
 type LicenseFile struct {
-	Data      string `json:"data"`      // AES加密的授权数据(base64)
-	Key       string `json:"key"`       // AES密钥hash(用硬件指纹派生)
-	Signature string `json:"signature"` // RSA签名(base64)
-	Version   string `json:"version"`   // 文件格式版本
+	Data       string             `json:"data"`                 // AES加密的授权数据(base64)
+	Key        string             `json:"key"`                  // 密钥校验值(用硬件指纹派生)
+	Signature  string             `json:"signature"`            // 签名(base64)
+	Version    string             `json:"version"`              // 文件格式版本
+	Recipients []LicenseRecipient `json:"recipients,omitempty"` // 多机授权的内容密钥接收方列表
+	KeyID      string             `json:"key_id,omitempty"`     // 签名密钥标识，为空表示轮换前签发的旧授权
+	Algorithm  string             `json:"alg,omitempty"`        // 签名算法，为空表示RS256
+	Binding    string             `json:"binding,omitempty"`    // 绑定方式，为空时由信封内容推断
+	KDF        string             `json:"kdf,omitempty"`        // 授权密钥派生算法，为空表示旧的固定salt方案
+	Salt       string             `json:"salt,omitempty"`       // 授权密钥派生的随机salt(base64)
 }
\ No newline at end of file